@@ -1,31 +1,49 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/ayvan/ninjam-dj-bot/auth"
 	"github.com/ayvan/ninjam-dj-bot/config"
 	"github.com/ayvan/ninjam-dj-bot/dj"
 	"github.com/ayvan/ninjam-dj-bot/helpers"
+	"github.com/ayvan/ninjam-dj-bot/lib"
 	"github.com/ayvan/ninjam-dj-bot/tracks"
 	"github.com/ayvan/ninjam-dj-bot/tracks_sync"
 	"github.com/labstack/echo"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
 	"io"
 	"net/http"
 	"os"
 	"path"
 	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	eventsKeepAlive       = time.Second * 30 // period of keep-alive comments of the events stream
+	defaultPreviewRepeats = 2
+	defaultWaveformPoints = 2000
+	maxWaveformPoints     = 20000
+	defaultMinConfidence  = 0.5
 )
 
 type ErrorResp struct {
-	Error string `json:"error"`
-	Code  int    `json:"code"`
+	Error  string `json:"error"`
+	Code   int    `json:"code"`
+	Reason string `json:"reason,omitempty"` // machine readable reason, e.g. already_playing for player actions
 }
 
 var jamDB *tracks.JamDB
+var authDB *auth.DB
 var authenticator *auth.JWTAuth
 
 func Init(db *tracks.JamDB, aDB *auth.DB) {
 	jamDB = db
+	authDB = aDB
 
 	conf := auth.Config{
 		PrivateKeyPath:       config.Get().PrivateKeyPath,
@@ -59,13 +77,57 @@ func Login(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, token)
 }
 
-// Tracks GET /tracks
+const (
+	defaultTracksPerPage = 50
+	maxTracksPerPage     = 500
+)
+
+// Tracks GET /tracks?q=&key=&bpm_min=&bpm_max=&tag=&page=&per_page=
 func Tracks(ctx echo.Context) error {
-	t, err := jamDB.Tracks()
+	filter := tracks.TrackFilter{
+		Query: ctx.QueryParam("q"),
+		Tags:  ctx.QueryParams()["tag"],
+	}
+
+	if key := ctx.QueryParam("key"); key != "" {
+		keyMode := lib.KeyModeByName(key)
+		if keyMode.Key == 0 {
+			return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, fmt.Sprintf("bad key %s", key)))
+		}
+		filter.Key, filter.Mode = keyMode.Key, keyMode.Mode
+	}
+
+	params := map[string]int{"bpm_min": 0, "bpm_max": 0, "page": 1, "per_page": defaultTracksPerPage}
+	for name := range params {
+		value := ctx.QueryParam(name)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 {
+			return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, fmt.Sprintf("bad %s %s", name, value)))
+		}
+		params[name] = v
+	}
+	if params["page"] < 1 || params["per_page"] < 1 || params["per_page"] > maxTracksPerPage {
+		return ctx.JSON(http.StatusBadRequest,
+			newError(http.StatusBadRequest, fmt.Sprintf("page must be 1 or more, per_page from 1 to %d", maxTracksPerPage)))
+	}
+
+	filter.BPMMin = uint(params["bpm_min"])
+	filter.BPMMax = uint(params["bpm_max"])
+	filter.Limit = params["per_page"]
+	filter.Offset = (params["page"] - 1) * params["per_page"]
+
+	t, total, err := jamDB.FindTracks(filter)
 	if err != nil {
 		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
 	}
 
+	ctx.Response().Header().Set("X-Total-Count", strconv.Itoa(total))
+	ctx.Response().Header().Set("X-Page", strconv.Itoa(params["page"]))
+	ctx.Response().Header().Set("X-Per-Page", strconv.Itoa(params["per_page"]))
+
 	return ctx.JSON(http.StatusOK, t)
 }
 
@@ -341,6 +403,11 @@ func PutTrack(ctx echo.Context) error {
 		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
 	}
 
+	// отредактированный трек проверен человеком, синхронизация сохранит его BPM и тональность
+	if _, err = jamDB.DetectionReview(track); err != nil && err != tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
 	return ctx.JSON(http.StatusOK, track)
 }
 
@@ -351,6 +418,10 @@ func PostPlaylist(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
 	}
 
+	if err := validatePlaylist(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
 	db := jamDB.DB().Save(&req)
 	if db.Error != nil {
 		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, db.Error.Error()))
@@ -412,6 +483,10 @@ func PutPlaylist(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
 	}
 
+	if err := validatePlaylist(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
 	playlist, err := jamDB.PlaylistUpdate(uint(id), &req)
 	if err == tracks.ErrorNotFound {
 		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound))
@@ -422,6 +497,412 @@ func PutPlaylist(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, playlist)
 }
 
+// TrackAudio GET /tracks/:id/audio serves the audio file of the track, Range requests are supported
+func TrackAudio(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	track, err := jamDB.Track(uint(id))
+	if err == tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, err.Error()))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	file, err := os.Open(path.Join(config.Get().TracksDir, track.FilePath))
+	if os.IsNotExist(err) {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, "track file not found"))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, "audio/mpeg")
+	http.ServeContent(ctx.Response(), ctx.Request(), path.Base(track.FilePath), info.ModTime(), file)
+
+	return nil
+}
+
+// WaveformResp is the waveform of the track downsampled to points, times are in seconds
+type WaveformResp struct {
+	TrackID   uint    `json:"track_id"`
+	Length    float64 `json:"length"`
+	LoopStart float64 `json:"loop_start"`
+	LoopEnd   float64 `json:"loop_end"`
+	Points    int     `json:"points"`
+	tracks.WaveformPoints
+	BeatGrid tracks_sync.BeatGrid `json:"beat_grid"`
+}
+
+// TrackWaveform GET /tracks/:id/waveform?points= returns peaks, short-term loudness and the beat grid of the track
+func TrackWaveform(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	points := defaultWaveformPoints
+	if value := ctx.QueryParam("points"); value != "" {
+		points, err = strconv.Atoi(value)
+		if err != nil || points < 1 || points > maxWaveformPoints {
+			return ctx.JSON(http.StatusBadRequest,
+				newError(http.StatusBadRequest, fmt.Sprintf("points must be from 1 to %d", maxWaveformPoints)))
+		}
+	}
+
+	track, err := jamDB.Track(uint(id))
+	if err == tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, err.Error()))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	waveform, err := tracks_sync.TrackWaveform(track)
+	if os.IsNotExist(err) {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, "track file not found"))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	length := time.Duration(waveform.Length) * time.Microsecond
+
+	return ctx.JSON(http.StatusOK, WaveformResp{
+		TrackID:        track.ID,
+		Length:         length.Seconds(),
+		LoopStart:      (time.Duration(track.LoopStart) * time.Microsecond).Seconds(),
+		LoopEnd:        (time.Duration(track.LoopEnd) * time.Microsecond).Seconds(),
+		Points:         points,
+		WaveformPoints: waveform.Points(points),
+		BeatGrid:       tracks_sync.NewBeatGrid(track, length),
+	})
+}
+
+// TrackLoop GET /tracks/:id/loop returns the loop suggested by audio analysis for the track
+func TrackLoop(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	_, suggestion, err := trackLoopSuggestion(uint(id))
+	if err != nil {
+		return loopError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, suggestion)
+}
+
+// ApplyTrackLoop POST /tracks/:id/loop/apply sets loop points of the track from the suggestion
+func ApplyTrackLoop(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	track, suggestion, err := trackLoopSuggestion(uint(id))
+	if err != nil {
+		return loopError(ctx, err)
+	}
+
+	track, err = tracks_sync.ApplyLoopSuggestion(track, suggestion)
+	if err != nil {
+		return loopError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, track)
+}
+
+func trackLoopSuggestion(id uint) (*tracks.Track, *tracks.LoopSuggestion, error) {
+	track, err := jamDB.Track(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if track.BPM == 0 {
+		return nil, nil, errBPMUnknown
+	}
+
+	suggestion, err := tracks_sync.TrackLoopSuggestion(track)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return track, suggestion, nil
+}
+
+var errBPMUnknown = fmt.Errorf("track BPM is unknown, bars can't be found")
+
+// loopError writes the error of loop suggestion: 409 if the loop can't be found
+func loopError(ctx echo.Context, err error) error {
+	switch {
+	case err == tracks.ErrorNotFound:
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, err.Error()))
+	case os.IsNotExist(err):
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, "track file not found"))
+	case err == errBPMUnknown || err == tracks_sync.ErrorNoLoop:
+		resp := newError(http.StatusConflict, err.Error())
+		resp.Reason = "no_loop"
+		if err == errBPMUnknown {
+			resp.Reason = "bpm_unknown"
+		}
+		return ctx.JSON(http.StatusConflict, resp)
+	}
+
+	return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+}
+
+// TrackReview is the track with BPM or key detected with low confidence
+type TrackReview struct {
+	Track     *tracks.Track     `json:"track"`
+	Detection *tracks.Detection `json:"detection"`
+}
+
+// TracksForReview GET /tracks/review lists tracks with detected BPM or key which should be checked by a human
+func TracksForReview(ctx echo.Context) error {
+	minConfidence := config.Get().Detection.MinConfidence
+	if minConfidence == 0 {
+		minConfidence = defaultMinConfidence
+	}
+
+	detections, err := jamDB.DetectionsForReview(minConfidence)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	res := make([]TrackReview, 0, len(detections))
+	for _, detection := range detections {
+		track, err := jamDB.Track(detection.TrackID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+		}
+		res = append(res, TrackReview{Track: track, Detection: detection})
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// TrackDetection GET /tracks/:id/detection returns BPM and key detected from the track audio
+func TrackDetection(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	detection, err := jamDB.Detection(uint(id))
+	if err == tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, err.Error()))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	return ctx.JSON(http.StatusOK, detection)
+}
+
+// ReviewTrack POST /tracks/:id/review confirms BPM and key of the track as they are
+func ReviewTrack(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	track, err := jamDB.Track(uint(id))
+	if err == tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, err.Error()))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	detection, err := jamDB.DetectionReview(track)
+	if err == tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, "track has no detection"))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	return ctx.JSON(http.StatusOK, detection)
+}
+
+// LibrarySync GET /library/sync returns the status of the running or the last library sync
+func LibrarySync(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, tracks_sync.Status())
+}
+
+// StartLibrarySync POST /library/sync starts sync of the tracks directory with DB in background
+func StartLibrarySync(ctx echo.Context) error {
+	err := tracks_sync.StartSync(config.Get().Sync.Workers, nil)
+	if err == tracks_sync.ErrorSyncRunning {
+		resp := newError(http.StatusConflict, err.Error())
+		resp.Reason = "running"
+		return ctx.JSON(http.StatusConflict, resp)
+	}
+
+	return ctx.JSON(http.StatusAccepted, tracks_sync.Status())
+}
+
+// DeleteTrack DELETE /tracks/:id?cascade=&remove_file=
+func DeleteTrack(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+	cascade, err := boolParam(ctx, "cascade")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+	removeFile, err := boolParam(ctx, "remove_file")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	// без файла трек восстанавливать бессмысленно, поэтому вместе с файлом удаляем и запись,
+	// файл удаляется первым, и ошибка его удаления оставляет трек как есть
+	_, err = jamDB.TrackDelete(uint(id), cascade, removeFile, removeTrackFile)
+	if err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// removeTrackFile removes the audio file of the track, a file already missing is removed too
+func removeTrackFile(track *tracks.Track) error {
+	if track.FilePath == "" {
+		return nil
+	}
+	err := os.Remove(path.Join(config.Get().TracksDir, track.FilePath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// DeletePlaylist DELETE /playlists/:id
+func DeletePlaylist(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	if err = jamDB.PlaylistDelete(uint(id)); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// DeleteTag DELETE /tags/:id?cascade=
+func DeleteTag(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+	cascade, err := boolParam(ctx, "cascade")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	if err = jamDB.TagDelete(uint(id), cascade); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// DeleteAuthor DELETE /authors/:id?cascade=
+func DeleteAuthor(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+	cascade, err := boolParam(ctx, "cascade")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	if err = jamDB.AuthorDelete(uint(id), cascade); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// Deleted GET /deleted lists soft deleted items which can be restored
+func Deleted(ctx echo.Context) error {
+	deleted, err := jamDB.Deleted()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	return ctx.JSON(http.StatusOK, deleted)
+}
+
+// Restore POST /tracks/:id/restore, /playlists/:id/restore, /tags/:id/restore and /authors/:id/restore
+func Restore(restore func(id uint) (interface{}, error)) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+		}
+
+		res, err := restore(uint(id))
+		if err != nil {
+			return deleteError(ctx, err)
+		}
+
+		return ctx.JSON(http.StatusOK, res)
+	}
+}
+
+// deleteError responds to the failed delete or restore
+func deleteError(ctx echo.Context, err error) error {
+	if err == tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, err.Error()))
+	}
+	if refErr, ok := err.(*tracks.ReferencedError); ok {
+		resp := newError(http.StatusConflict, refErr.Error())
+		resp.Reason = "referenced"
+		return ctx.JSON(http.StatusConflict, resp)
+	}
+
+	return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+}
+
+// boolParam parses optional bool query param, false if it's empty
+func boolParam(ctx echo.Context, name string) (bool, error) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("bad %s %s", name, value)
+	}
+
+	return v, nil
+}
+
+func validatePlaylist(playlist *tracks.Playlist) error {
+	for _, listTrack := range playlist.Tracks {
+		if listTrack.SoloPolicy == "" {
+			continue
+		}
+
+		policy := lib.SoloPolicy{Kind: listTrack.SoloPolicy, Value: listTrack.SoloValue}
+		if err := policy.Valid(); err != nil {
+			return fmt.Errorf("track %d: %s", listTrack.TrackID, err)
+		}
+	}
+
+	return nil
+}
+
 func newError(code int, message ...string) ErrorResp {
 	msg := ""
 	if len(message) == 0 || message[0] == "" {
@@ -446,12 +927,37 @@ func (c QueueController) Users(ctx echo.Context) error {
 	})
 }
 
+// Queue history GET /queue/history
+func (c QueueController) History(ctx echo.Context) error {
+	history, err := c.jm.QueueHistory()
+	if err != nil {
+		logrus.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError))
+	}
+
+	return ctx.JSON(http.StatusOK, history)
+}
+
 // Queue command POST /queue/:command
 func (c QueueController) Command(ctx echo.Context) error {
 	command := ctx.Param("command")
-	username := ctx.QueryParam("user")
 
-	msg, err := c.jm.APICommand(command, username)
+	params := dj.QueueCommandParams{
+		User: ctx.QueryParam("user"),
+		With: ctx.QueryParam("with"),
+		Mode: strings.TrimSpace(ctx.QueryParam("mode") + " " + ctx.QueryParam("bars")),
+	}
+	if position := ctx.QueryParam("position"); position != "" {
+		pos, err := strconv.Atoi(position)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, struct {
+				Error string `json:"error"`
+			}{Error: err.Error()})
+		}
+		params.Position = pos
+	}
+
+	msg, err := c.jm.APICommand(command, params)
 	if err != nil {
 		return ctx.JSON(http.StatusBadRequest, struct {
 			Error string `json:"error"`
@@ -490,3 +996,327 @@ func (c QueueController) TTS(ctx echo.Context) error {
 		Message: "ok",
 	})
 }
+
+// RoleResp is a role of a NINJAM user
+type RoleResp struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Roles GET /roles
+func Roles(ctx echo.Context) error {
+	roles, err := authDB.UserRoles()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	res := make([]RoleResp, 0, len(roles))
+	for _, r := range roles {
+		res = append(res, RoleResp{Name: r.Name, Role: r.Role})
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// PutRole PUT /roles/:name
+func PutRole(ctx echo.Context) error {
+	name := ctx.Param("name")
+
+	req := RoleResp{}
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	userRole, err := authDB.UserRoleSet(name, role)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	return ctx.JSON(http.StatusOK, RoleResp{Name: userRole.Name, Role: userRole.Role})
+}
+
+// DeleteRole DELETE /roles/:name
+func DeleteRole(ctx echo.Context) error {
+	err := authDB.UserRoleDelete(ctx.Param("name"))
+	if err == auth.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+type VotesController struct {
+	jm *dj.JamManager
+}
+
+// Votes GET /votes
+func (c VotesController) Votes(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, struct {
+		Votes []dj.VoteStatus `json:"votes"`
+	}{
+		Votes: c.jm.Votes(),
+	})
+}
+
+// Requests GET /requests
+func (c VotesController) Requests(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, struct {
+		Requests []dj.TrackRequest `json:"requests"`
+	}{
+		Requests: c.jm.Requests(),
+	})
+}
+
+type PlayerController struct {
+	jm *dj.JamManager
+}
+
+// State GET /player
+func (c PlayerController) State(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, c.jm.PlayerState())
+}
+
+// Action POST /player/:action, actions are random, track, playlist, stop, next, prev, pause and resume
+func (c PlayerController) Action(ctx echo.Context) error {
+	var err error
+	switch action := ctx.Param("action"); action {
+	case "random":
+		command, e := randomCommand(ctx)
+		if e != nil {
+			return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, e.Error()))
+		}
+		ids, unknown, e := tagIDs(ctx.QueryParams()["tag"])
+		if e != nil {
+			return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, e.Error()))
+		}
+		if unknown != "" {
+			return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, fmt.Sprintf("tag %s not found", unknown)))
+		}
+		command.Tags = ids
+		err = c.jm.PlayerRandom(command)
+	case "track", "playlist":
+		id, e := strconv.Atoi(ctx.QueryParam("id"))
+		if e != nil || id < 1 {
+			return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, fmt.Sprintf("bad id %s", ctx.QueryParam("id"))))
+		}
+		if action == "track" {
+			err = c.jm.PlayerTrack(uint(id))
+		} else {
+			err = c.jm.PlayerPlaylist(uint(id))
+		}
+	case "stop":
+		err = c.jm.PlayerStop()
+	case "next":
+		err = c.jm.PlayerNext()
+	case "prev":
+		err = c.jm.PlayerPrev()
+	case "pause":
+		err = c.jm.PlayerPause()
+	case "resume":
+		err = c.jm.PlayerResume()
+	default:
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, fmt.Sprintf("unknown player action %s", action)))
+	}
+
+	if playerErr, ok := err.(*dj.PlayerError); ok {
+		code := http.StatusConflict
+		switch playerErr.Code {
+		case dj.PlayerTrackNotFound, dj.PlayerPlaylistNotFound, dj.PlayerNoMatchingTrack:
+			code = http.StatusNotFound
+		}
+		resp := newError(code, playerErr.Error())
+		resp.Reason = string(playerErr.Code)
+		return ctx.JSON(code, resp)
+	} else if err != nil {
+		logrus.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	return ctx.JSON(http.StatusOK, c.jm.PlayerState())
+}
+
+// Preview GET /tracks/:id/preview?repeats= renders the track through the player loop and LV2 plugins as WAV
+func (c PlayerController) Preview(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, newError(http.StatusBadRequest, err.Error()))
+	}
+
+	repeats := uint64(defaultPreviewRepeats)
+	if value := ctx.QueryParam("repeats"); value != "" {
+		repeats, err = strconv.ParseUint(value, 10, 32)
+		if err != nil || repeats > dj.MaxPreviewRepeats {
+			return ctx.JSON(http.StatusBadRequest,
+				newError(http.StatusBadRequest, fmt.Sprintf("repeats must be from 0 to %d", dj.MaxPreviewRepeats)))
+		}
+	}
+
+	track, err := jamDB.Track(uint(id))
+	if err == tracks.ErrorNotFound {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, err.Error()))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	// WAV рендерим целиком в память: заголовку нужен размер, а клиенту - Range для перемотки
+	buf := &bytes.Buffer{}
+	if err = c.jm.Preview(track, uint(repeats), buf); os.IsNotExist(err) {
+		return ctx.JSON(http.StatusNotFound, newError(http.StatusNotFound, "track file not found"))
+	} else if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, newError(http.StatusInternalServerError, err.Error()))
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, "audio/wav")
+	http.ServeContent(ctx.Response(), ctx.Request(), fmt.Sprintf("preview-%d.wav", track.ID), time.Time{}, bytes.NewReader(buf.Bytes()))
+
+	return nil
+}
+
+// randomCommand makes the random track command from query params key, bpm_min, bpm_max and length
+func randomCommand(ctx echo.Context) (command lib.JamCommand, err error) {
+	if key := ctx.QueryParam("key"); key != "" {
+		keyMode := lib.KeyModeByName(key)
+		if keyMode.Key == 0 {
+			return command, fmt.Errorf("bad key %s", key)
+		}
+		command.Key, command.Mode = keyMode.Key, keyMode.Mode
+	}
+
+	for name, v := range map[string]*uint{"bpm_min": &command.BPMMin, "bpm_max": &command.BPMMax} {
+		value := ctx.QueryParam(name)
+		if value == "" {
+			continue
+		}
+		bpm, e := strconv.Atoi(value)
+		if e != nil || bpm < 0 {
+			return command, fmt.Errorf("bad %s %s", name, value)
+		}
+		*v = uint(bpm)
+	}
+
+	if length := ctx.QueryParam("length"); length != "" {
+		playLength, e := lib.ParseLength(length)
+		if e != nil {
+			return command, fmt.Errorf("bad length %s: %s", length, e)
+		}
+		command.Duration, command.Loops, command.Bars = playLength.Duration, playLength.Loops, playLength.Bars
+	}
+
+	return
+}
+
+// tagIDs returns IDs of tags by names, unknown is the first name without a tag
+func tagIDs(names []string) (ids []uint, unknown string, err error) {
+	if len(names) == 0 {
+		return
+	}
+	tags, err := jamDB.Tags()
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		found := false
+		for _, tag := range tags {
+			if strings.EqualFold(tag.Name, name) {
+				ids = append(ids, tag.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, name, nil
+		}
+	}
+
+	return
+}
+
+type EventsController struct {
+	jm *dj.JamManager
+}
+
+// SSE GET /events streams live bot events as server-sent events, the first one is the state of the bot
+func (c EventsController) SSE(ctx echo.Context) error {
+	events, cancel := c.jm.Subscribe()
+	defer cancel()
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return nil
+		case <-keepAlive.C:
+			// комментарий не даёт прокси закрыть молчащее соединение
+			if _, err := io.WriteString(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logrus.Errorf("event %d: %s", event.ID, err)
+				continue
+			}
+			if _, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+// WebSocket GET /events/ws streams live bot events as JSON messages over WebSocket, the first one is the state of the bot
+func (c EventsController) WebSocket(ctx echo.Context) error {
+	// без проверки Origin: доступ даёт токен, а не cookies браузера
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		events, cancel := c.jm.Subscribe()
+		defer cancel()
+
+		// клиент ничего не шлёт, читаем только чтобы узнать о закрытии соединения
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var msg string
+			for websocket.Message.Receive(ws, &msg) == nil {
+			}
+		}()
+
+		for {
+			select {
+			case <-closed:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					logrus.Debugf("events websocket: %s", err)
+					return
+				}
+			}
+		}
+	}}
+	server.ServeHTTP(ctx.Response(), ctx.Request())
+
+	return nil
+}
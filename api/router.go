@@ -25,33 +25,72 @@ func Run(hostAndPort string, jamManager *dj.JamManager) {
 	routes.Use(NoCacheHeaders)
 	routes.POST("/login", Login)
 
+	// EventSource and WebSocket clients of browsers can't set headers, they pass the token in the query
+	eventsController := EventsController{jm: jamManager}
+	routes.GET("/events", eventsController.SSE, QueryToken, Auth())
+	routes.GET("/events/ws", eventsController.WebSocket, QueryToken, Auth())
+
 	routes.Use(Auth())
 
+	routes.GET("/library/sync", LibrarySync)
+	routes.POST("/library/sync", StartLibrarySync)
+
 	routes.GET("/tracks", Tracks)
+	routes.GET("/tracks/review", TracksForReview)
 	routes.GET("/tracks/:id", Track)
 	routes.PUT("/tracks/:id", PutTrack)
 	routes.POST("/tracks", PostTrack)
+	routes.DELETE("/tracks/:id", DeleteTrack)
+	routes.GET("/tracks/:id/audio", TrackAudio)
+	routes.GET("/tracks/:id/waveform", TrackWaveform)
+	routes.GET("/tracks/:id/loop", TrackLoop)
+	routes.POST("/tracks/:id/loop/apply", ApplyTrackLoop)
+	routes.GET("/tracks/:id/detection", TrackDetection)
+	routes.POST("/tracks/:id/review", ReviewTrack)
+	routes.POST("/tracks/:id/restore", Restore(func(id uint) (interface{}, error) { return jamDB.TrackRestore(id) }))
 
 	routes.GET("/playlists", Playlists)
 	routes.GET("/playlists/:id", Playlist)
 	routes.PUT("/playlists/:id", PutPlaylist)
 	routes.POST("/playlists", PostPlaylist)
+	routes.DELETE("/playlists/:id", DeletePlaylist)
+	routes.POST("/playlists/:id/restore", Restore(func(id uint) (interface{}, error) { return jamDB.PlaylistRestore(id) }))
 
 	routes.GET("/tags", Tags)
 	routes.GET("/tags/:id", Tag)
 	routes.PUT("/tags/:id", PutTag)
 	routes.POST("/tags", PostTag)
+	routes.DELETE("/tags/:id", DeleteTag)
+	routes.POST("/tags/:id/restore", Restore(func(id uint) (interface{}, error) { return jamDB.TagRestore(id) }))
 
 	routes.GET("/authors", Authors)
 	routes.GET("/authors/:id", Author)
 	routes.PUT("/authors/:id", PutAuthor)
 	routes.POST("/authors", PostAuthor)
+	routes.DELETE("/authors/:id", DeleteAuthor)
+	routes.POST("/authors/:id/restore", Restore(func(id uint) (interface{}, error) { return jamDB.AuthorRestore(id) }))
+
+	routes.GET("/deleted", Deleted)
+
+	routes.GET("/roles", Roles)
+	routes.PUT("/roles/:name", PutRole)
+	routes.DELETE("/roles/:name", DeleteRole)
 
 	queueController := QueueController{jm: jamManager}
 	routes.GET("/queue/users", queueController.Users)
+	routes.GET("/queue/history", queueController.History)
 	routes.POST("/queue/:command", queueController.Command)
 	routes.POST("/tts", queueController.TTS)
 
+	playerController := PlayerController{jm: jamManager}
+	routes.GET("/player", playerController.State)
+	routes.POST("/player/:action", playerController.Action)
+	routes.GET("/tracks/:id/preview", playerController.Preview)
+
+	votesController := VotesController{jm: jamManager}
+	routes.GET("/votes", votesController.Votes)
+	routes.GET("/requests", votesController.Requests)
+
 	routes.GET("/test", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"message": "ok"})
 	})
@@ -72,6 +111,18 @@ func NoCacheHeaders(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// QueryToken takes the token from access_token query param if the request has no Authorization header
+func QueryToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if token := c.QueryParam("access_token"); token != "" && req.Header.Get(echo.HeaderAuthorization) == "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+
+		return next(c)
+	}
+}
+
 func Auth() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -3,6 +3,7 @@ package auth
 import (
 	"fmt"
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
 var ErrorNotFound = fmt.Errorf("not found")
@@ -25,7 +26,7 @@ func NewDB(file string) (jamDB *DB, err error) {
 		return
 	}
 
-	if err = db.AutoMigrate(&User{}).Error; err != nil {
+	if err = db.AutoMigrate(&User{}, &UserRole{}, &UserLanguage{}).Error; err != nil {
 		err = fmt.Errorf("failed to migrate database: %s", err)
 		return
 	}
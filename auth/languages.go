@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+// UserLanguage is the language of bot replies to a NINJAM user, Name is the user name without @ip suffix
+type UserLanguage struct {
+	gorm.Model
+	Name     string `gorm:"unique_index"`
+	Language string
+}
+
+func languageUserName(userName string) string {
+	if i := strings.Index(userName, "@"); i >= 0 {
+		return userName[:i]
+	}
+	return userName
+}
+
+// LanguageOf returns the language of the NINJAM user, the user name may have @ip suffix
+func (db *DB) LanguageOf(userName string) (lang string, err error) {
+	userLanguage := &UserLanguage{}
+	dbRes := db.DB().First(userLanguage, "name = ?", languageUserName(userName))
+	if dbRes.RecordNotFound() {
+		err = ErrorNotFound
+		return
+	}
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+
+	return userLanguage.Language, nil
+}
+
+// LanguageSet sets the language of the NINJAM user for any address the user comes from
+func (db *DB) LanguageSet(userName, lang string) (err error) {
+	userLanguage := &UserLanguage{}
+	dbRes := db.DB().FirstOrInit(userLanguage, UserLanguage{Name: languageUserName(userName)})
+	if dbRes.Error != nil {
+		return dbRes.Error
+	}
+
+	userLanguage.Language = lang
+
+	return db.DB().Save(userLanguage).Error
+}
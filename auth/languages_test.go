@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB_LanguageOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewDB(filepath.Join(dir, "users.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.DBClose()
+
+	_, err = db.LanguageOf("alice")
+	assert.Equal(t, ErrorNotFound, err)
+
+	assert.NoError(t, db.LanguageSet("alice@1.2.3.x", "ru"))
+	// the language follows the user to another address
+	lang, err := db.LanguageOf("alice@5.6.7.x")
+	assert.NoError(t, err)
+	assert.Equal(t, "ru", lang)
+
+	assert.NoError(t, db.LanguageSet("alice", "en"))
+	lang, err = db.LanguageOf("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "en", lang)
+
+	var count int
+	assert.NoError(t, db.DB().Model(&UserLanguage{}).Count(&count).Error)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+// Role is a permission level of a NINJAM user, every role has the permissions of the lower ones
+type Role uint
+
+const (
+	RoleUnknown Role = iota
+	RoleGuest
+	RoleMusician
+	RoleDJ
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleGuest:    "guest",
+	RoleMusician: "musician",
+	RoleDJ:       "dj",
+	RoleAdmin:    "admin",
+}
+
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == strings.ToLower(name) {
+			return role, nil
+		}
+	}
+
+	return RoleUnknown, fmt.Errorf("unknown role %q, use guest, musician, dj or admin", name)
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// UserRole is a role of a NINJAM user, Name is either a user name without @ip suffix
+// to match the user from any address or a full name with the suffix
+type UserRole struct {
+	gorm.Model
+	Name string `gorm:"unique_index"`
+	Role string
+}
+
+func (db *DB) UserRoles() (roles []*UserRole, err error) {
+	roles = []*UserRole{}
+	err = db.DB().Order("name").Find(&roles).Error
+	return
+}
+
+func (db *DB) UserRole(name string) (res *UserRole, err error) {
+	userRole := &UserRole{}
+	dbRes := db.DB().First(userRole, "name = ?", name)
+	if dbRes.RecordNotFound() {
+		err = ErrorNotFound
+		return
+	}
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+
+	res = userRole
+
+	return
+}
+
+// UserRoleSet creates or changes the role of the NINJAM user
+func (db *DB) UserRoleSet(name string, role Role) (res *UserRole, err error) {
+	if role == RoleUnknown {
+		err = fmt.Errorf("unknown role")
+		return
+	}
+
+	userRole, err := db.UserRole(name)
+	if err == ErrorNotFound {
+		userRole, err = &UserRole{Name: name}, nil
+	}
+	if err != nil {
+		return
+	}
+
+	userRole.Role = role.String()
+	if err = db.DB().Save(userRole).Error; err != nil {
+		return
+	}
+
+	res = userRole
+
+	return
+}
+
+func (db *DB) UserRoleDelete(name string) (err error) {
+	dbRes := db.DB().Unscoped().Delete(&UserRole{}, "name = ?", name)
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+	if dbRes.RowsAffected == 0 {
+		err = ErrorNotFound
+	}
+
+	return
+}
+
+// RoleOf returns the role of the NINJAM user, the role set for the full name with @ip suffix
+// takes precedence over the one set for the name without it
+func (db *DB) RoleOf(userName string) (role Role, err error) {
+	names := []string{userName}
+	if i := strings.Index(userName, "@"); i >= 0 {
+		names = append(names, userName[:i])
+	}
+
+	for _, name := range names {
+		var userRole *UserRole
+		userRole, err = db.UserRole(name)
+		if err == ErrorNotFound {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		return ParseRole(userRole.Role)
+	}
+
+	err = ErrorNotFound
+
+	return
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDB_RoleOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewDB(filepath.Join(dir, "users.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.DBClose()
+
+	_, err = db.UserRoleSet("alice", RoleDJ)
+	assert.NoError(t, err)
+	_, err = db.UserRoleSet("bob@1.2.3.x", RoleAdmin)
+	assert.NoError(t, err)
+	_, err = db.UserRoleSet("bob", RoleGuest)
+	assert.NoError(t, err)
+	// changing the role doesn't create another record
+	_, err = db.UserRoleSet("alice", RoleMusician)
+	assert.NoError(t, err)
+
+	roles, err := db.UserRoles()
+	assert.NoError(t, err)
+	assert.Len(t, roles, 3)
+
+	role, err := db.RoleOf("alice@5.6.7.x")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleMusician, role)
+
+	role, err = db.RoleOf("bob@1.2.3.x")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleAdmin, role)
+
+	role, err = db.RoleOf("bob@9.9.9.x")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleGuest, role)
+
+	_, err = db.RoleOf("carol")
+	assert.Equal(t, ErrorNotFound, err)
+
+	assert.NoError(t, db.UserRoleDelete("alice"))
+	assert.Equal(t, ErrorNotFound, db.UserRoleDelete("alice"))
+	_, err = db.UserRoleSet("alice", RoleUnknown)
+	assert.Error(t, err)
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("DJ")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleDJ, role)
+	assert.Equal(t, "dj", role.String())
+
+	_, err = ParseRole("root")
+	assert.Error(t, err)
+
+	assert.True(t, RoleGuest < RoleMusician && RoleMusician < RoleDJ && RoleDJ < RoleAdmin)
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 var Language language.Tag
@@ -19,6 +20,7 @@ type AppConfig struct {
 	AppConfigPath        string
 	AppPidPath           string
 	Lang                 string       `yaml:"lang"`
+	LocalesDir           string       `yaml:"locales_dir"` // translations of bot messages, one JSON file per language
 	HTTPPort             string       `yaml:"http_port"`
 	TracksDir            string       `yaml:"tracks_dir"`
 	DBFile               string       `yaml:"db_file"`
@@ -32,8 +34,19 @@ type AppConfig struct {
 	AppName              string       `yaml:"app_name"`
 	LogFile              string       `yaml:"log_file"`
 	LogLevel             string       `yaml:"log_level"`
+	Admins               []string     `yaml:"admins"`       // NINJAM user names having the admin role
+	DefaultRole          string       `yaml:"default_role"` // role of NINJAM users without one: guest, musician, dj or admin
 	Server               NinJamServer `yaml:"server"`
 	Player               Player       `yaml:"player"`
+	Solo                 Solo         `yaml:"solo"`
+	Idle                 Idle         `yaml:"idle"`
+	RateLimit            RateLimit    `yaml:"rate_limit"`
+	Voting               Voting       `yaml:"voting"`
+	Loops                Loops        `yaml:"loops"`
+	Detection            Detection    `yaml:"detection"`
+	Sync                 Sync         `yaml:"sync"`
+	Watch                Watch        `yaml:"watch"`
+	ID3                  ID3          `yaml:"id3"`
 }
 
 type NinJamServer struct {
@@ -50,6 +63,59 @@ type Player struct {
 	Args    string `yaml:"args"`
 }
 
+// Solo is the default solo length policy of the queue: slots, seconds, bars, intervals or split
+type Solo struct {
+	Policy string `yaml:"policy"`
+	Value  uint   `yaml:"value"`
+}
+
+// Idle configures detection of queue members who don't play during their turn
+type Idle struct {
+	SilentIntervals uint `yaml:"silent_intervals"` // silent intervals before the turn is passed on, 0 disables detection
+	MaxTurns        uint `yaml:"max_turns"`        // idle turns in a row before the user is removed from queue, 0 never removes
+}
+
+// RateLimit limits chat commands per minute, zero values mean defaults
+type RateLimit struct {
+	TrackCommands uint `yaml:"track_commands"` // commands starting or stopping tracks per user
+	QueueCommands uint `yaml:"queue_commands"` // queue commands per user
+	InfoCommands  uint `yaml:"info_commands"`  // other commands per user
+	TrackChanges  uint `yaml:"track_changes"`  // track changes for everybody together
+}
+
+// Voting configures voteskip and votestop chat commands
+type Voting struct {
+	Share  float64 `yaml:"share"`  // share of room users who must vote, 0.5 by default
+	Window uint    `yaml:"window"` // seconds a vote is valid, 120 by default
+}
+
+// Loops configures loop suggestions for tracks synced without loop points
+type Loops struct {
+	AutoApply bool    `yaml:"auto_apply"` // apply suggestions during sync, otherwise they wait for approval in API
+	MinScore  float64 `yaml:"min_score"`  // lowest similarity from -1 to 1 applied automatically, 0.9 by default
+}
+
+// Detection configures review of BPM and key detected by sync for tracks without them in tags
+type Detection struct {
+	MinConfidence float64 `yaml:"min_confidence"` // detected values with lower confidence need review, 0.5 by default
+}
+
+// Sync configures the library sync started through API
+type Sync struct {
+	Workers int `yaml:"workers"` // files analysed at once, a file per CPU by default
+}
+
+// Watch configures the watcher keeping DB in sync with the tracks directory while the bot runs
+type Watch struct {
+	Enabled bool `yaml:"enabled"`
+	Rescan  uint `yaml:"rescan"` // seconds between full rescans, 600 by default
+}
+
+// ID3 configures tags written to MP3 files when tracks are edited
+type ID3 struct {
+	FrameVersion uint16 `yaml:"frame_version"` // version of GuitarJam frames: 2 or 3, 3 by default
+}
+
 var appConfig *AppConfig
 
 func init() {
@@ -63,7 +129,10 @@ func init() {
 	strPtr := flag.String("c", "config.yaml", "config path")
 	strPtrPid := flag.String("p", "", "pid path")
 
-	flag.Parse()
+	// флаги тестового бинарника -test.* разбирает пакет testing, они объявляются позже init
+	if !testBinary(os.Args) {
+		flag.Parse()
+	}
 
 	appConfig.AppPidPath = *strPtrPid
 
@@ -83,6 +152,7 @@ func init() {
 	appConfig.DaemonMode = false
 	appConfig.AppName = "ninjam-dj-bot"
 	appConfig.LogFile = "stdout"
+	appConfig.LocalesDir = "locales"
 
 	content, err := ioutil.ReadFile(appConfig.AppConfigPath)
 	if err != nil {
@@ -155,3 +225,25 @@ func FileExists(name string) bool {
 func Get() *AppConfig {
 	return appConfig
 }
+
+// LocalesPath returns the directory of message catalogues, a relative locales_dir is relative to the app directory
+func (c *AppConfig) LocalesPath() string {
+	if filepath.IsAbs(c.LocalesDir) {
+		return c.LocalesDir
+	}
+	return filepath.Join(c.AppPath, c.LocalesDir)
+}
+
+// testBinary reports whether the process is a test binary built by go test
+func testBinary(args []string) bool {
+	if strings.HasSuffix(strings.TrimSuffix(args[0], ".exe"), ".test") {
+		return true
+	}
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "-test.") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -34,22 +34,30 @@ type JamBot interface {
 }
 
 type JamPlayer struct {
-	track        *tracks.Track
-	tracksPath   string
-	source       io.Reader
-	sampleRate   int
-	bpm          uint
-	bpi          uint
-	repeats      uint
-	ninjamBot    JamBot
-	stop         chan bool
-	playing      bool
-	hostConfig   *lv2hostconfig.LV2HostConfig
-	speechConfig *lv2hostconfig.LV2HostConfig
-	onStopFunc   func()
-	onStartFunc  func()
-	bpmBPIOnSet  bool // set if bot called set bpm/bpi to ignore OnServerConfigChange callback
-	voiceMtx     *sync.Mutex
+	track          *tracks.Track
+	tracksPath     string
+	source         io.Reader
+	sampleRate     int
+	bpm            uint
+	bpi            uint
+	repeats        uint
+	ninjamBot      JamBot
+	stop           chan bool
+	playing        bool
+	hostConfig     *lv2hostconfig.LV2HostConfig // guarded by hostConfigMtx, the loudness of the loaded track is in its ValueMap
+	speechConfig   *lv2hostconfig.LV2HostConfig
+	onStopFunc     func()
+	onStartFunc    func()
+	onIntervalFunc func(elapsed time.Duration, repeats uint, looped bool)
+	bpmBPIOnSet    bool // set if bot called set bpm/bpi to ignore OnServerConfigChange callback
+	voiceMtx       *sync.Mutex
+
+	stateMtx sync.Mutex    // guards repeats, elapsed and resume which API clients read while the track plays
+	elapsed  time.Duration // playing time of the track without pauses
+	resume   chan struct{} // not nil while paused, closed on resume
+
+	previewMtx    sync.Mutex // previews are rendered one at a time
+	hostConfigMtx sync.Mutex
 }
 
 type AudioInterval struct {
@@ -73,6 +81,12 @@ func (jp *JamPlayer) SetOnStop(f func()) {
 	jp.onStopFunc = f
 }
 
+// SetOnInterval sets the function called after every interval of the track is sent,
+// looped is set if the interval has started a new repeat of the loop
+func (jp *JamPlayer) SetOnInterval(f func(elapsed time.Duration, repeats uint, looped bool)) {
+	jp.onIntervalFunc = f
+}
+
 func (jp *JamPlayer) onStart() {
 	if jp.onStartFunc != nil {
 		jp.onStartFunc()
@@ -93,6 +107,11 @@ func (jp *JamPlayer) Track() *tracks.Track {
 	return jp.track
 }
 
+// Tempo returns BPM and BPI the current track is played with
+func (jp *JamPlayer) Tempo() (bpm, bpi uint) {
+	return jp.bpm, jp.bpi
+}
+
 func (jp *JamPlayer) LoadTrack(track *tracks.Track) error {
 	jp.track = track
 	filePath := track.FilePath
@@ -114,19 +133,127 @@ func (jp *JamPlayer) LoadTrack(track *tracks.Track) error {
 		logrus.Error(err)
 		return err
 	}
-	jp.hostConfig.ValueMap["integrated"] = track.Integrated
-	jp.hostConfig.ValueMap["range"] = track.Range
-	jp.hostConfig.ValueMap["peak"] = track.Peak
-	jp.hostConfig.ValueMap["shortterm"] = track.Shortterm
-	jp.hostConfig.ValueMap["momentary"] = track.Momentary
+	jp.hostConfigMtx.Lock()
+	setLoudness(jp.hostConfig, track)
+	jp.hostConfigMtx.Unlock()
 
 	return nil
 }
 
+// setLoudness sets loudness of the track used by expressions of the LV2 host config,
+// govaluate does arithmetic on float64 only
+func setLoudness(config *lv2hostconfig.LV2HostConfig, track *tracks.Track) {
+	// ReadFile кладёт уровень reference как float32
+	if reference, ok := config.ValueMap["reference"].(float32); ok {
+		config.ValueMap["reference"] = float64(reference)
+	}
+	config.ValueMap["integrated"] = float64(track.Integrated)
+	config.ValueMap["range"] = float64(track.Range)
+	config.ValueMap["peak"] = float64(track.Peak)
+	config.ValueMap["shortterm"] = float64(track.Shortterm)
+	config.ValueMap["momentary"] = float64(track.Momentary)
+}
+
+// trackHostConfig returns a copy of the LV2 host config with loudness of the track,
+// the config of the loaded track isn't changed
+func (jp *JamPlayer) trackHostConfig(track *tracks.Track) (*lv2hostconfig.LV2HostConfig, error) {
+	if jp.hostConfig == nil {
+		return nil, fmt.Errorf("hostConfig not found")
+	}
+
+	jp.hostConfigMtx.Lock()
+	defer jp.hostConfigMtx.Unlock()
+
+	config := lv2hostconfig.NewLV2HostConfig()
+	for _, plugin := range jp.hostConfig.Plugins {
+		pc := lv2hostconfig.NewLV2PluginConfig()
+		pc.PluginURI = plugin.PluginURI
+		for param, value := range plugin.DataFmt {
+			pc.DataFmt[param] = value
+		}
+		config.Plugins = append(config.Plugins, pc)
+	}
+	for name, value := range jp.hostConfig.ValueMap {
+		config.ValueMap[name] = value
+	}
+	for name, f := range jp.hostConfig.FunctionMap {
+		config.FunctionMap[name] = f
+	}
+	setLoudness(config, track)
+
+	return config, nil
+}
+
 func (jp *JamPlayer) SetRepeats(repeats uint) {
+	jp.stateMtx.Lock()
+	defer jp.stateMtx.Unlock()
+
 	jp.repeats = repeats
 }
 
+// Repeats returns loop repeats left to play
+func (jp *JamPlayer) Repeats() uint {
+	jp.stateMtx.Lock()
+	defer jp.stateMtx.Unlock()
+
+	return jp.repeats
+}
+
+// Elapsed returns the time the track has been playing, pauses excluded
+func (jp *JamPlayer) Elapsed() time.Duration {
+	jp.stateMtx.Lock()
+	defer jp.stateMtx.Unlock()
+
+	return jp.elapsed
+}
+
+// Paused is true if the track is paused
+func (jp *JamPlayer) Paused() bool {
+	jp.stateMtx.Lock()
+	defer jp.stateMtx.Unlock()
+
+	return jp.resume != nil
+}
+
+// Pause stops sending intervals until Resume, the position in the track is kept
+func (jp *JamPlayer) Pause() {
+	jp.stateMtx.Lock()
+	defer jp.stateMtx.Unlock()
+
+	if jp.playing && jp.resume == nil {
+		jp.resume = make(chan struct{})
+	}
+}
+
+// Resume continues playing the paused track
+func (jp *JamPlayer) Resume() {
+	jp.stateMtx.Lock()
+	defer jp.stateMtx.Unlock()
+
+	if jp.resume != nil {
+		close(jp.resume)
+		jp.resume = nil
+	}
+}
+
+// waitResume blocks while the player is paused, it returns false if the player is stopped meanwhile
+func (jp *JamPlayer) waitResume() bool {
+	jp.stateMtx.Lock()
+	resume := jp.resume
+	jp.stateMtx.Unlock()
+
+	if resume == nil {
+		return true
+	}
+
+	select {
+	case <-resume:
+		return true
+	case <-jp.stop:
+		return false
+	}
+}
+
 func (jp *JamPlayer) setMP3Source(source string) error {
 	jp.Stop() // stop before set new source
 
@@ -179,6 +306,10 @@ func (jp *JamPlayer) Start() error {
 	}
 
 	jp.playing = true
+	jp.stateMtx.Lock()
+	jp.elapsed = 0
+	jp.resume = nil
+	jp.stateMtx.Unlock()
 
 	// default values
 	var bpm, bpi uint = 100, 16
@@ -208,7 +339,7 @@ func (jp *JamPlayer) Start() error {
 
 	// не позволяем повторы если нет метки конца цикла либо она меньше/равна метке начала цикла
 	if loopEndPos <= loopStartPos {
-		jp.repeats = 0
+		jp.SetRepeats(0)
 	}
 
 	samplesBuffer := make([][]float32, 2)
@@ -226,7 +357,9 @@ func (jp *JamPlayer) Start() error {
 		intervalsReady := 0
 
 		// initialize LV2 plugins
+		jp.hostConfigMtx.Lock()
 		host, err := jp.prepareLV2Host(float64(jp.sampleRate), jp.hostConfig)
+		jp.hostConfigMtx.Unlock()
 		if err != nil {
 			errChan <- err
 			return
@@ -244,37 +377,15 @@ func (jp *JamPlayer) Start() error {
 				errChan <- err
 				return
 			}
-			buf := audio.Float32{}.Make(intervalSamplesChannels, intervalSamplesChannels)
-			rs, err := toReadSeeker(source, intervalSamplesChannels)
-			if err != nil && err != io.EOF && err.Error() != "end of stream" {
-				err := fmt.Errorf("source.Read error: %s", err)
-				errChan <- err
-				return
-			}
-
-			var bufLen int
-			bufLen, err = rs.Read(buf)
-			if err != nil && err != io.EOF && err.Error() != "end of stream" {
-				err := fmt.Errorf("source.Read error: %s", err)
-				errChan <- err
-				return
+			deinterleavedSamples, err := readInterval(source, host, intervalSamplesChannels)
+			if err == io.EOF {
+				err = fmt.Errorf("error: bufLen == 0")
 			}
-			if bufLen == 0 {
-				//bufferFull = true
-				err := fmt.Errorf("error: bufLen == 0")
-				errChan <- err
-				return
-			}
-
-			deinterleavedSamples, err := ninjamencoder.DeinterleaveSamples(buf.(audio.Float32)[:bufLen], channels)
 			if err != nil {
-				err := fmt.Errorf("DeinterleaveSamples error: %s", err)
 				errChan <- err
 				return
 			}
 
-			lv2host.ProcessBuffer(host, deinterleavedSamples[0], deinterleavedSamples[1], uint32(len(deinterleavedSamples[0])))
-
 			for i := 0; i < channels; i++ {
 				samplesBuffer[i] = append(samplesBuffer[i], deinterleavedSamples[i]...)
 			}
@@ -317,30 +428,20 @@ func (jp *JamPlayer) Start() error {
 
 		play := true
 		currentPos := 0
+		looped := false
 
 		for play {
 			logrus.Debugf("Current pos: %d", currentPos)
-			deinterleavedSamples := make([][]float32, 2)
-			endPos := currentPos + intervalSamples - 1
-
-			if endPos > len(samplesBuffer[0])-1 {
-				endPos = len(samplesBuffer[0]) - 1 // это позиция в слайсе, потому -1
-				play = false                       // дошли до конца - завершаем
-			}
-
-			if endPos >= loopEndPos && jp.repeats > 0 {
-				play = true // если ранее получили флаг остановки - значит снимем его, мы ушли в очередной цикл
-				var loops uint
-				deinterleavedSamples, currentPos, loops = loop(samplesBuffer, currentPos, loopStartPos, loopEndPos, intervalSamples, channels)
+			deinterleavedSamples, nextPos, loops, last := cutInterval(samplesBuffer, currentPos, loopStartPos, loopEndPos, intervalSamples, jp.Repeats())
+			currentPos = nextPos
+			play = !last
+			if loops > 0 {
+				looped = true
 
+				jp.stateMtx.Lock()
 				jp.repeats -= loops
 				logrus.Debugf("repeats left: %d", jp.repeats)
-			} else {
-				for i := 0; i < channels; i++ {
-					deinterleavedSamples[i] = samplesBuffer[i][currentPos : endPos+1]
-				}
-
-				currentPos = endPos + 1
+				jp.stateMtx.Unlock()
 			}
 
 			data, err := oggEncoder.EncodeNinjamInterval(deinterleavedSamples)
@@ -357,6 +458,11 @@ func (jp *JamPlayer) Start() error {
 				ticker.Stop()
 				return
 			}
+			// на паузе интервалы не отправляем, позиция в треке сохраняется
+			if !jp.waitResume() {
+				ticker.Stop()
+				return
+			}
 
 			interval := AudioInterval{
 				GUID:         guid,
@@ -379,6 +485,16 @@ func (jp *JamPlayer) Start() error {
 
 				jp.ninjamBot.IntervalWrite(interval.GUID, intervalData, interval.Flags)
 			}
+
+			jp.stateMtx.Lock()
+			jp.elapsed += time.Duration(intervalTime)
+			elapsed, repeats := jp.elapsed, jp.repeats
+			jp.stateMtx.Unlock()
+
+			if jp.onIntervalFunc != nil {
+				jp.onIntervalFunc(elapsed, repeats, looped)
+			}
+			looped = false
 		}
 	}()
 
@@ -392,6 +508,10 @@ func (jp *JamPlayer) Stop() {
 	for jp.playing {
 		time.Sleep(time.Millisecond * 500)
 	}
+
+	jp.stateMtx.Lock()
+	jp.resume = nil
+	jp.stateMtx.Unlock()
 }
 
 func (ai *AudioInterval) next() (data []byte, hasNext bool) {
@@ -407,6 +527,56 @@ func (ai *AudioInterval) next() (data []byte, hasNext bool) {
 	return
 }
 
+// readInterval decodes samples of the interval from source and processes them by LV2 plugins,
+// io.EOF is returned at the end of source
+func readInterval(source io.Reader, host *lv2host.CLV2Host, samples int) ([][]float32, error) {
+	buf := audio.Float32{}.Make(samples, samples)
+	rs, err := toReadSeeker(source, samples)
+	if err != nil && err != io.EOF && err.Error() != "end of stream" {
+		return nil, fmt.Errorf("source.Read error: %s", err)
+	}
+
+	bufLen, err := rs.Read(buf)
+	if err != nil && err != io.EOF && err.Error() != "end of stream" {
+		return nil, fmt.Errorf("source.Read error: %s", err)
+	}
+	if bufLen == 0 {
+		return nil, io.EOF
+	}
+
+	deinterleavedSamples, err := ninjamencoder.DeinterleaveSamples(buf.(audio.Float32)[:bufLen], channels)
+	if err != nil {
+		return nil, fmt.Errorf("DeinterleaveSamples error: %s", err)
+	}
+
+	lv2host.ProcessBuffer(host, deinterleavedSamples[0], deinterleavedSamples[1], uint32(len(deinterleavedSamples[0])))
+
+	return deinterleavedSamples, nil
+}
+
+// cutInterval cuts the interval of length samples starting at pos, while repeats are left the interval
+// crossing loopEnd continues from loopStart. last is set if the interval is the last one of the track.
+func cutInterval(s [][]float32, pos, loopStart, loopEnd, length int, repeats uint) (res [][]float32, next int, loops uint, last bool) {
+	end := pos + length - 1
+	if end > len(s[0])-1 {
+		end = len(s[0]) - 1 // это позиция в слайсе, потому -1
+		last = true         // дошли до конца - завершаем
+	}
+
+	if end >= loopEnd && repeats > 0 {
+		// ушли в очередной цикл - это не конец трека
+		res, next, loops = loop(s, pos, loopStart, loopEnd, length, channels)
+		return res, next, loops, false
+	}
+
+	res = make([][]float32, channels)
+	for i := 0; i < channels; i++ {
+		res[i] = s[i][pos : end+1]
+	}
+
+	return res, end + 1, 0, last
+}
+
 func toReadSeeker(reader io.Reader, samples int) (res audio.ReadSeeker, err error) {
 	buf := audio.NewBuffer(make(audio.Float32, 0, samples))
 	res = buf
@@ -609,7 +779,7 @@ func (jp *JamPlayer) playVoice(b []byte) (err error) {
 func (jp *JamPlayer) prepareLV2Host(sampleRate float64, config *lv2hostconfig.LV2HostConfig) (*lv2host.CLV2Host, error) {
 	err := config.Evaluate()
 	if err != nil {
-		logrus.Fatal(err)
+		return nil, fmt.Errorf("LV2 host config: %s", err)
 	}
 
 	// initialize LV2 plugins
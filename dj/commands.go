@@ -0,0 +1,534 @@
+package dj
+
+import (
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/auth"
+	"github.com/ayvan/ninjam-dj-bot/lib"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/message"
+	"strings"
+	"time"
+)
+
+// commandHandler runs the command and returns the reply printed by p, the printer of the user language for private replies
+type commandHandler func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string
+
+// chatCommand describes a chat command: how to call it, who may call it and what it does
+type chatCommand struct {
+	name        string
+	aliases     []string
+	args        []lib.ArgSpec
+	role        auth.Role    // minimal role to run the command
+	argsRole    auth.Role    // minimal role to run the command with arguments if it is higher, e.g. to change the queue mode
+	class       commandClass // rate limit class
+	trackChange bool         // the command changes the track, such commands are limited for everybody together
+	private     bool         // the reply is long or personal, it is sent to the user only in the user language
+	help        string       // help message, translated
+	handler     commandHandler
+}
+
+// requiredRole returns the minimal role to run the command, withArgs is true if arguments are given
+func (c *chatCommand) requiredRole(withArgs bool) auth.Role {
+	if withArgs && c.argsRole > c.role {
+		return c.argsRole
+	}
+	return c.role
+}
+
+// usage returns the command with its arguments, e.g. qmove <user> <position>
+func (c *chatCommand) usage() string {
+	res := []string{c.name}
+	for _, arg := range c.args {
+		res = append(res, arg.String())
+	}
+	return strings.Join(res, " ")
+}
+
+// commandRegistry keeps chat commands in order of registration
+type commandRegistry struct {
+	commands []*chatCommand
+	byName   map[string]*chatCommand
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{byName: make(map[string]*chatCommand)}
+}
+
+// register adds the command, a name or alias used twice is a programming error
+func (r *commandRegistry) register(c *chatCommand) {
+	if c.role == auth.RoleUnknown {
+		c.role = auth.RoleGuest
+	}
+	for _, name := range append([]string{c.name}, c.aliases...) {
+		name = strings.ToLower(name)
+		if _, ok := r.byName[name]; ok {
+			panic(fmt.Sprintf("chat command %s is registered twice", name))
+		}
+		r.byName[name] = c
+	}
+	r.commands = append(r.commands, c)
+}
+
+// lookup finds the command by name or alias
+func (r *commandRegistry) lookup(name string) *chatCommand {
+	return r.byName[strings.ToLower(name)]
+}
+
+var commands = newCommandRegistry()
+
+func init() {
+	commands.register(&chatCommand{
+		name: "random",
+		args: []lib.ArgSpec{
+			{Name: "key", Kind: lib.ArgKey, Optional: true},
+			{Name: "bpm=min-max", Kind: lib.ArgBPM, Optional: true},
+			{Name: "tags", Kind: lib.ArgTags, Optional: true},
+			{Name: "length", Kind: lib.ArgDuration, Optional: true},
+		},
+		role:        auth.RoleDJ,
+		class:       commandClassTrack,
+		trackChange: true,
+		help:        helpRandom,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			command := lib.JamCommand{
+				Key:      args.Key,
+				Mode:     args.Mode,
+				Duration: args.Length.Duration,
+				Loops:    args.Length.Loops,
+				Bars:     args.Length.Bars,
+				BPMMin:   args.BPMMin,
+				BPMMax:   args.BPMMax,
+			}
+			if len(args.Tags) > 0 {
+				tagIDs, ok := jm.tagIDs(args.Tags)
+				if !ok {
+					return p.Sprintf(messageCantStartRandomTrack)
+				}
+				command.Tags = tagIDs
+			}
+			return jm.PlayRandom(command)
+		},
+	})
+	commands.register(&chatCommand{
+		name:        "track",
+		args:        []lib.ArgSpec{{Name: "id", Kind: lib.ArgID}},
+		role:        auth.RoleDJ,
+		class:       commandClassTrack,
+		trackChange: true,
+		help:        helpTrack,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.StartTrack(args.ID)
+		},
+	})
+	commands.register(&chatCommand{
+		name:        "playlist",
+		aliases:     []string{"list"},
+		args:        []lib.ArgSpec{{Name: "id", Kind: lib.ArgID}},
+		role:        auth.RoleDJ,
+		class:       commandClassTrack,
+		trackChange: true,
+		help:        helpPlaylist,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.StartPlaylist(args.ID)
+		},
+	})
+	commands.register(&chatCommand{
+		name:  "stop",
+		role:  auth.RoleDJ,
+		class: commandClassTrack,
+		help:  helpStop,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Stop()
+		},
+	})
+	commands.register(&chatCommand{
+		name:        "play",
+		aliases:     []string{"start"},
+		role:        auth.RoleDJ,
+		class:       commandClassTrack,
+		trackChange: true,
+		help:        helpPlay,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Start()
+		},
+	})
+	commands.register(&chatCommand{
+		name:        "next",
+		role:        auth.RoleDJ,
+		class:       commandClassTrack,
+		trackChange: true,
+		help:        helpNext,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Next()
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "playing",
+		aliases: []string{"current", "now"},
+		help:    helpPlaying,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Playing()
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "help",
+		args:    []lib.ArgSpec{{Name: "command", Kind: lib.ArgWord, Optional: true}},
+		private: true,
+		help:    helpHelp,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			if len(args.Words) > 0 {
+				return jm.CommandHelp(p, args.Words[0])
+			}
+			return jm.Help(p)
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "qstart",
+		aliases: []string{"qs"},
+		role:    auth.RoleDJ,
+		class:   commandClassQueue,
+		help:    helpQStart,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueStart()
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "qfinish",
+		aliases: []string{"qf"},
+		role:    auth.RoleDJ,
+		class:   commandClassQueue,
+		help:    helpQFinish,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueFinish()
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "qnext",
+		aliases: []string{"qn"},
+		role:    auth.RoleDJ,
+		class:   commandClassQueue,
+		help:    helpQNext,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			jm.queueManager.Next()
+			return ""
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "qleave",
+		aliases: []string{"ql"},
+		role:    auth.RoleMusician,
+		class:   commandClassQueue,
+		help:    helpQLeave,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueLeave(userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "qjoin",
+		aliases: []string{"qj"},
+		role:    auth.RoleMusician,
+		class:   commandClassQueue,
+		help:    helpQJoin,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueJoin(userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name:  "qskip",
+		role:  auth.RoleMusician,
+		class: commandClassQueue,
+		help:  helpQSkip,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueSkip(userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name:  "qmove",
+		args:  []lib.ArgSpec{{Name: "user", Kind: lib.ArgUser}, {Name: "position", Kind: lib.ArgNumber}},
+		role:  auth.RoleAdmin,
+		class: commandClassQueue,
+		help:  helpQMove,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueMove(args.Users[0], args.Numbers[0])
+		},
+	})
+	commands.register(&chatCommand{
+		name:  "qswap",
+		args:  []lib.ArgSpec{{Name: "user", Kind: lib.ArgUser}, {Name: "user", Kind: lib.ArgUser}},
+		role:  auth.RoleAdmin,
+		class: commandClassQueue,
+		help:  helpQSwap,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueSwap(args.Users[0], args.Users[1])
+		},
+	})
+	commands.register(&chatCommand{
+		name:  "qfirst",
+		args:  []lib.ArgSpec{{Name: "user", Kind: lib.ArgUser}},
+		role:  auth.RoleAdmin,
+		class: commandClassQueue,
+		help:  helpQFirst,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueFirst(args.Users[0])
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "qstats",
+		private: true,
+		help:    helpQStats,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.QueueStats(p)
+		},
+	})
+	commands.register(&chatCommand{
+		name: "qmode",
+		args: []lib.ArgSpec{{Name: "mode", Kind: lib.ArgText, Optional: true}},
+		// посмотреть режим очереди может любой, поменять - только админ
+		argsRole: auth.RoleAdmin,
+		class:    commandClassQueue,
+		help:     helpQMode,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			if args.Text == "" {
+				return p.Sprintf(messageQueueMode, jm.queueManager.Mode())
+			}
+			return jm.QueueMode(strings.Fields(args.Text))
+		},
+	})
+	commands.register(&chatCommand{
+		name:  "voteskip",
+		role:  auth.RoleMusician,
+		class: commandClassTrack,
+		help:  helpVoteSkip,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Vote(VoteSkip, userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name:  "votestop",
+		role:  auth.RoleMusician,
+		class: commandClassTrack,
+		help:  helpVoteStop,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Vote(VoteStop, userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name: "votes",
+		help: helpVotes,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.VotesMessage()
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "request",
+		aliases: []string{"req"},
+		args:    []lib.ArgSpec{{Name: "id or words", Kind: lib.ArgText}},
+		role:    auth.RoleMusician,
+		class:   commandClassTrack,
+		help:    helpRequest,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Request(args.Text, userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name: "requests",
+		help: helpRequests,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.RequestsMessage()
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "search",
+		aliases: []string{"find"},
+		args:    []lib.ArgSpec{{Name: "words", Kind: lib.ArgText}},
+		private: true,
+		help:    helpSearch,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Search(p, strings.Fields(args.Text), userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name:        "pick",
+		args:        []lib.ArgSpec{{Name: "number", Kind: lib.ArgNumber}},
+		role:        auth.RoleDJ,
+		class:       commandClassTrack,
+		trackChange: true,
+		help:        helpPick,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Pick(args.Numbers[0], userName)
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "playlists",
+		aliases: []string{"lists"},
+		args:    []lib.ArgSpec{{Name: "page", Kind: lib.ArgNumber, Optional: true}},
+		private: true,
+		help:    helpPlaylists,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			if len(args.Numbers) > 0 {
+				return jm.PlaylistsMessage(p, args.Numbers[0])
+			}
+			return jm.PlaylistsMessage(p, 1)
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "info",
+		args:    []lib.ArgSpec{{Name: "id | playlist id", Kind: lib.ArgText}},
+		private: true,
+		help:    helpInfo,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			return jm.Info(p, strings.Fields(args.Text))
+		},
+	})
+	commands.register(&chatCommand{
+		name:    "lang",
+		args:    []lib.ArgSpec{{Name: "language", Kind: lib.ArgWord, Optional: true}},
+		private: true,
+		help:    helpLang,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			if len(args.Words) > 0 {
+				return jm.SetLanguage(userName, args.Words[0])
+			}
+			return p.Sprintf(messageLanguage, jm.language(userName), strings.Join(Languages(), ", "))
+		},
+	})
+	commands.register(&chatCommand{
+		name: "vt",
+		args: []lib.ArgSpec{{Name: "text", Kind: lib.ArgText}},
+		role: auth.RoleAdmin,
+		help: helpVoiceTest,
+		handler: func(jm *JamManager, p *message.Printer, userName string, args lib.Args) string {
+			jm.TextToSpeech(ttsLanguage(jm.language(userName)), args.Text)
+			return ""
+		},
+	})
+}
+
+// Command runs the chat command of the user
+func (jm *JamManager) Command(chatCommand string, userName string) string {
+	defer recoverer()
+
+	tokens, err := lib.Tokenize(chatCommand)
+	if err != nil || len(tokens) == 0 {
+		return p.Sprintf(messageUnableToRecognizeCommand)
+	}
+	command := commands.lookup(tokens[0].Text)
+
+	if command == nil {
+		if ok, notice := jm.allowCommand(userName, nil); !ok {
+			return notice
+		}
+		return p.Sprintf(messageUnableToRecognizeCommand)
+	}
+
+	// ошибки вызова касаются только самого пользователя, их тоже отправляем лично
+	userPrinter := jm.replyPrinter(userName)
+	if required := command.requiredRole(len(tokens) > 1); jm.role(userName) < required {
+		return jm.reply(userName, userPrinter.Sprintf(messagePermissionDenied, required), true)
+	}
+
+	args, err := lib.ParseArgs(command.args, tokens[1:])
+	if err != nil {
+		return jm.reply(userName, jm.argErrorMessage(userPrinter, command, err), true)
+	}
+
+	// лимиты расходуем только командами, которые будут выполнены: запрещённые и неверные команды
+	// отвечают лично пользователю и не должны тратить общий лимит смены треков
+	if ok, notice := jm.allowCommand(userName, command); !ok {
+		return notice
+	}
+
+	return jm.reply(userName, command.handler(jm, userPrinter, userName, args), command.private)
+}
+
+// allowCommand checks the rate limits of the command, command is nil for unknown commands
+func (jm *JamManager) allowCommand(userName string, command *chatCommand) (ok bool, notice string) {
+	if jm.floodGuard == nil {
+		return true, ""
+	}
+	return jm.floodGuard.allow(userName, command, time.Now())
+}
+
+func (jm *JamManager) argErrorMessage(p *message.Printer, command *chatCommand, err error) string {
+	msg := p.Sprintf(messageUnableToRecognizeCommand)
+	if argErr, ok := err.(*lib.ArgError); ok {
+		switch argErr.Reason {
+		case lib.ArgMissing:
+			msg = p.Sprintf(messageArgMissing, argErr.Arg)
+		case lib.ArgBad:
+			msg = p.Sprintf(messageArgBad, argErr.Arg, argErr.Value)
+		case lib.ArgUnexpected:
+			msg = p.Sprintf(messageArgUnexpected, argErr.Value)
+		}
+	} else {
+		logrus.Errorf("chat command %s: %s", command.name, err)
+	}
+
+	return msg + "\n" + p.Sprintf(messageUsage, jm.jamChatBot.UserName(), command.usage())
+}
+
+// Help lists all chat commands
+func (jm *JamManager) Help(p *message.Printer) (msg string) {
+	if jm.jamChatBot == nil {
+		return
+	}
+
+	lines := []string{p.Sprintf(messageHelp)}
+	for _, command := range commands.commands {
+		line := jm.jamChatBot.UserName() + " " + command.usage()
+		if len(command.aliases) > 0 {
+			line += " " + p.Sprintf(messageHelpAliases, strings.Join(command.aliases, ", "))
+		}
+		line += " - " + p.Sprintf(command.help)
+		if command.requiredRole(true) == auth.RoleAdmin {
+			line += " " + p.Sprintf(messageHelpAdminsOnly)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// CommandHelp shows usage, aliases and the required role of the chat command
+func (jm *JamManager) CommandHelp(p *message.Printer, name string) (msg string) {
+	command := commands.lookup(name)
+	if command == nil {
+		return p.Sprintf(messageHelpUnknownCommand, name)
+	}
+
+	msg = jm.jamChatBot.UserName() + " " + command.usage() + " - " + p.Sprintf(command.help)
+	if len(command.aliases) > 0 {
+		msg += "\n" + p.Sprintf(messageHelpAliases, strings.Join(command.aliases, ", "))
+	}
+	msg += "\n" + p.Sprintf(messageHelpRole, command.role)
+	if command.argsRole > command.role {
+		msg += "\n" + p.Sprintf(messageHelpArgsRole, command.argsRole)
+	}
+
+	return
+}
+
+// tagIDs returns IDs of the tags by names, ok is false if some tag doesn't exist
+func (jm *JamManager) tagIDs(names []string) (ids []uint, ok bool) {
+	tags, err := jm.jamDB.Tags()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+
+	for _, name := range names {
+		found := false
+		for _, tag := range tags {
+			if strings.EqualFold(tag.Name, name) {
+				ids = append(ids, tag.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	return ids, true
+}
@@ -0,0 +1,61 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/auth"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCommandRegistry_register(t *testing.T) {
+	r := newCommandRegistry()
+	r.register(&chatCommand{name: "qstart", aliases: []string{"qs"}})
+
+	assert.Equal(t, "qstart", r.lookup("QS").name)
+	assert.Equal(t, auth.RoleGuest, r.lookup("qstart").role)
+	assert.Nil(t, r.lookup("qfinish"))
+	assert.Panics(t, func() {
+		r.register(&chatCommand{name: "qsort", aliases: []string{"qs"}})
+	})
+}
+
+func TestJamManager_Command_args(t *testing.T) {
+	jm := &JamManager{queueManager: NewQueueManager("dj", nil, nil), jamChatBot: &testChatBot{}}
+	jm.SetRoleDB(testRoles{"admin": auth.RoleAdmin})
+
+	assert.Equal(t, p.Sprintf(messageArgMissing, "<position>")+"\n"+p.Sprintf(messageUsage, "dj", "qmove <user> <position>"),
+		jm.Command("qmove Bob", "admin"))
+	assert.Equal(t, p.Sprintf(messageArgBad, "<position>", "first")+"\n"+p.Sprintf(messageUsage, "dj", "qmove <user> <position>"),
+		jm.Command("qmove Bob first", "admin"))
+	assert.Equal(t, p.Sprintf(messageArgUnexpected, "Carol")+"\n"+p.Sprintf(messageUsage, "dj", "qfirst <user>"),
+		jm.Command("qfirst Bob Carol", "admin"))
+	assert.Equal(t, p.Sprintf(messageQueueUserNotInQueue, "Bob"), jm.Command("QMOVE Bob 1", "admin"))
+	assert.Equal(t, p.Sprintf(messageUnableToRecognizeCommand), jm.Command("dance", "admin"))
+}
+
+func TestJamManager_Help(t *testing.T) {
+	jm := &JamManager{jamChatBot: &testChatBot{}}
+
+	lines := strings.Split(jm.Help(p), "\n")
+	assert.Len(t, lines, len(commands.commands)+1)
+	assert.Contains(t, lines, "dj qstart "+p.Sprintf(messageHelpAliases, "qs")+" - "+p.Sprintf(helpQStart))
+	assert.Contains(t, lines, "dj qmove <user> <position> - "+p.Sprintf(helpQMove)+" "+p.Sprintf(messageHelpAdminsOnly))
+
+	assert.Equal(t, "dj qmode <mode...>? - "+p.Sprintf(helpQMode)+"\n"+
+		p.Sprintf(messageHelpRole, auth.RoleGuest)+"\n"+p.Sprintf(messageHelpArgsRole, auth.RoleAdmin),
+		jm.CommandHelp(p, "qmode"))
+	assert.Equal(t, p.Sprintf(messageHelpUnknownCommand, "dance"), jm.CommandHelp(p, "dance"))
+}
+
+func TestJamManager_APICommand_move(t *testing.T) {
+	jm := &JamManager{queueManager: NewQueueManager("dj", nil, nil), jamChatBot: &testChatBot{}}
+
+	_, err := jm.APICommand("move", QueueCommandParams{User: "Bob", Position: 0})
+	if assert.Error(t, err) {
+		assert.Equal(t, "bad queue position 0", err.Error())
+	}
+	_, err = jm.APICommand("move", QueueCommandParams{User: "Bob", Position: 1})
+	if assert.Error(t, err) {
+		assert.Equal(t, p.Sprintf(messageQueueUserNotInQueue, "Bob"), err.Error())
+	}
+}
@@ -0,0 +1,220 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-chatbot/models"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of live bot event sent to API clients
+type EventType string
+
+const (
+	EventState        EventType = "state" // snapshot of the bot state sent first to every new subscriber
+	EventTrackStarted EventType = "track_started"
+	EventTrackStopped EventType = "track_stopped"
+	EventIntervalSent EventType = "interval_sent"
+	EventRepeatsLeft  EventType = "repeats_left"
+	EventQueueChanged EventType = "queue_changed"
+	EventTurnChanged  EventType = "turn_changed"
+	EventAnnouncement EventType = "announcement"
+	EventUserJoined   EventType = "user_joined"
+	EventUserLeft     EventType = "user_left"
+	EventTempoChanged EventType = "tempo_changed"
+)
+
+const defaultEventsBuffer = 64
+
+// Event is a live bot event, Data depends on the type
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type EventType   `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// StateEvent is the data of the state event
+type StateEvent struct {
+	Player PlayerState `json:"player"`
+	Queue  QueueState  `json:"queue"`
+	Users  []string    `json:"users"` // users of the room
+}
+
+// QueueState is the data of queue_changed event
+type QueueState struct {
+	Users   []string  `json:"users"`   // the queue starting with the current soloist
+	Players []string  `json:"players"` // users playing now
+	Mode    QueueMode `json:"mode"`
+	Stopped bool      `json:"stopped"`
+}
+
+// TurnEvent is the data of turn_changed event
+type TurnEvent struct {
+	Players  []string  `json:"players"`
+	StartsAt time.Time `json:"starts_at"`
+	Duration float64   `json:"duration"` // seconds, 0 if the turn lasts till the end of the track
+}
+
+// TrackStoppedEvent is the data of track_stopped event
+type TrackStoppedEvent struct {
+	Track    *tracks.Track `json:"track"`
+	Finished bool          `json:"finished"` // the track has played till the end, false if it was stopped
+}
+
+// IntervalEvent is the data of interval_sent and repeats_left events
+type IntervalEvent struct {
+	Elapsed     float64 `json:"elapsed"` // seconds of the track sent
+	RepeatsLeft uint    `json:"repeats_left"`
+}
+
+// AnnouncementEvent is the data of announcement event, the text queued for the voice channel
+type AnnouncementEvent struct {
+	Language string `json:"language"`
+	Text     string `json:"text"`
+}
+
+// UserEvent is the data of user_joined and user_left events
+type UserEvent struct {
+	Name string `json:"name"`
+}
+
+// TempoEvent is the data of tempo_changed event
+type TempoEvent struct {
+	BPM uint `json:"bpm"`
+	BPI uint `json:"bpi"`
+}
+
+// EventBus delivers events to subscribers, a subscriber which doesn't read its events in time
+// loses them instead of blocking the bot. A nil bus drops all events.
+type EventBus struct {
+	mtx         sync.Mutex
+	lastID      uint64
+	subscribers map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish sends the event to all subscribers
+func (b *EventBus) Publish(eventType EventType, data interface{}) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, Time: time.Now(), Data: data}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			logrus.Debugf("events subscriber is too slow, %s event %d dropped", eventType, event.ID)
+		}
+	}
+}
+
+// Subscribe returns the channel of events buffering up to buffer events and the function to unsubscribe,
+// the channel is closed on unsubscribe. Replay events are received before the published ones.
+func (b *EventBus) Subscribe(buffer int, replay ...Event) (<-chan Event, func()) {
+	return b.subscribe(buffer, func(uint64) []Event { return replay })
+}
+
+// SubscribeState subscribes like Subscribe, the first event is the state event made by the state function
+// under the bus lock, so no event is lost or received before it. The state event has the ID of the last
+// published event.
+func (b *EventBus) SubscribeState(buffer int, state func() interface{}) (<-chan Event, func()) {
+	return b.subscribe(buffer, func(lastID uint64) []Event {
+		return []Event{{ID: lastID, Type: EventState, Time: time.Now(), Data: state()}}
+	})
+}
+
+// subscribe registers the subscriber, the first events are made by the first function under the bus lock
+func (b *EventBus) subscribe(buffer int, first func(lastID uint64) []Event) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = defaultEventsBuffer
+	}
+
+	b.mtx.Lock()
+	replay := first(b.lastID)
+	ch := make(chan Event, buffer+len(replay))
+	for _, event := range replay {
+		ch <- event
+	}
+	b.subscribers[ch] = struct{}{}
+	b.mtx.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mtx.Lock()
+			delete(b.subscribers, ch)
+			b.mtx.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Subscribers returns the number of subscribers
+func (b *EventBus) Subscribers() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return len(b.subscribers)
+}
+
+// Subscribe subscribes to live events of the bot, the first event is the state of the bot at the moment
+func (jm *JamManager) Subscribe() (<-chan Event, func()) {
+	// плеер публикует события под playerMtx, поэтому и здесь он блокируется раньше шины
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.events.SubscribeState(defaultEventsBuffer, func() interface{} { return jm.stateEvent() })
+}
+
+// StateEvent returns the current state of the player, the queue and the room
+func (jm *JamManager) StateEvent() StateEvent {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.stateEvent()
+}
+
+// stateEvent is StateEvent, playerMtx must be held
+func (jm *JamManager) stateEvent() StateEvent {
+	return StateEvent{
+		Player: jm.playerState(),
+		Queue:  jm.queueManager.State(),
+		Users:  jm.jamChatBot.Users(),
+	}
+}
+
+// speak queues the text for the voice channel
+func (jm *JamManager) speak(lang, text string) {
+	jm.events.Publish(EventAnnouncement, AnnouncementEvent{Language: lang, Text: text})
+	if jm.jamPlayer != nil {
+		jm.jamPlayer.PlayText(lang, text)
+	}
+}
+
+// onUserinfoChange tells subscribers that the user joined or left the room and updates the queue
+func (jm *JamManager) onUserinfoChange(user models.UserInfo) {
+	if user.Active == 0x1 {
+		jm.events.Publish(EventUserJoined, UserEvent{Name: string(user.Name)})
+	} else {
+		jm.events.Publish(EventUserLeft, UserEvent{Name: string(user.Name)})
+	}
+	jm.queueManager.OnUserinfoChange(user)
+}
+
+// onInterval is called when the player has sent an interval of the track
+func (jm *JamManager) onInterval(elapsed time.Duration, repeats uint, looped bool) {
+	data := IntervalEvent{Elapsed: elapsed.Seconds(), RepeatsLeft: repeats}
+	jm.events.Publish(EventIntervalSent, data)
+	if looped {
+		jm.events.Publish(EventRepeatsLeft, data)
+	}
+}
@@ -0,0 +1,125 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-chatbot/models"
+	"github.com/ayvan/ninjam-dj-bot/lib"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(EventTempoChanged, TempoEvent{BPM: 100, BPI: 16}) // никто не подписан
+
+	replay := Event{Type: EventState}
+	events, cancel := bus.Subscribe(2, replay)
+	slow, cancelSlow := bus.Subscribe(1)
+	assert.Equal(t, 2, bus.Subscribers())
+
+	bus.Publish(EventUserJoined, UserEvent{Name: "test1"})
+	bus.Publish(EventUserLeft, UserEvent{Name: "test1"})
+
+	assert.Equal(t, replay, <-events)
+	event := <-events
+	assert.Equal(t, EventUserJoined, event.Type)
+	assert.Equal(t, uint64(2), event.ID)
+	assert.Equal(t, UserEvent{Name: "test1"}, event.Data)
+	assert.Equal(t, EventUserLeft, (<-events).Type)
+
+	// медленный подписчик теряет события, но не блокирует остальных
+	assert.Equal(t, EventUserJoined, (<-slow).Type)
+	assert.Len(t, slow, 0)
+
+	cancel()
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+	cancelSlow()
+	assert.Equal(t, 0, bus.Subscribers())
+
+	var nilBus *EventBus
+	nilBus.Publish(EventUserJoined, nil)
+}
+
+func TestEventBus_SubscribeState(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(EventTempoChanged, TempoEvent{BPM: 100, BPI: 16})
+
+	events, cancel := bus.SubscribeState(10, func() interface{} {
+		// событие, опубликованное во время снимка состояния, приходит после него
+		go bus.Publish(EventUserJoined, UserEvent{Name: "test1"})
+		time.Sleep(time.Millisecond * 10)
+		return "state"
+	})
+	defer cancel()
+
+	event := <-events
+	assert.Equal(t, EventState, event.Type)
+	assert.Equal(t, uint64(1), event.ID)
+	assert.Equal(t, "state", event.Data)
+
+	select {
+	case event = <-events:
+		assert.Equal(t, EventUserJoined, event.Type)
+		assert.Equal(t, uint64(2), event.ID)
+	case <-time.After(time.Second):
+		assert.Fail(t, "event published during the snapshot is lost")
+	}
+}
+
+func TestQueueManager_events(t *testing.T) {
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(10)
+	defer cancel()
+
+	qm := NewQueueManager("dj", func(string) {}, func(string) {})
+	defer qm.Close()
+	qm.SetEvents(bus)
+
+	qm.Add("test1")
+	event := <-events
+	assert.Equal(t, EventQueueChanged, event.Type)
+	assert.Equal(t, []string{"test1"}, event.Data.(QueueState).Users)
+	assert.True(t, event.Data.(QueueState).Stopped)
+
+	// ничего не изменилось - нет событий
+	qm.Add("test1")
+	assert.Len(t, events, 0)
+
+	qm.Add("test2")
+	qm.OnStart(lib.SoloContext{TrackDuration: time.Minute}, lib.SoloPolicy{})
+
+	assert.Equal(t, []string{"test1", "test2"}, (<-events).Data.(QueueState).Users)
+	event = <-events
+	assert.Equal(t, EventQueueChanged, event.Type)
+	assert.False(t, event.Data.(QueueState).Stopped)
+	event = <-events
+	assert.Equal(t, EventTurnChanged, event.Type)
+	assert.Equal(t, []string{"test1"}, event.Data.(TurnEvent).Players)
+}
+
+func TestJamManager_Subscribe(t *testing.T) {
+	bot := &testChatBot{users: []string{"test1"}}
+	jm := &JamManager{jamChatBot: bot, queueManager: NewQueueManager("dj", nil, nil), events: NewEventBus()}
+	defer jm.queueManager.Close()
+	jm.queueManager.SetEvents(jm.events)
+
+	jm.events.Publish(EventTempoChanged, TempoEvent{BPM: 100, BPI: 16})
+	events, cancel := jm.Subscribe()
+	defer cancel()
+
+	event := <-events
+	assert.Equal(t, EventState, event.Type)
+	assert.Equal(t, uint64(1), event.ID)
+	assert.Equal(t, []string{"test1"}, event.Data.(StateEvent).Users)
+	assert.False(t, event.Data.(StateEvent).Player.Playing)
+
+	jm.onUserinfoChange(models.UserInfo{Active: 1, Name: []byte("test1")})
+	assert.Equal(t, UserEvent{Name: "test1"}, (<-events).Data)
+	assert.Equal(t, EventQueueChanged, (<-events).Type)
+
+	jm.onInterval(time.Second*10, 2, true)
+	assert.Equal(t, IntervalEvent{Elapsed: 10, RepeatsLeft: 2}, (<-events).Data)
+	assert.Equal(t, EventRepeatsLeft, (<-events).Type)
+}
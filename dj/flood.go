@@ -0,0 +1,108 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/config"
+	"github.com/ayvan/ninjam-dj-bot/lib"
+	"sync"
+	"time"
+)
+
+type commandClass uint
+
+const (
+	commandClassInfo  commandClass = iota // help, stats and other commands which change nothing
+	commandClassTrack                     // commands which start or stop tracks
+	commandClassQueue                     // queue commands
+)
+
+const (
+	defaultTrackCommands = 3
+	defaultQueueCommands = 10
+	defaultInfoCommands  = 6
+	defaultTrackChanges  = 4
+	floodGuardMaxBuckets = 1000
+)
+
+type floodKey struct {
+	userName string
+	class    commandClass
+}
+
+// floodGuard limits chat commands per user and command class and track changes per minute for everybody,
+// a throttled user is notified once until their commands are allowed again
+type floodGuard struct {
+	mtx          sync.Mutex
+	limits       map[commandClass]uint // commands per minute
+	buckets      map[floodKey]*lib.TokenBucket
+	trackChanges *lib.TokenBucket
+	notified     map[string]bool
+}
+
+func newFloodGuard(conf config.RateLimit) *floodGuard {
+	orDefault := func(v, def uint) uint {
+		if v == 0 {
+			return def
+		}
+		return v
+	}
+
+	return &floodGuard{
+		limits: map[commandClass]uint{
+			commandClassInfo:  orDefault(conf.InfoCommands, defaultInfoCommands),
+			commandClassTrack: orDefault(conf.TrackCommands, defaultTrackCommands),
+			commandClassQueue: orDefault(conf.QueueCommands, defaultQueueCommands),
+		},
+		buckets:      make(map[floodKey]*lib.TokenBucket),
+		trackChanges: lib.NewTokenBucket(orDefault(conf.TrackChanges, defaultTrackChanges), time.Minute),
+		notified:     make(map[string]bool),
+	}
+}
+
+// allow reports whether the user may run the command now, if not notice is the message
+// to reply with, it is empty if the user has been notified already. Unknown commands are nil
+// and limited as info commands
+func (g *floodGuard) allow(userName string, command *chatCommand, now time.Time) (ok bool, notice string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	key := floodKey{userName: userName, class: commandClassInfo}
+	if command != nil {
+		key.class = command.class
+	}
+	bucket, found := g.buckets[key]
+	if !found {
+		g.prune(now)
+		bucket = lib.NewTokenBucket(g.limits[key.class], time.Minute)
+		g.buckets[key] = bucket
+	}
+
+	format := ""
+	switch {
+	case !bucket.Allow(now):
+		format = messageSlowDown
+	case command != nil && command.trackChange && !g.trackChanges.Allow(now):
+		format = messageTrackChangesLimit
+	default:
+		delete(g.notified, userName)
+		return true, ""
+	}
+
+	if g.notified[userName] {
+		return false, ""
+	}
+	g.notified[userName] = true
+
+	return false, p.Sprintf(format, userName)
+}
+
+// prune drops refilled buckets when there are too many of them, mtx must be held
+func (g *floodGuard) prune(now time.Time) {
+	if len(g.buckets) < floodGuardMaxBuckets {
+		return
+	}
+	for key, bucket := range g.buckets {
+		if bucket.Full(now) {
+			delete(g.buckets, key)
+		}
+	}
+}
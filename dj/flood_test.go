@@ -0,0 +1,62 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/auth"
+	"github.com/ayvan/ninjam-dj-bot/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFloodGuard_allow(t *testing.T) {
+	now := time.Date(2020, 5, 1, 20, 0, 0, 0, time.UTC)
+	g := newFloodGuard(config.RateLimit{TrackCommands: 2, InfoCommands: 2, TrackChanges: 3})
+
+	ok, _ := g.allow("bob", commands.lookup("random"), now)
+	assert.True(t, ok)
+	ok, _ = g.allow("bob", commands.lookup("random"), now)
+	assert.True(t, ok)
+
+	// the throttled user is notified once
+	ok, notice := g.allow("bob", commands.lookup("random"), now)
+	assert.False(t, ok)
+	assert.Equal(t, p.Sprintf(messageSlowDown, "bob"), notice)
+	ok, notice = g.allow("bob", commands.lookup("random"), now)
+	assert.False(t, ok)
+	assert.Empty(t, notice)
+
+	// other command classes have their own limits
+	ok, _ = g.allow("bob", commands.lookup("help"), now)
+	assert.True(t, ok)
+
+	// the track changes limit is common for everybody
+	ok, _ = g.allow("alice", commands.lookup("next"), now)
+	assert.True(t, ok)
+	ok, notice = g.allow("alice", commands.lookup("playlist"), now)
+	assert.False(t, ok)
+	assert.Equal(t, p.Sprintf(messageTrackChangesLimit, "alice"), notice)
+	// stop doesn't change the track
+	ok, _ = g.allow("carol", commands.lookup("stop"), now)
+	assert.True(t, ok)
+
+	// a minute later everything is allowed again
+	ok, _ = g.allow("bob", commands.lookup("random"), now.Add(time.Minute))
+	assert.True(t, ok)
+}
+
+func TestJamManager_Command_floodGuard(t *testing.T) {
+	jm := &JamManager{queueManager: NewQueueManager("dj", nil, nil), jamChatBot: &testChatBot{},
+		floodGuard: newFloodGuard(config.RateLimit{TrackCommands: 100, TrackChanges: 1})}
+	jm.SetRoleDB(testRoles{"guest": auth.RoleGuest, "dj": auth.RoleDJ})
+
+	// запрещённые и неверные команды не расходуют общий лимит смены треков
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, p.Sprintf(messagePermissionDenied, auth.RoleDJ), jm.Command("random", "guest"))
+		assert.NotEqual(t, p.Sprintf(messageTrackChangesLimit, "dj"), jm.Command("track", "dj"))
+	}
+
+	ok, _ := jm.floodGuard.allow("dj", commands.lookup("next"), time.Now())
+	assert.True(t, ok)
+	ok, _ = jm.floodGuard.allow("dj", commands.lookup("next"), time.Now())
+	assert.False(t, ok)
+}
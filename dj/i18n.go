@@ -0,0 +1,219 @@
+package dj
+
+import (
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/auth"
+	"github.com/ayvan/ninjam-dj-bot/config"
+	"github.com/ayvan/ninjam-dj-bot/locales"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// messages are translations of bot messages, English ones are the keys
+var messages = catalog.NewBuilder(catalog.Fallback(language.English))
+
+// p is the printer of the bot language from the config, replies to users having their own language
+// are printed by the printer of that language, see JamManager.replyPrinter
+var p = message.NewPrinter(config.Language, message.Catalog(messages))
+
+var (
+	printersMtx sync.Mutex
+	printers    = map[language.Tag]*message.Printer{}
+	// языки синтеза речи по языкам каталогов
+	ttsLanguages = map[language.Tag]string{}
+)
+
+// LoadCatalogs loads translations of bot messages from catalogue files of dir, see the locales package,
+// dir must have the catalogue of the config language unless it's English
+func LoadCatalogs(dir string) error {
+	files, err := locales.Files(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		c, err := locales.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		tag, err := language.Parse(c.Language)
+		if err != nil {
+			return fmt.Errorf("catalog %s: %s", file, err)
+		}
+
+		for _, msg := range c.Messages {
+			switch {
+			case msg.Translation.Select != nil:
+				err = messages.Set(tag, msg.ID, plural.Selectf(msg.Translation.Select.Arg, "", msg.Translation.Select.PluralCases()...))
+			case msg.Translation.Text != "":
+				err = messages.SetString(tag, msg.ID, msg.Translation.Text)
+			default:
+				logrus.Warnf("catalog %s: %q is not translated", file, msg.ID)
+			}
+			if err != nil {
+				return fmt.Errorf("catalog %s: %s", file, err)
+			}
+		}
+
+		printersMtx.Lock()
+		ttsLanguages[tag] = c.TTS
+		printersMtx.Unlock()
+
+		logrus.Infof("%d messages loaded for language %s", len(c.Messages), tag)
+	}
+
+	if !hasCatalog(config.Language) {
+		return fmt.Errorf("no catalog of language %s in %s", config.Language, dir)
+	}
+
+	return nil
+}
+
+// hasCatalog reports whether messages of the language or its parent are loaded, English messages are the keys
+// and are used for an undefined language too
+func hasCatalog(tag language.Tag) bool {
+	if tag == language.Und {
+		return true
+	}
+
+	printersMtx.Lock()
+	defer printersMtx.Unlock()
+
+	for t := tag; !t.IsRoot(); t = t.Parent() {
+		if _, ok := ttsLanguages[t]; ok || t == language.English {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ttsLanguage returns the text-to-speech language of the catalogue matching lang, lang itself without a catalogue
+func ttsLanguage(lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return lang
+	}
+
+	printersMtx.Lock()
+	defer printersMtx.Unlock()
+
+	for t := tag; !t.IsRoot(); t = t.Parent() {
+		if tts := ttsLanguages[t]; tts != "" {
+			return tts
+		}
+	}
+
+	return lang
+}
+
+// Languages returns languages of the loaded catalogs and English
+func Languages() (res []string) {
+	res = []string{language.English.String()}
+	for _, tag := range messages.Languages() {
+		if tag != language.English {
+			res = append(res, tag.String())
+		}
+	}
+	sort.Strings(res[1:])
+
+	return
+}
+
+func knownLanguage(lang string) bool {
+	for _, known := range Languages() {
+		if known == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// printerOf returns the printer of the language, the one of the config language if lang is empty or unknown
+func printerOf(lang string) *message.Printer {
+	if lang == "" {
+		return p
+	}
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return p
+	}
+
+	printersMtx.Lock()
+	defer printersMtx.Unlock()
+
+	if printers[tag] == nil {
+		printers[tag] = message.NewPrinter(tag, message.Catalog(messages))
+	}
+
+	return printers[tag]
+}
+
+// LanguageDB keeps languages NINJAM users choose for bot replies
+type LanguageDB interface {
+	LanguageOf(userName string) (string, error)
+	LanguageSet(userName, lang string) error
+}
+
+// SetLanguageDB sets the storage of user languages, without it all replies are in the config language
+func (jm *JamManager) SetLanguageDB(languages LanguageDB) {
+	jm.languages = languages
+}
+
+// language returns the language of replies to the user, the config one if the user hasn't chosen any
+func (jm *JamManager) language(userName string) string {
+	if jm.languages != nil {
+		lang, err := jm.languages.LanguageOf(userName)
+		if err == nil {
+			return lang
+		}
+		if err != auth.ErrorNotFound {
+			logrus.Errorf("language of %s: %s", userName, err)
+		}
+	}
+
+	return config.Language.String()
+}
+
+// SetLanguage sets the language of replies to the user, lang must be one of the loaded catalogs
+func (jm *JamManager) SetLanguage(userName, lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil || !knownLanguage(tag.String()) {
+		return jm.replyPrinter(userName).Sprintf(messageLanguageUnknown, lang, strings.Join(Languages(), ", "))
+	}
+
+	if jm.languages == nil {
+		logrus.Warn("no language DB, user languages can't be stored")
+		return p.Sprintf(errorGeneral)
+	}
+	if err = jm.languages.LanguageSet(userName, tag.String()); err != nil {
+		logrus.Errorf("language of %s: %s", userName, err)
+		return p.Sprintf(errorGeneral)
+	}
+
+	// подтверждаем уже на новом языке
+	return jm.replyPrinter(userName).Sprintf(messageLanguageSet, tag)
+}
+
+// replyPrinter returns the printer of replies to the user in the user language,
+// the room gets replies to the user in that language too
+func (jm *JamManager) replyPrinter(userName string) *message.Printer {
+	return printerOf(jm.language(userName))
+}
+
+// reply sends the private reply to the user and returns the rest to be sent to the room,
+// private replies go to the room too if the NINJAM client doesn't send private messages
+func (jm *JamManager) reply(userName, msg string, private bool) string {
+	if !private || jm.privateBot == nil || msg == "" {
+		return msg
+	}
+	jm.privateBot.SendPrivateMessage(userName, msg)
+
+	return ""
+}
@@ -0,0 +1,145 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-chatbot/ninjam-bot"
+	"github.com/ayvan/ninjam-dj-bot/auth"
+	"github.com/ayvan/ninjam-dj-bot/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testLanguages map[string]string
+
+func (l testLanguages) LanguageOf(userName string) (string, error) {
+	if lang, ok := l[userName]; ok {
+		return lang, nil
+	}
+	return "", auth.ErrorNotFound
+}
+
+func (l testLanguages) LanguageSet(userName, lang string) error {
+	l[userName] = lang
+	return nil
+}
+
+type testPrivateChatBot struct {
+	testChatBot
+	private map[string][]string
+}
+
+func (b *testPrivateChatBot) SendPrivateMessage(userName, msg string) {
+	if b.private == nil {
+		b.private = make(map[string][]string)
+	}
+	b.private[userName] = append(b.private[userName], msg)
+}
+
+func TestLoadCatalogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "it.json"), []byte(`{"language": "it", "tts": "it-IT", "messages": [
+		{"id": "queue started", "message": "queue started", "translation": "coda avviata"},
+		{"id": "found %d: %s", "message": "found %d: %s", "translation": {"select": {"feature": "plural", "arg": 1,
+			"cases": {"=0": {"msg": "niente"}, "one": {"msg": "trovato %d: %s"}, "other": {"msg": "trovati %d: %s"}}}}}
+	]}`), 0644)
+	assert.NoError(t, err)
+	assert.NoError(t, LoadCatalogs(dir))
+
+	assert.Contains(t, Languages(), "it")
+	assert.Equal(t, "en", Languages()[0])
+	assert.Equal(t, "coda avviata", printerOf("it").Sprintf(messageQueueStarted))
+	// нет перевода - остаётся английский
+	assert.Equal(t, "queue finished", printerOf("it").Sprintf(messageQueueFinished))
+	assert.Equal(t, "niente", printerOf("it").Sprintf(messageSearchResults, 0, ""))
+	assert.Equal(t, "trovato 1: Blues", printerOf("it").Sprintf(messageSearchResults, 1, "Blues"))
+	assert.Equal(t, "trovati 5: Blues", printerOf("it").Sprintf(messageSearchResults, 5, "Blues"))
+
+	assert.Equal(t, "it-IT", ttsLanguage("it"))
+	assert.Equal(t, "it-IT", ttsLanguage("it-CH"))
+	assert.Equal(t, "fr", ttsLanguage("fr"))
+
+	// каталога языка бота нет
+	defer func(lang language.Tag) { config.Language = lang }(config.Language)
+	config.Language = language.MustParse("pt-BR")
+	assert.Error(t, LoadCatalogs(dir))
+	config.Language = language.MustParse("it-CH")
+	assert.NoError(t, LoadCatalogs(dir))
+	config.Language = language.BritishEnglish
+	assert.NoError(t, LoadCatalogs(dir))
+
+	err = ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"language": "xx-bad-tag", "messages": []}`), 0644)
+	assert.NoError(t, err)
+	assert.Error(t, LoadCatalogs(dir))
+}
+
+func TestLoadCatalogs_plural(t *testing.T) {
+	assert.NoError(t, LoadCatalogs("../locales"))
+
+	assert.Equal(t, "trading 1 bar: Bob", printerOf("en").Sprintf(messageTradingBars, 1, "Bob"))
+	assert.Equal(t, "trading 4 bars: Bob", printerOf("en").Sprintf(messageTradingBars, 4, "Bob"))
+	assert.Equal(t, "3. Blues (1 track, 5:00)", printerOf("en").Sprintf(messagePlaylistLine, 3, "Blues", 1, "5:00"))
+
+	ru := printerOf("ru")
+	assert.Equal(t, "3. Blues (1 трек, 5:00)", ru.Sprintf(messagePlaylistLine, 3, "Blues", 1, "5:00"))
+	assert.Equal(t, "3. Blues (2 трека, 5:00)", ru.Sprintf(messagePlaylistLine, 3, "Blues", 2, "5:00"))
+	assert.Equal(t, "3. Blues (11 треков, 5:00)", ru.Sprintf(messagePlaylistLine, 3, "Blues", 11, "5:00"))
+	assert.Equal(t, "3. Blues (21 трек, 5:00)", ru.Sprintf(messagePlaylistLine, 3, "Blues", 21, "5:00"))
+
+	assert.Equal(t, "Warteschlange gestartet", printerOf("de").Sprintf(messageQueueStarted))
+	assert.Equal(t, "cola iniciada", printerOf("es").Sprintf(messageQueueStarted))
+}
+
+func TestJamManager_Command_private(t *testing.T) {
+	assert.NoError(t, LoadCatalogs("../locales"))
+
+	bot := &testPrivateChatBot{}
+	jm := &JamManager{queueManager: NewQueueManager("dj", nil, nil), jamChatBot: bot, privateBot: bot}
+	jm.SetRoleDB(testRoles{"alice": auth.RoleMusician})
+	jm.SetLanguageDB(testLanguages{})
+
+	// личные ответы не попадают в общий чат
+	assert.Equal(t, "", jm.Command("help qjoin", "alice"))
+	assert.Len(t, bot.private["alice"], 1)
+	assert.Equal(t, "", jm.Command("stop", "alice"))
+	assert.Equal(t, p.Sprintf(messagePermissionDenied, auth.RoleDJ), bot.private["alice"][1])
+
+	assert.Equal(t, "", jm.Command("lang fr", "alice"))
+	assert.Equal(t, p.Sprintf(messageLanguageUnknown, "fr", strings.Join(Languages(), ", ")), bot.private["alice"][2])
+
+	assert.Equal(t, "", jm.Command("lang ru", "alice"))
+	assert.Equal(t, printerOf("ru").Sprintf(messageLanguageSet, "ru"), bot.private["alice"][3])
+	assert.Equal(t, "", jm.Command("help qjoin", "alice"))
+	assert.Contains(t, bot.private["alice"][4], printerOf("ru").Sprintf(helpQJoin))
+
+	// объявления очереди адресованы всем и остаются на языке бота
+	assert.Equal(t, p.Sprintf(messageQueueUserJoined, "alice"), jm.Command("qjoin", "alice"))
+}
+
+func TestJamManager_Command_noPrivate(t *testing.T) {
+	assert.NoError(t, LoadCatalogs("../locales"))
+
+	jm := &JamManager{jamChatBot: &testChatBot{}}
+
+	assert.Equal(t, jm.CommandHelp(p, "qjoin"), jm.Command("help qjoin", "alice"))
+
+	// без личных сообщений ответы идут в общий чат, но на языке пользователя
+	jm.SetLanguageDB(testLanguages{"alice": "ru"})
+	assert.Equal(t, jm.CommandHelp(printerOf("ru"), "qjoin"), jm.Command("help qjoin", "alice"))
+	assert.NotEqual(t, jm.CommandHelp(p, "qjoin"), jm.Command("help qjoin", "alice"))
+}
+
+func TestNinJamBot_private(t *testing.T) {
+	// настоящий клиент NINJAM должен отправлять личные сообщения
+	var chatBot JamChatBot = ninjam_bot.NewNinJamBot("localhost", "2049", "dj", "", true)
+	_, ok := chatBot.(JamPrivateBot)
+	assert.True(t, ok)
+}
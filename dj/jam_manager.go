@@ -1,16 +1,18 @@
 package dj
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ayvan/ninjam-chatbot/models"
 	"github.com/ayvan/ninjam-dj-bot/config"
 	"github.com/ayvan/ninjam-dj-bot/lib"
 	"github.com/ayvan/ninjam-dj-bot/tracks"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 	"math/rand"
 	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,27 +29,110 @@ const (
 	messageAfter15Seconds               = "%s's turn in 15 seconds"
 	messageNowPlaying                   = "%s is playing now"
 	messageIsNext                       = "%s is next"
+	messageAfter15SecondsDuet           = "%s and %s's turn in 15 seconds"
+	messageNowPlayingDuet               = "%s and %s are playing now"
+	messageAreNextDuet                  = "%s and %s are next"
+	messageTradingBars                  = "trading %d bars: %s"
+	messageQueueMode                    = "queue mode: %s"
+	messageQueueBadMode                 = "bad queue mode %s, use duet, trade 4, random or roundrobin"
 	messageQueueCantStartPlayingTrack   = "can't start queue, the track is playing"
 	messageQueueCantStartAlreadyStarted = "can't start queue, already started"
 	messageQueueCantFinishNotStarted    = "can't finish queue, not started"
 	messageQueueCantFinishPlayingTrack  = "can't finish queue, the track is playing"
 	messageQueueUserLeaved              = "%s leaved queue"
 	messageQueueUserJoined              = "%s joined queue"
+	messageQueueUserMoved               = "%s moved to position %d in queue"
+	messageQueueUsersSwapped            = "%s and %s swapped places in queue"
+	messageQueueUserSkips               = "%s skips the next turn"
+	messageQueueUserFirst               = "%s moved to the head of queue"
+	messageQueueUserNotInQueue          = "%s is not in queue"
+	messageQueueBadPosition             = "bad queue position %d"
+	messageQueueUserIdle                = "%s seems to be away, passing the turn"
+	messageQueueUserIdleRemoved         = "%s missed several turns and was removed from queue"
+	messagePermissionDenied             = "this command requires the %s role, ask an admin"
+	messageSlowDown                     = "%s, please slow down, your commands are ignored for a while"
+	messageTrackChangesLimit            = "%s, the track is changed too often, please wait a minute"
+	messageVoteSkip                     = "%s votes to skip the track: %d of %d"
+	messageVoteStop                     = "%s votes to stop the track: %d of %d"
+	messageVoteSkipPassed               = "the vote to skip the track passed"
+	messageVoteStopPassed               = "the vote to stop the track passed"
+	messageVoteNothingPlaying           = "no track is playing"
+	messageVotesEmpty                   = "no votes in progress"
+	messageVotesStatus                  = "votes: %s"
+	messageVoteStatus                   = "%s %d of %d"
+	messageRequestAdded                 = "%s requested %s, position %d"
+	messageRequestNotFound              = "no tracks found for %s"
+	messageRequestEmpty                 = "what track to request? e.g. request blues"
+	messageRequestDuplicate             = "%s is requested already"
+	messageRequestLimit                 = "%s, too many requests already"
+	messageRequestsEmpty                = "no track requests"
+	messageRequests                     = "track requests: %s"
+	messageRequestPlaying               = "request of %s"
+	messageSearchEmpty                  = "what to search? e.g. search blues shuffle A"
+	messageSearchResults                = "found %d: %s"
+	messageSearchMore                   = "and %d more, add words to narrow the search"
+	messageSearchPick                   = "use '%s pick 2' to play a track"
+	messageSearchBadNumber              = "bad track number %d, search tracks first"
+	messagePlaylists                    = "playlists: %d"
+	messagePlaylistsEmpty               = "no playlists yet"
+	messagePlaylistLine                 = "%d. %s (%d tracks, %s)"
+	messageTrackInfo                    = "%d. %s, length %s, %d BPI"
+	messageTrackTags                    = "tags: %s"
+	messageTrackAuthor                  = "author: %s"
+	messagePageNext                     = "page %d of %d, next: %s"
+	messageQueueNoHistory               = "no queue history yet"
+	messageQueueStatsSession            = "this session: %s"
+	messageQueueStatsAllTime            = "all time: %s"
+	messageQueueStatsUser               = "%s - solos: %d, on stage: %s"
+	messageQueueWaitingLongest          = "waiting longest: %s"
 	messageTimeout                      = "timeout %s"
 	topicPlayingTrack                   = "playing track %s"
 	messagePlaylistStarted              = "playlist %s started"
-	helpMessage                         = "DJ Bot commands: \n" +
-		"%s random - start random track\n" +
-		"%s random Am - start random track with key\n" +
-		"%s stop - stop track\n" +
-		"%s playlist 12 - start playlist by ID\n" +
-		"%s next - next track (only if playlist playing)\n" +
-		"%s playing - show current track/playlist info\n" +
-		"%s qstart - (or qs) start queue without starting track\n" +
-		"%s qfinish - (or qf) finish queue\n" +
-		"%s qnext - (or qn) set next user in queue as current\n" +
-		"%s qleave - (or ql) leave queue\n" +
-		"%s qjoin - (or qj) join queue"
+	messagePlaylistFinished             = "playlist finished"
+	messageArgMissing                   = "missing argument %s"
+	messageArgBad                       = "bad argument %s: %s"
+	messageArgUnexpected                = "unexpected argument %s"
+	messageUsage                        = "usage: %s %s"
+	messageHelp                         = "DJ Bot commands:"
+	messageHelpAliases                  = "(or %s)"
+	messageHelpAdminsOnly               = "(admins only)"
+	messageHelpRole                     = "requires the %s role"
+	messageHelpArgsRole                 = "with arguments requires the %s role"
+	messageHelpUnknownCommand           = "unknown command %s, use 'dj help' to get the list of commands"
+	messageLanguage                     = "your language: %s, available: %s"
+	messageLanguageSet                  = "replies to you are in %s now"
+	messageLanguageUnknown              = "unknown language %s, available: %s"
+
+	helpRandom    = "start a random track, optionally with key, tempo, tags and length, e.g. random Am bpm=90-120 [blues, \"slow rock\"] 5 loops, 32 bars or 7:30"
+	helpTrack     = "start the track by ID"
+	helpPlaylist  = "start the playlist by ID"
+	helpStop      = "stop the track"
+	helpPlay      = "start the selected track again"
+	helpNext      = "next track (only if playlist playing)"
+	helpPlaying   = "show current track/playlist info"
+	helpHelp      = "list commands or show details of the command"
+	helpQStart    = "start queue without starting track"
+	helpQFinish   = "finish queue"
+	helpQNext     = "set next user in queue as current"
+	helpQLeave    = "leave queue"
+	helpQJoin     = "join queue"
+	helpQSkip     = "skip your next turn keeping your place in queue"
+	helpQMove     = "move user to position in queue, 1 is next after the current soloist"
+	helpQSwap     = "swap two users in queue"
+	helpQFirst    = "give the turn to user right now"
+	helpQStats    = "solo counts and time on stage for the session and all time"
+	helpQMode     = "show the queue mode or set it: duet, trade 4, random or roundrobin to play in pairs, trade every 4 bars, shuffle every round or take turns in order"
+	helpVoteSkip  = "vote to skip the track"
+	helpVoteStop  = "vote to stop the track"
+	helpVotes     = "show votes"
+	helpRequest   = "request a track by ID or words to play after the current one"
+	helpRequests  = "show requests"
+	helpSearch    = "find tracks by title, artist, album, tags, author, key and tempo, e.g. search blues shuffle A bpm=90-120"
+	helpPick      = "play a track found by the last search"
+	helpPlaylists = "list playlists"
+	helpInfo      = "show track details, or playlist details with info playlist 3"
+	helpLang      = "show your language or set the language of replies to you, e.g. lang ru"
+	helpVoiceTest = "say the text in the voice channel"
 
 	errorGeneral            = "an error has occurred"
 	errorTrackNotSelected   = "track not selected, please select track"
@@ -57,52 +142,6 @@ const (
 	errorPlaylistIsEmpty    = "playlist %d is empty"
 )
 
-var p *message.Printer
-
-func init() {
-	message.SetString(language.Russian, messageAlreadyStarted, "воспроизведение уже запущено")
-	message.SetString(language.Russian, messageCantStartRandomTrack, "не удалось запустить случайный трек")
-	message.SetString(language.Russian, messageUnableToRecognizeCommand, "невозможно распознать команду, используйте 'dj help' для получения списка и формата доступных команд")
-	message.SetString(language.Russian, messageUnableToRecognizeAPICommand, "невозможно распознать команду API")
-	message.SetString(language.Russian, messageUserNotFound, "пользователь %s не найден")
-	message.SetString(language.Russian, messagePlayingTrack, "запущен трек %s, длительность воспроизведения %s")
-	message.SetString(language.Russian, messageTimeout, "перерыв %s")
-	message.SetString(language.Russian, topicPlayingTrack, "играет трек %s")
-	message.SetString(language.Russian, messageQueueStarted, "очередь запущена")
-	message.SetString(language.Russian, messageQueueFinished, "очередь остановлена")
-	message.SetString(language.Russian, messageQueueNext, "очередь переключена на следующего участника")
-	message.SetString(language.Russian, messageAfter15Seconds, "очередь %s через 15 секунд")
-	message.SetString(language.Russian, messageNowPlaying, "сейчас играет %s")
-	message.SetString(language.Russian, messageIsNext, "готовится играть %s")
-	message.SetString(language.Russian, messageQueueCantStartPlayingTrack, "нельзя запустить очередь, играет трек")
-	message.SetString(language.Russian, messageQueueCantStartAlreadyStarted, "нельзя запустить очередь, уже запущена")
-	message.SetString(language.Russian, messageQueueCantFinishNotStarted, "нельзя остановить очередь, не запущена")
-	message.SetString(language.Russian, messageQueueCantFinishPlayingTrack, "нельзя остановить очередь, играет трек")
-	message.SetString(language.Russian, messageQueueUserLeaved, "%s покинул очередь")
-	message.SetString(language.Russian, messageQueueUserJoined, "%s присоединился к очереди")
-	message.SetString(language.Russian, messagePlaylistStarted, "запущен плейлист %s")
-	message.SetString(language.Russian, errorTrackNotSelected, "трек не выбран, пожалуйста, выберите трек")
-	message.SetString(language.Russian, errorGeneral, "произошла ошибка")
-	message.SetString(language.Russian, errorTrackNotFound, "трек %d не найден")
-	message.SetString(language.Russian, errorPlaylistNotFound, "плейлист %d не найден")
-	message.SetString(language.Russian, errorNoPlaylistSelected, "плейлист не выбран")
-	message.SetString(language.Russian, errorPlaylistIsEmpty, "плейлист %d не содержит треков")
-	message.SetString(language.Russian, helpMessage, "Команды DJ-бота : \n"+
-		"%s random - запустить случайный трек\n"+
-		"%s random Am - запустить случайный трек с заданной тональностью\n"+
-		"%s stop - остановить трек\n"+
-		"%s playlist 12 - запустить плейлист с заданным ID\n"+
-		"%s next - следующий трек (только если играет плейлист)\n"+
-		"%s playing - показать информацию о текущем треке/плейлисте\n"+
-		"%s qstart - (или qs) запустить очередь без запуска трека\n"+
-		"%s qfinish - (или qf) остановить очередь\n"+
-		"%s qnext - (или qn) переключить очередь на следующего\n"+
-		"%s qleave - (или ql) покинуть очередь\n"+
-		"%s qjoin - (или qj) присоединиться к очереди")
-
-	p = message.NewPrinter(config.Language)
-}
-
 type Manager interface {
 	Playlists() []tracks.Playlist
 	PlayRandom(command lib.JamCommand) string
@@ -128,55 +167,121 @@ type JamChatBot interface {
 	Users() []string
 }
 
+// JamPrivateBot is implemented by NINJAM clients which send private messages,
+// long and personal replies like help and search results are sent to the user only
+type JamPrivateBot interface {
+	SendPrivateMessage(userName, msg string)
+}
+
 type JamManager struct {
+	// playerMtx guards the player state below, it's changed by chat commands, API requests and the player callbacks
+	playerMtx   sync.Mutex
 	playingMode playingMode // playing single track or playing list of tracks
 	playlist    *tracks.Playlist
 	track       *tracks.Track
 	repeats     uint
 	playing     bool // играем или нет в данный момент
 
+	// плейлист, прерванный заказанными треками, продолжится после трека с индексом pausedIndex
+	pausedPlaylist *tracks.Playlist
+	pausedIndex    int
+
 	jamPlayer  *JamPlayer
 	jamDB      tracks.JamTracksDB
 	jamChatBot JamChatBot
+	privateBot JamPrivateBot
 
 	queueManager *QueueManager
+	roles        RoleDB
+	languages    LanguageDB
+	floodGuard   *floodGuard
+	votes        *voteBox
+	requests     requestList
+	searches     searchResults
+	events       *EventBus
 }
 
 func NewJamManager(jamDB tracks.JamTracksDB, player *JamPlayer, chatBot JamChatBot) *JamManager {
 
-	sendVoiceMsgFunc := func(msg string) {
-		player.PlayText(config.Language.String(), msg)
+	jm := &JamManager{
+		jamPlayer:  player,
+		jamDB:      jamDB,
+		jamChatBot: chatBot,
+		floodGuard: newFloodGuard(config.Get().RateLimit),
+		votes:      newVoteBox(config.Get().Voting.Share, time.Duration(config.Get().Voting.Window)*time.Second),
+		events:     NewEventBus(),
 	}
 
-	jm := &JamManager{
-		jamPlayer:    player,
-		jamDB:        jamDB,
-		jamChatBot:   chatBot,
-		queueManager: NewQueueManager(chatBot.UserName(), chatBot.SendMessage, sendVoiceMsgFunc),
+	sendVoiceMsgFunc := func(msg string) {
+		jm.speak(ttsLanguage(config.Language.String()), msg)
+	}
+	jm.queueManager = NewQueueManager(chatBot.UserName(), chatBot.SendMessage, sendVoiceMsgFunc)
+	jm.queueManager.SetEvents(jm.events)
+	chatBot.SetOnUserinfoChange(jm.onUserinfoChange)
+	jm.queueManager.SetHistory(newDBQueueHistory(jamDB))
+
+	jm.queueManager.SetIdlePolicy(config.Get().Idle.SilentIntervals, config.Get().Idle.MaxTurns)
+	if privateBot, ok := chatBot.(JamPrivateBot); ok {
+		jm.privateBot = privateBot
+	} else {
+		logrus.Warn("NINJAM client doesn't send private messages, all replies are sent to the room")
 	}
-	chatBot.SetOnUserinfoChange(jm.queueManager.OnUserinfoChange)
 	player.SetOnStop(jm.onStop)
 	player.SetOnStart(jm.onStart)
+	player.SetOnInterval(jm.onInterval)
 	return jm
 }
 
-func (jm *JamManager) Playlists() (res []tracks.Playlist) {
-	return
+// OnIntervalBegin passes intervals received from other users to the queue to detect members
+// who don't play during their turn
+func (jm *JamManager) OnIntervalBegin(userName string, channelIndex uint8, guid [16]byte) {
+	jm.queueManager.OnIntervalBegin(userName, channelIndex, guid)
+}
+
+// SetQueueSubscriber sets the subscription to intervals of users, it's called with the queue members
+// whenever they change to receive intervals of them only
+func (jm *JamManager) SetQueueSubscriber(subscribe func(userNames []string)) {
+	jm.queueManager.SetSubscriber(subscribe)
+}
+
+// OnServerConfigChange passes the server tempo change to the player and to the queue
+func (jm *JamManager) OnServerConfigChange(bpm, bpi uint) {
+	jm.events.Publish(EventTempoChanged, TempoEvent{BPM: bpm, BPI: bpi})
+	jm.jamPlayer.OnServerConfigChange(bpm, bpi)
+	jm.queueManager.OnServerConfigChange(bpm, bpi)
 }
 
 func (jm *JamManager) PlayRandom(command lib.JamCommand) (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	if err := jm.playerRandom(command); err != nil {
+		return jm.playerErrorMessage(err)
+	}
+	return jm.playingMessage()
+}
+
+// PlayerRandom starts a random track matching the key, tempo and tags of the command
+// and plays it as long as the command says
+func (jm *JamManager) PlayerRandom(command lib.JamCommand) error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.playerRandom(command)
+}
+
+// playerRandom is PlayerRandom, playerMtx must be held
+func (jm *JamManager) playerRandom(command lib.JamCommand) (err error) {
 	defer recoverer()
 	count, err := jm.jamDB.CountTracks()
 	if err != nil {
-		logrus.Error(err)
-		return p.Sprintf(errorGeneral)
+		return
 	}
 
 	logrus.Debugf("tracks found: %d", count)
 
 	if count == 0 {
-		msg = p.Sprintf(messageCantStartRandomTrack)
-		return
+		return &PlayerError{Code: PlayerNoMatchingTrack}
 	}
 
 	randSource := rand.NewSource(time.Now().UnixNano())
@@ -187,8 +292,7 @@ func (jm *JamManager) PlayRandom(command lib.JamCommand) (msg string) {
 	for {
 		i++
 		if i > 1000 {
-			msg = p.Sprintf(messageCantStartRandomTrack)
-			return
+			return &PlayerError{Code: PlayerNoMatchingTrack}
 		}
 		id := uint(randomizer.Intn(int(count)))
 
@@ -196,8 +300,11 @@ func (jm *JamManager) PlayRandom(command lib.JamCommand) (msg string) {
 		if err == tracks.ErrorNotFound {
 			continue
 		} else if err != nil {
-			logrus.Error(err)
-			return p.Sprintf(errorGeneral)
+			return
+		}
+		// файл трека пропал с диска, загрузить его не получится
+		if track.Unavailable {
+			continue
 		}
 
 		if command.Key != 0 {
@@ -210,6 +317,12 @@ func (jm *JamManager) PlayRandom(command lib.JamCommand) (msg string) {
 				continue
 			}
 		}
+		if command.BPMMin != 0 && track.BPM < command.BPMMin {
+			continue
+		}
+		if command.BPMMax != 0 && track.BPM > command.BPMMax {
+			continue
+		}
 		if len(command.Tags) > 0 {
 			found := false
 		tags:
@@ -229,144 +342,246 @@ func (jm *JamManager) PlayRandom(command lib.JamCommand) (msg string) {
 	}
 	logrus.Debugf("track found: %d %v", track.ID, track)
 
+	jm.stop()
 	jm.track = track
 	err = jm.LoadTrack(jm.track)
 	if err != nil {
-		msg = p.Sprintf(errorGeneral)
 		return
 	}
 	var repeats uint
 
-	if command.Duration != 0 {
+	switch {
+	case command.Loops != 0:
+		repeats = command.Loops
+	case command.Bars != 0:
+		repeats = jm.countRepeats(track, barsDuration(track, command.Bars))
+	case command.Duration != 0:
 		repeats = jm.countRepeats(track, command.Duration)
 	}
 
-	jm.SetRepeats(repeats)
+	jm.setRepeats(repeats)
 
 	jm.track = track
-	jm.playlist = nil
+	jm.playlist, jm.pausedPlaylist = nil, nil
 	jm.playingMode = playingTrack
 
-	return jm.Start()
+	return jm.start()
 }
 
 func (jm *JamManager) StartPlaylist(id uint) (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	if err := jm.playerPlaylist(id); err != nil {
+		return jm.playerErrorMessage(err)
+	}
+	return p.Sprintf(messagePlaylistStarted, jm.playlist.Name) + ", " + jm.playingMessage()
+}
+
+// PlayerPlaylist starts the first track of the playlist
+func (jm *JamManager) PlayerPlaylist(id uint) error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.playerPlaylist(id)
+}
+
+// playerPlaylist is PlayerPlaylist, playerMtx must be held
+func (jm *JamManager) playerPlaylist(id uint) (err error) {
 	defer recoverer()
-	jm.Stop()
+	jm.stop()
 
 	playlist, err := jm.jamDB.Playlist(id)
 	if err == tracks.ErrorNotFound {
-		return p.Sprintf(errorPlaylistNotFound, id)
+		return &PlayerError{Code: PlayerPlaylistNotFound, ID: id}
 	} else if err != nil {
-		logrus.Error(err)
-		return p.Sprintf(errorGeneral)
+		return
 	}
 
 	if len(playlist.Tracks) == 0 {
-		return p.Sprintf(errorPlaylistIsEmpty, id)
+		return &PlayerError{Code: PlayerPlaylistEmpty, ID: id}
 	}
 
-	jm.playlist = playlist
+	jm.playlist, jm.pausedPlaylist = playlist, nil
+
+	return jm.playlistTrack(0)
+}
 
-	trackID := playlist.Tracks[0].TrackID
-	jm.track, err = jm.jamDB.Track(trackID)
+func (jm *JamManager) StartTrack(id uint) (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	if err := jm.playerTrack(id); err != nil {
+		return jm.playerErrorMessage(err)
+	}
+	return jm.playingMessage()
+}
+
+// PlayerTrack starts the track once
+func (jm *JamManager) PlayerTrack(id uint) error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.playerTrack(id)
+}
+
+// playerTrack is PlayerTrack, playerMtx must be held
+func (jm *JamManager) playerTrack(id uint) (err error) {
+	defer recoverer()
+
+	track, err := jm.jamDB.Track(id)
 	if err == tracks.ErrorNotFound {
-		return p.Sprintf(errorTrackNotFound, trackID)
+		return &PlayerError{Code: PlayerTrackNotFound, ID: id}
 	} else if err != nil {
-		logrus.Error(err)
-		return p.Sprintf(errorGeneral)
+		return
 	}
 
-	err = jm.LoadTrack(jm.track)
-	if err != nil {
-		msg = p.Sprintf(errorGeneral)
+	jm.stop()
+	jm.track = track
+	if err = jm.LoadTrack(jm.track); err != nil {
 		return
 	}
-	jm.SetRepeats(playlist.Tracks[0].Repeats)
-	jm.playingMode = playingPlaylist
+	jm.setRepeats(0)
+	jm.playlist, jm.pausedPlaylist = nil, nil
+	jm.playingMode = playingTrack
 
-	msg = p.Sprintf(messagePlaylistStarted, playlist.Name)
-	msg += ", "
-	msg += jm.Start()
-	return msg
+	return jm.start()
 }
 
-func (jm *JamManager) StartTrack(id uint) (msg string) {
-	// TODO
-	return
+func (jm *JamManager) Stop() (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	jm.stop()
+	return // todo msg
 }
 
-func (jm *JamManager) Stop() (msg string) {
+// PlayerStop stops the track
+func (jm *JamManager) PlayerStop() error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	if !jm.playing {
+		return &PlayerError{Code: PlayerNotPlaying}
+	}
+	jm.stop()
+
+	return nil
+}
+
+// stop stops the track by a command, nothing plays after it. playerMtx must be held
+func (jm *JamManager) stop() {
+	playing := jm.playing
 	jm.playing = false
 	if jm.jamPlayer == nil {
 		return
 	}
 	if jm.jamPlayer.Playing() {
 		jm.jamPlayer.Stop()
-		jm.playing = false
+	} else if !playing {
+		return
 	}
-	return // todo msg
+
+	// onStop плеера дождётся мьютекса уже после нас, поэтому об остановке сообщаем здесь
+	jm.events.Publish(EventTrackStopped, TrackStoppedEvent{Track: jm.track, Finished: false})
+	jm.queueManager.OnStop()
 }
 
 func (jm *JamManager) Start() (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.startMessage()
+}
+
+// startMessage is Start, playerMtx must be held
+func (jm *JamManager) startMessage() (msg string) {
+	if err := jm.start(); err != nil {
+		return jm.playerErrorMessage(err)
+	}
+	return jm.playingMessage()
+}
+
+// PlayerStart starts the selected track
+func (jm *JamManager) PlayerStart() error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.start()
+}
+
+// start is PlayerStart, playerMtx must be held
+func (jm *JamManager) start() error {
 	if jm.playing == true {
-		return p.Sprintf(messageAlreadyStarted)
+		return &PlayerError{Code: PlayerAlreadyPlaying}
 	}
 	if jm.track == nil {
-		return p.Sprintf(errorTrackNotSelected)
+		return &PlayerError{Code: PlayerNoTrack}
 	}
 	if jm.jamPlayer == nil {
-		return
+		return nil
 	}
 	jm.playing = true
 	err := jm.jamPlayer.Start()
 	if err != nil {
-		logrus.Errorf("jamPlayer.Start()", err)
 		jm.playing = false
-		return p.Sprintf(errorGeneral)
+		return fmt.Errorf("jamPlayer.Start(): %s", err)
 	}
 
-	t := time.Time{}.Add(jm.calcTrackTime(jm.track, jm.repeats))
-
 	// set topic - track info
 	jm.jamChatBot.SendAdminMessage(fmt.Sprintf("topic %s", p.Sprintf(topicPlayingTrack, jm.track)))
-	return p.Sprintf(messagePlayingTrack, jm.track, t.Format("04:05"))
+
+	return nil
 }
 
 func (jm *JamManager) Playing() (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.playingMessage()
+}
+
+// playingMessage is Playing, playerMtx must be held
+func (jm *JamManager) playingMessage() (msg string) {
 	t := time.Time{}.Add(jm.calcTrackTime(jm.track, jm.repeats))
 	return p.Sprintf(messagePlayingTrack, jm.track, t.Format("04:05"))
 }
 
 func (jm *JamManager) QueueStart() (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
 	if jm.playing == true {
 		return p.Sprintf(messageQueueCantStartPlayingTrack)
 	}
-	if !jm.queueManager.stopped {
+	if !jm.queueManager.Stopped() {
 		return p.Sprintf(messageQueueCantStartAlreadyStarted)
 	}
 
-	// default queue time is 6 hours
-	jm.queueManager.OnDelayedStart(time.Hour*6, time.Second*5, time.Second*15)
+	// queue without a track has no duration and no intervals, turns last as the policy says
+	jm.queueManager.OnDelayedStart(lib.SoloContext{}, jm.soloPolicy(), time.Second*15)
 
 	msg = p.Sprintf(messageQueueStarted)
-	jm.jamPlayer.PlayText(config.Language.String(), msg)
+	jm.speak(ttsLanguage(config.Language.String()), msg)
 	return
 }
 
 func (jm *JamManager) QueueFinish() (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
 	if jm.playing == true {
 		return p.Sprintf(messageQueueCantFinishPlayingTrack)
 	}
 
-	if jm.queueManager.stopped {
+	if jm.queueManager.Stopped() {
 		return p.Sprintf(messageQueueCantFinishNotStarted)
 	}
 
 	jm.queueManager.OnStop()
 
 	msg = p.Sprintf(messageQueueFinished)
-	jm.jamPlayer.PlayText(config.Language.String(), msg)
+	jm.speak(ttsLanguage(config.Language.String()), msg)
 	return
 }
 
@@ -388,33 +603,157 @@ func (jm *JamManager) QueueJoin(userName string) (msg string) {
 	return p.Sprintf(messageQueueUserJoined, userName)
 }
 
-func (jm *JamManager) Help() (msg string) {
-	if jm.jamChatBot == nil {
+func (jm *JamManager) QueueMove(userName string, pos int) (msg string) {
+	if pos < 1 {
+		return p.Sprintf(messageQueueBadPosition, pos)
+	}
+
+	// position 0 is the current soloist, chat positions start from the next one
+	if !jm.queueManager.MoveTo(userName, pos) {
+		return p.Sprintf(messageQueueUserNotInQueue, userName)
+	}
+
+	return p.Sprintf(messageQueueUserMoved, userName, pos)
+}
+
+func (jm *JamManager) QueueSwap(userName1, userName2 string) (msg string) {
+	if !jm.queueManager.Contains(userName1) {
+		return p.Sprintf(messageQueueUserNotInQueue, userName1)
+	}
+	if !jm.queueManager.Swap(userName1, userName2) {
+		return p.Sprintf(messageQueueUserNotInQueue, userName2)
+	}
+
+	return p.Sprintf(messageQueueUsersSwapped, userName1, userName2)
+}
+
+func (jm *JamManager) QueueSkip(userName string) (msg string) {
+	if !jm.queueManager.Skip(userName) {
+		return p.Sprintf(messageQueueUserNotInQueue, userName)
+	}
+
+	return p.Sprintf(messageQueueUserSkips, userName)
+}
+
+func (jm *JamManager) QueueFirst(userName string) (msg string) {
+	if !jm.queueManager.MoveTo(userName, 0) {
+		return p.Sprintf(messageQueueUserNotInQueue, userName)
+	}
+
+	return p.Sprintf(messageQueueUserFirst, userName)
+}
+
+func (jm *JamManager) QueueMode(args []string) (msg string) {
+	mode, err := ParseQueueMode(args)
+	if err != nil {
+		return p.Sprintf(messageQueueBadMode, strings.Join(args, " "))
+	}
+	jm.queueManager.SetMode(mode)
+
+	return p.Sprintf(messageQueueMode, mode)
+}
+
+// QueueHistoryReport is the history of the last queue session with per-user stats
+type QueueHistoryReport struct {
+	Session      *tracks.QueueSession     `json:"session"` // the current or the last finished session, nil if there were none
+	Turns        []*tracks.QueueTurn      `json:"turns"`
+	SessionStats []*tracks.QueueUserStats `json:"session_stats"`
+	AllTimeStats []*tracks.QueueUserStats `json:"all_time_stats"`
+	Waiting      []QueueWaiting           `json:"waiting"` // users in queue, the one who has been waiting longest goes first
+}
+
+func (jm *JamManager) QueueHistory() (res QueueHistoryReport, err error) {
+	res = QueueHistoryReport{
+		Turns:        []*tracks.QueueTurn{},
+		SessionStats: []*tracks.QueueUserStats{},
+		Waiting:      jm.queueManager.Waiting(),
+	}
+
+	session, err := jm.jamDB.LastQueueSession()
+	if err != nil && err != tracks.ErrorNotFound {
 		return
 	}
-	msg = p.Sprintf(helpMessage,
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName(),
-		jm.jamChatBot.UserName())
+	err = nil
+	if session != nil {
+		res.Session = session
+		if res.Turns, err = jm.jamDB.QueueTurns(session.ID); err != nil {
+			return
+		}
+		if res.SessionStats, err = jm.jamDB.QueueStats(session.ID); err != nil {
+			return
+		}
+	}
+
+	res.AllTimeStats, err = jm.jamDB.QueueStats(0)
 
 	return
 }
 
+// QueueStats returns solo counts and time on stage for the chat, only the top users are shown
+func (jm *JamManager) QueueStats(p *message.Printer) (msg string) {
+	const top = 5
+
+	history, err := jm.QueueHistory()
+	if err != nil {
+		logrus.Errorf("queue history: %s", err)
+		return p.Sprintf(errorGeneral)
+	}
+	if len(history.AllTimeStats) == 0 && len(history.Waiting) == 0 {
+		return p.Sprintf(messageQueueNoHistory)
+	}
+
+	statsString := func(stats []*tracks.QueueUserStats) string {
+		var res []string
+		for i := 0; i < len(stats) && i < top; i++ {
+			res = append(res, p.Sprintf(messageQueueStatsUser, stats[i].UserName, stats[i].Solos, formatDuration(time.Duration(stats[i].Seconds)*time.Second)))
+		}
+		return strings.Join(res, "; ")
+	}
+
+	var lines []string
+	if len(history.SessionStats) > 0 {
+		lines = append(lines, p.Sprintf(messageQueueStatsSession, statsString(history.SessionStats)))
+	}
+	if len(history.AllTimeStats) > 0 {
+		lines = append(lines, p.Sprintf(messageQueueStatsAllTime, statsString(history.AllTimeStats)))
+	}
+	if len(history.Waiting) > 0 {
+		var waiting []string
+		for i := 0; i < len(history.Waiting) && i < top; i++ {
+			waiting = append(waiting, history.Waiting[i].UserName+" "+formatDuration(time.Duration(history.Waiting[i].Seconds)*time.Second))
+		}
+		lines = append(lines, p.Sprintf(messageQueueWaitingLongest, strings.Join(waiting, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatDuration formats d as m:ss or h:mm:ss
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second)
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
 func (jm *JamManager) TextToSpeech(lang, msg string) {
-	jm.jamPlayer.PlayText(lang, msg)
+	jm.speak(lang, msg)
 
 	return
 }
 
-func (jm *JamManager) APICommand(command string, userName string) (msg string, err error) {
+// QueueCommandParams holds parameters of the queue API commands
+type QueueCommandParams struct {
+	User     string // user for join, leave, move, swap, skip and first commands
+	With     string // second user for swap command
+	Position int    // position for move command, 1 is next after the current soloist
+	Mode     string // mode for mode command: duet, trade 4, random or roundrobin
+}
+
+func (jm *JamManager) APICommand(command string, params QueueCommandParams) (msg string, err error) {
+	userName := params.User
 	if command == "leave" || command == "join" {
 		if userName == "" {
 			return "", fmt.Errorf(p.Sprintf(messageUserNotFound, "<empty string>"))
@@ -441,9 +780,9 @@ func (jm *JamManager) APICommand(command string, userName string) (msg string, e
 	case "finish":
 		msg = jm.QueueFinish()
 	case "next":
-		jm.queueManager.next()
+		jm.queueManager.Next()
 		msg = p.Sprintf(messageQueueNext)
-		jm.jamPlayer.PlayText(config.Language.String(), msg)
+		jm.speak(ttsLanguage(config.Language.String()), msg)
 	case "join":
 		ok := jm.queueManager.Add(userName)
 		if ok {
@@ -458,6 +797,39 @@ func (jm *JamManager) APICommand(command string, userName string) (msg string, e
 		} else {
 			return "", fmt.Errorf(p.Sprintf(messageUserNotFound, userName))
 		}
+	case "move":
+		if params.Position < 1 {
+			return "", errors.New(p.Sprintf(messageQueueBadPosition, params.Position))
+		}
+		if !jm.queueManager.MoveTo(userName, params.Position) {
+			return "", errors.New(p.Sprintf(messageQueueUserNotInQueue, userName))
+		}
+		msg = p.Sprintf(messageQueueUserMoved, userName, params.Position)
+	case "swap":
+		if !jm.queueManager.Contains(userName) {
+			return "", errors.New(p.Sprintf(messageQueueUserNotInQueue, userName))
+		}
+		if !jm.queueManager.Swap(userName, params.With) {
+			return "", errors.New(p.Sprintf(messageQueueUserNotInQueue, params.With))
+		}
+		msg = p.Sprintf(messageQueueUsersSwapped, userName, params.With)
+	case "skip":
+		if !jm.queueManager.Skip(userName) {
+			return "", errors.New(p.Sprintf(messageQueueUserNotInQueue, userName))
+		}
+		msg = p.Sprintf(messageQueueUserSkips, userName)
+	case "first":
+		if !jm.queueManager.MoveTo(userName, 0) {
+			return "", errors.New(p.Sprintf(messageQueueUserNotInQueue, userName))
+		}
+		msg = p.Sprintf(messageQueueUserFirst, userName)
+	case "mode":
+		mode, e := ParseQueueMode(strings.Fields(params.Mode))
+		if e != nil {
+			return "", errors.New(p.Sprintf(messageQueueBadMode, params.Mode))
+		}
+		jm.queueManager.SetMode(mode)
+		msg = p.Sprintf(messageQueueMode, mode)
 	default:
 		err = fmt.Errorf(p.Sprintf(messageUnableToRecognizeAPICommand))
 		return
@@ -469,109 +841,100 @@ func (jm *JamManager) APICommand(command string, userName string) (msg string, e
 	return msg, nil
 }
 
-func (jm *JamManager) Command(chatCommand string, userName string) string {
-	defer recoverer()
+func (jm *JamManager) Next() (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
 
-	command := lib.Command(lib.CommandParse(chatCommand))
-
-	switch command.Command {
-	case lib.CommandRandom:
-		return jm.PlayRandom(command)
-	case lib.CommandTrack:
-	case lib.CommandPlaylist:
-		return jm.StartPlaylist(command.ID)
-	case lib.CommandStop:
-		return jm.Stop()
-	case lib.CommandPlay:
-		return jm.Start()
-	case lib.CommandNext:
-		return jm.Next()
-	case lib.CommandPrev:
-	case lib.CommandHelp:
-		return jm.Help()
-	case lib.CommandPlaying:
-		return jm.Playing()
-	case lib.CommandQStart:
-		return jm.QueueStart()
-	case lib.CommandQFinish:
-		return jm.QueueFinish()
-	case lib.CommandQNext:
-		jm.queueManager.next()
-		return ""
-	case lib.CommandQLeave:
-		return jm.QueueLeave(userName)
-	case lib.CommandQJoin:
-		return jm.QueueJoin(userName)
-	default:
-		return p.Sprintf(messageUnableToRecognizeCommand)
+	if err := jm.playerNext(); err != nil {
+		return jm.playerErrorMessage(err)
 	}
+	return jm.playingMessage()
+}
+
+// PlayerNext stops the track and starts the next one of the playlist
+func (jm *JamManager) PlayerNext() error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
 
-	return ""
+	return jm.playerNext()
 }
 
-func (jm *JamManager) Next() (msg string) {
-	msg, _ = jm.next()
-	return
+// playerNext is PlayerNext, playerMtx must be held
+func (jm *JamManager) playerNext() error {
+	if jm.playlist == nil {
+		return &PlayerError{Code: PlayerNoPlaylist}
+	}
+	jm.stop()
+
+	return jm.next()
 }
 
-func (jm *JamManager) next() (msg string, ok bool) {
+// next starts the next track of the playlist after the timeout of the current one.
+// playerMtx must be held, it's released while waiting for the timeout
+func (jm *JamManager) next() (err error) {
 	defer recoverer()
 
-	var listTrack tracks.PlaylistTrack
-	var prevTrack *tracks.PlaylistTrack
 	if jm.playlist == nil {
-		msg = p.Sprintf(errorNoPlaylistSelected)
-		return
+		return &PlayerError{Code: PlayerNoPlaylist}
 	}
-	for i, lTrack := range jm.playlist.Tracks {
-		if lTrack.TrackID == jm.track.ID {
-			prevTrack = &jm.playlist.Tracks[i]
-			continue
-		}
-		// на прошлой итерации нашли текущий трек - берём следующий
-		if prevTrack != nil {
-			listTrack = lTrack
-		}
+	i := jm.playlistIndex()
+	if i < 0 || i+1 >= len(jm.playlist.Tracks) {
+		return &PlayerError{Code: PlayerPlaylistEnd, ID: jm.playlist.ID}
 	}
 
-	var err error
-	if listTrack.TrackID != 0 {
-		jm.track, err = jm.jamDB.Track(listTrack.TrackID)
-		if err == tracks.ErrorNotFound {
-			msg = p.Sprintf(errorTrackNotFound, listTrack.TrackID)
-		} else if err != nil {
-			logrus.Error(err)
-			msg = p.Sprintf(errorGeneral)
-			return
+	// if previous track has timeout - sleep
+	if timeout := jm.playlist.Tracks[i].Timeout; timeout > 0 {
+		timeoutDuration := time.Duration(timeout) * time.Second
+		playlist, track := jm.playlist, jm.track
+		jm.playerMtx.Unlock()
+		time.Sleep(timeoutDuration)
+		jm.playerMtx.Lock()
+		// пока ждали, плеером могли распорядиться команды
+		if jm.playing || jm.playlist != playlist || jm.track != track {
+			return &PlayerError{Code: PlayerAlreadyPlaying}
 		}
+		t := time.Time{}.Add(timeoutDuration)
+		jm.jamChatBot.SendMessage(p.Sprintf(messageTimeout, t.Format("04:05")))
+	}
 
-		// if previous track has timeout - sleep
-		if prevTrack.Timeout > 0 {
-			timeoutDuration := time.Duration(prevTrack.Timeout) * time.Second
-			time.Sleep(timeoutDuration)
-			t := time.Time{}.Add(timeoutDuration)
-			jm.jamChatBot.SendMessage(p.Sprintf(messageTimeout, t.Format("04:05")))
-		}
+	return jm.playlistTrack(i + 1)
+}
 
-		err = jm.LoadTrack(jm.track)
-		if err != nil {
-			msg = p.Sprintf(errorGeneral)
-			return
+// playlistIndex returns the index of the current track in the playlist, -1 if it is not there.
+// playerMtx must be held
+func (jm *JamManager) playlistIndex() int {
+	if jm.playlist == nil || jm.track == nil {
+		return -1
+	}
+	for i, listTrack := range jm.playlist.Tracks {
+		if listTrack.TrackID == jm.track.ID {
+			return i
 		}
-		jm.SetRepeats(listTrack.Repeats)
-		jm.playingMode = playingPlaylist
-
-		msg = jm.Start()
-		ok = true
+	}
+	return -1
+}
 
+// playlistTrack starts the track of the playlist with its repeats, playerMtx must be held
+func (jm *JamManager) playlistTrack(i int) (err error) {
+	listTrack := jm.playlist.Tracks[i]
+	track, err := jm.jamDB.Track(listTrack.TrackID)
+	if err == tracks.ErrorNotFound {
+		return &PlayerError{Code: PlayerTrackNotFound, ID: listTrack.TrackID}
+	} else if err != nil {
 		return
 	}
 
-	// TODO msg playlist ended
+	jm.track = track
+	if err = jm.LoadTrack(jm.track); err != nil {
+		return
+	}
+	jm.setRepeats(listTrack.Repeats)
+	jm.playingMode = playingPlaylist
 
-	return
+	return jm.start()
 }
 
+// onStart is called by the player from Start, so playerMtx is held by the caller of start
 func (jm *JamManager) onStart() {
 	defer recoverer()
 
@@ -580,28 +943,85 @@ func (jm *JamManager) onStart() {
 		return
 	}
 
-	jm.queueManager.OnStart(jm.calcTrackTime(jm.track, jm.repeats), jm.calcTrackIntervalTime(jm.track))
+	if jm.votes != nil {
+		jm.votes.clear(VoteSkip)
+		jm.votes.clear(VoteStop)
+	}
+
+	bpm, bpi := jm.jamPlayer.Tempo()
+	track := lib.SoloContext{
+		TrackID:       jm.track.ID,
+		TrackDuration: jm.calcTrackTime(jm.track, jm.repeats),
+		BPM:           bpm,
+		BPI:           bpi,
+	}
+
+	jm.events.Publish(EventTrackStarted, jm.playerState())
+	jm.queueManager.OnStart(track, jm.soloPolicy())
 }
 
+// soloPolicy returns solo length policy of the current playlist entry or the default one from config.
+// playerMtx must be held
+func (jm *JamManager) soloPolicy() lib.SoloPolicy {
+	if jm.playingMode == playingPlaylist && jm.playlist != nil && jm.track != nil {
+		for _, listTrack := range jm.playlist.Tracks {
+			if listTrack.TrackID == jm.track.ID && listTrack.SoloPolicy != "" {
+				policy := lib.SoloPolicy{Kind: listTrack.SoloPolicy, Value: listTrack.SoloValue}
+				if err := policy.Valid(); err != nil {
+					logrus.Errorf("playlist %d track %d: %s", jm.playlist.ID, jm.track.ID, err)
+					break
+				}
+				return policy
+			}
+		}
+	}
+
+	policy := lib.SoloPolicy{Kind: config.Get().Solo.Policy, Value: config.Get().Solo.Value}
+	if err := policy.Valid(); err != nil {
+		logrus.Errorf("config solo policy: %s", err)
+		return lib.SoloPolicy{}
+	}
+
+	return policy
+}
+
+// onStop is called by the player when the track is over
 func (jm *JamManager) onStop() {
 	defer recoverer()
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	logrus.Debug("onStop function called")
+	// если у нас jm.playing == false значит стоп пришёл т.к. мы сами дали команды на стоп - stop() уже всё сделал,
+	// а если плеер снова играет - пока ждали мьютекс, запустили следующий трек
+	if !jm.playing || jm.jamPlayer != nil && jm.jamPlayer.Playing() {
+		return
+	}
 	jm.playing = false
+	jm.events.Publish(EventTrackStopped, TrackStoppedEvent{Track: jm.track, Finished: true})
 	jm.queueManager.OnStop()
-	logrus.Debug("onStop function called")
-	if jm.playingMode == playingPlaylist {
-		// если у нас jm.playing == false значит стоп пришёл т.к. мы сами дали команды на стоп - тогда ничего не делаем
-		if !jm.playing {
-			// todo msg
+
+	// заказанные треки играют после текущего
+	if msg, ok := jm.playRequest(); ok {
+		jm.jamChatBot.SendMessage(msg)
+		return
+	}
+	if ok, err := jm.resumePlaylist(); ok {
+		if err != nil {
+			jm.jamChatBot.SendMessage(jm.playerErrorMessage(err))
 			return
 		}
+		jm.jamChatBot.SendMessage(jm.playingMessage())
+		return
+	}
 
-		msg, ok := jm.next()
-		if ok {
-			jm.jamChatBot.SendMessage(msg)
+	if jm.playingMode == playingPlaylist {
+		if err := jm.next(); err != nil {
+			jm.jamChatBot.SendMessage(jm.playerErrorMessage(err))
 			return
 		}
-
-		// TODO сообщить что плейлист окончен
+		jm.jamChatBot.SendMessage(jm.playingMessage())
+		return
 	}
 	logrus.Debug("jm.playing = false")
 }
@@ -631,6 +1051,14 @@ func (jm *JamManager) countRepeats(track *tracks.Track, duration time.Duration)
 	return repeats
 }
 
+// barsDuration returns the time to play bars of 4 beats in the track tempo
+func barsDuration(track *tracks.Track, bars uint) time.Duration {
+	if track.BPM == 0 {
+		return 0
+	}
+	return time.Duration(bars) * 4 * time.Minute / time.Duration(track.BPM)
+}
+
 func (mk *JamManager) calcTrackTime(track *tracks.Track, repeats uint) time.Duration {
 	if repeats == 0 ||
 		track.LoopStart == track.LoopEnd || track.LoopEnd < track.LoopStart ||
@@ -642,12 +1070,15 @@ func (mk *JamManager) calcTrackTime(track *tracks.Track, repeats uint) time.Dura
 	return time.Duration(loopDurationMicroS*uint64(repeats)+track.LoopStart+(track.Length-track.LoopEnd)) * time.Microsecond
 }
 
-func (mk *JamManager) calcTrackIntervalTime(track *tracks.Track) time.Duration {
-	intervalTime := (float64(time.Minute) / float64(track.BPM)) * float64(track.BPI)
-	return time.Duration(intervalTime)
+func (jm *JamManager) SetRepeats(repeats uint) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	jm.setRepeats(repeats)
 }
 
-func (jm *JamManager) SetRepeats(repeats uint) {
+// setRepeats is SetRepeats, playerMtx must be held
+func (jm *JamManager) setRepeats(repeats uint) {
 	if jm.jamPlayer == nil {
 		return
 	}
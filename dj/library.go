@@ -0,0 +1,203 @@
+package dj
+
+import (
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/message"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chatPageLines is the number of list lines in one chat reply, the rest is shown page by page
+const chatPageLines = 5
+
+// chatPage returns lines of the page n starting from 1 and the number of pages,
+// n out of range gives the last page
+func chatPage(lines []string, n int) (res []string, page, pages int) {
+	pages = (len(lines) + chatPageLines - 1) / chatPageLines
+	if pages == 0 {
+		return nil, 1, 1
+	}
+	if n < 1 {
+		n = 1
+	}
+	if n > pages {
+		n = pages
+	}
+
+	from := (n - 1) * chatPageLines
+	to := from + chatPageLines
+	if to > len(lines) {
+		to = len(lines)
+	}
+
+	return lines[from:to], n, pages
+}
+
+// pageMessage joins lines of the page with the header and tells how to get the next page,
+// command is the chat command without the page number
+func (jm *JamManager) pageMessage(p *message.Printer, header string, lines []string, n int, command string) string {
+	res, page, pages := chatPage(lines, n)
+	msg := header
+	if len(res) > 0 {
+		msg += "\n" + strings.Join(res, "\n")
+	}
+	if page < pages {
+		msg += "\n" + p.Sprintf(messagePageNext, page, pages,
+			fmt.Sprintf("%s %s %d", jm.jamChatBot.UserName(), command, page+1))
+	}
+
+	return msg
+}
+
+// pageArg parses the optional page number argument, the first page by default
+func pageArg(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 1, true
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func (jm *JamManager) Playlists() (res []tracks.Playlist) {
+	playlists, err := jm.jamDB.Playlists()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+
+	for _, playlist := range playlists {
+		res = append(res, *playlist)
+	}
+
+	return
+}
+
+// PlaylistsMessage lists playlists with track counts and durations, n is the page starting from 1
+func (jm *JamManager) PlaylistsMessage(p *message.Printer, n int) (msg string) {
+	playlists := jm.Playlists()
+	if len(playlists) == 0 {
+		return p.Sprintf(messagePlaylistsEmpty)
+	}
+
+	// длительность считаем только для показываемой страницы, для неё нужно загрузить треки
+	lines := make([]string, len(playlists))
+	_, page, _ := chatPage(lines, n)
+	for i := (page - 1) * chatPageLines; i < len(playlists) && i < page*chatPageLines; i++ {
+		duration, _ := jm.playlistDuration(&playlists[i])
+		lines[i] = p.Sprintf(messagePlaylistLine, playlists[i].ID, playlists[i].Name, len(playlists[i].Tracks), formatDuration(duration))
+		if playlists[i].Description != "" {
+			lines[i] += " - " + playlists[i].Description
+		}
+	}
+
+	return jm.pageMessage(p, p.Sprintf(messagePlaylists, len(playlists)), lines, page, "playlists")
+}
+
+// playlistDuration returns the playing time of the playlist with timeouts and its tracks,
+// missing tracks are nil in the list
+func (jm *JamManager) playlistDuration(playlist *tracks.Playlist) (duration time.Duration, list []*tracks.Track) {
+	for _, listTrack := range playlist.Tracks {
+		track, err := jm.jamDB.Track(listTrack.TrackID)
+		if err != nil {
+			if err != tracks.ErrorNotFound {
+				logrus.Error(err)
+			}
+			list = append(list, nil)
+			continue
+		}
+		list = append(list, track)
+		duration += jm.calcTrackTime(track, listTrack.Repeats) + time.Duration(listTrack.Timeout)*time.Second
+	}
+
+	return
+}
+
+// Info shows details of the track: info 12, or of the playlist: info playlist 3
+func (jm *JamManager) Info(p *message.Printer, args []string) (msg string) {
+	if len(args) > 0 && (args[0] == "playlist" || args[0] == "list") {
+		if len(args) < 2 {
+			return p.Sprintf(messageUnableToRecognizeCommand)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return p.Sprintf(messageUnableToRecognizeCommand)
+		}
+		n, ok := pageArg(args[2:])
+		if !ok {
+			return p.Sprintf(messageUnableToRecognizeCommand)
+		}
+		return jm.PlaylistInfo(p, uint(id), n)
+	}
+
+	if len(args) != 1 {
+		return p.Sprintf(messageUnableToRecognizeCommand)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return p.Sprintf(messageUnableToRecognizeCommand)
+	}
+
+	return jm.TrackInfo(p, uint(id))
+}
+
+func (jm *JamManager) TrackInfo(p *message.Printer, id uint) (msg string) {
+	track, err := jm.jamDB.Track(id)
+	if err == tracks.ErrorNotFound {
+		return p.Sprintf(errorTrackNotFound, id)
+	} else if err != nil {
+		logrus.Error(err)
+		return p.Sprintf(errorGeneral)
+	}
+
+	msg = p.Sprintf(messageTrackInfo, track.ID, track,
+		formatDuration(time.Duration(track.Length)*time.Microsecond), track.BPI)
+	if len(track.Tags) > 0 {
+		var tags []string
+		for _, tag := range track.Tags {
+			tags = append(tags, tag.Name)
+		}
+		msg += "\n" + p.Sprintf(messageTrackTags, strings.Join(tags, ", "))
+	}
+	if track.Author != nil && track.Author.Name != "" {
+		msg += "\n" + p.Sprintf(messageTrackAuthor, track.Author.Name)
+	}
+
+	return
+}
+
+// PlaylistInfo shows the playlist and the page n of its tracks
+func (jm *JamManager) PlaylistInfo(p *message.Printer, id uint, n int) (msg string) {
+	playlist, err := jm.jamDB.Playlist(id)
+	if err == tracks.ErrorNotFound {
+		return p.Sprintf(errorPlaylistNotFound, id)
+	} else if err != nil {
+		logrus.Error(err)
+		return p.Sprintf(errorGeneral)
+	}
+
+	duration, list := jm.playlistDuration(playlist)
+
+	header := p.Sprintf(messagePlaylistLine, playlist.ID, playlist.Name, len(playlist.Tracks), formatDuration(duration))
+	if playlist.Description != "" {
+		header += " - " + playlist.Description
+	}
+
+	lines := make([]string, len(list))
+	for i, track := range list {
+		if track == nil {
+			lines[i] = fmt.Sprintf("%d. ", i+1) + p.Sprintf(errorTrackNotFound, playlist.Tracks[i].TrackID)
+			continue
+		}
+		lines[i] = fmt.Sprintf("%d. [%d] %s, %s", i+1, track.ID, track,
+			formatDuration(jm.calcTrackTime(track, playlist.Tracks[i].Repeats)))
+	}
+
+	return jm.pageMessage(p, header, lines, n, fmt.Sprintf("info playlist %d", playlist.ID))
+}
@@ -0,0 +1,92 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-chatbot/models"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testChatBot struct {
+	users    []string
+	messages []string
+}
+
+func (b *testChatBot) SendMessage(msg string)                    { b.messages = append(b.messages, msg) }
+func (b *testChatBot) SendAdminMessage(string)                   {}
+func (b *testChatBot) UserName() string                          { return "dj" }
+func (b *testChatBot) SetOnUserinfoChange(func(models.UserInfo)) {}
+func (b *testChatBot) Users() []string                           { return b.users }
+
+func Test_chatPage(t *testing.T) {
+	lines := []string{"1", "2", "3", "4", "5", "6", "7"}
+
+	res, page, pages := chatPage(lines, 1)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, res)
+	assert.Equal(t, 1, page)
+	assert.Equal(t, 2, pages)
+
+	res, page, pages = chatPage(lines, 2)
+	assert.Equal(t, []string{"6", "7"}, res)
+	assert.Equal(t, 2, page)
+
+	res, page, _ = chatPage(lines, 10)
+	assert.Equal(t, []string{"6", "7"}, res)
+	assert.Equal(t, 2, page)
+
+	res, page, pages = chatPage(nil, 1)
+	assert.Empty(t, res)
+	assert.Equal(t, 1, page)
+	assert.Equal(t, 1, pages)
+}
+
+func TestJamManager_PlaylistInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dj")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := tracks.NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	playlist := &tracks.Playlist{Name: "Blues"}
+	for i := 0; i < 7; i++ {
+		// 60 секунд, из них цикл 40
+		track := &tracks.Track{Title: "Track", Length: 60000000, LoopStart: 10000000, LoopEnd: 50000000}
+		if !assert.NoError(t, jdb.DB().Save(track).Error) {
+			return
+		}
+		playlist.Tracks = append(playlist.Tracks, tracks.PlaylistTrack{TrackID: track.ID, Repeats: 1, Timeout: 10})
+	}
+	playlist.Tracks = append(playlist.Tracks, tracks.PlaylistTrack{TrackID: 100})
+	if !assert.NoError(t, jdb.DB().Save(playlist).Error) {
+		return
+	}
+
+	jm := &JamManager{jamDB: jdb, jamChatBot: &testChatBot{}}
+
+	msg := jm.PlaylistInfo(p, playlist.ID, 1)
+	lines := strings.Split(msg, "\n")
+	if assert.Len(t, lines, 7) {
+		assert.Equal(t, p.Sprintf(messagePlaylistLine, playlist.ID, "Blues", 8, "8:10"), lines[0])
+		assert.Equal(t, p.Sprintf(messagePageNext, 1, 2, "dj info playlist 1 2"), lines[6])
+	}
+
+	msg = jm.PlaylistInfo(p, playlist.ID, 2)
+	lines = strings.Split(msg, "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, "8. "+p.Sprintf(errorTrackNotFound, 100), lines[3])
+	}
+
+	assert.Equal(t, p.Sprintf(errorPlaylistNotFound, 5), jm.Info(p, []string{"playlist", "5"}))
+	assert.Equal(t, p.Sprintf(messagePlaylists, 1)+"\n"+p.Sprintf(messagePlaylistLine, playlist.ID, "Blues", 8, "8:10"),
+		jm.PlaylistsMessage(p, 1))
+}
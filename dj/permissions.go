@@ -0,0 +1,48 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/auth"
+	"github.com/ayvan/ninjam-dj-bot/config"
+	"github.com/sirupsen/logrus"
+)
+
+// RoleDB keeps roles of NINJAM users
+type RoleDB interface {
+	RoleOf(userName string) (auth.Role, error)
+}
+
+// SetRoleDB sets the storage of user roles, without it roles come from the config only
+func (jm *JamManager) SetRoleDB(roles RoleDB) {
+	jm.roles = roles
+}
+
+// role returns the role of the NINJAM user: the one from the roles DB, admin for users listed
+// in the admins section of the config or the default role from the config
+func (jm *JamManager) role(userName string) auth.Role {
+	if jm.roles != nil {
+		role, err := jm.roles.RoleOf(userName)
+		if err == nil {
+			return role
+		}
+		if err != auth.ErrorNotFound {
+			logrus.Errorf("role of %s: %s", userName, err)
+		}
+	}
+
+	for _, admin := range config.Get().Admins {
+		if admin == userName || admin == cleanName(userName) {
+			return auth.RoleAdmin
+		}
+	}
+
+	if config.Get().DefaultRole == "" {
+		return auth.RoleMusician
+	}
+	role, err := auth.ParseRole(config.Get().DefaultRole)
+	if err != nil {
+		logrus.Errorf("config default role: %s", err)
+		return auth.RoleGuest
+	}
+
+	return role
+}
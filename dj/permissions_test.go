@@ -0,0 +1,37 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/auth"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testRoles map[string]auth.Role
+
+func (r testRoles) RoleOf(userName string) (auth.Role, error) {
+	if role, ok := r[userName]; ok {
+		return role, nil
+	}
+	if role, ok := r[cleanName(userName)]; ok {
+		return role, nil
+	}
+	return auth.RoleUnknown, auth.ErrorNotFound
+}
+
+func TestJamManager_Command_permissions(t *testing.T) {
+	jm := &JamManager{queueManager: NewQueueManager("dj", nil, nil)}
+	jm.SetRoleDB(testRoles{"guest": auth.RoleGuest, "musician": auth.RoleMusician})
+
+	assert.Equal(t, p.Sprintf(messagePermissionDenied, auth.RoleDJ), jm.Command("stop", "guest@1.2.3.x"))
+	assert.Equal(t, p.Sprintf(messagePermissionDenied, auth.RoleMusician), jm.Command("qjoin", "guest@1.2.3.x"))
+	assert.Equal(t, p.Sprintf(messagePermissionDenied, auth.RoleAdmin), jm.Command("qmode duet", "musician@1.2.3.x"))
+	assert.Equal(t, p.Sprintf(messageQueueMode, QueueMode{Kind: QueueModeRoundRobin}), jm.Command("qmode", "guest@1.2.3.x"))
+	assert.Equal(t, p.Sprintf(messageQueueUserJoined, "musician@1.2.3.x"), jm.Command("qjoin", "musician@1.2.3.x"))
+}
+
+func Test_chatCommand_requiredRole(t *testing.T) {
+	assert.Equal(t, auth.RoleGuest, commands.lookup("help").requiredRole(false))
+	assert.Equal(t, auth.RoleGuest, commands.lookup("qmode").requiredRole(false))
+	assert.Equal(t, auth.RoleAdmin, commands.lookup("qmode").requiredRole(true))
+	assert.Equal(t, auth.RoleDJ, commands.lookup("stop").requiredRole(false))
+}
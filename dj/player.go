@@ -0,0 +1,215 @@
+package dj
+
+import (
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// PlayerErrorCode tells API clients why a player action failed
+type PlayerErrorCode string
+
+const (
+	PlayerAlreadyPlaying   PlayerErrorCode = "already_playing"
+	PlayerNotPlaying       PlayerErrorCode = "not_playing"
+	PlayerAlreadyPaused    PlayerErrorCode = "already_paused"
+	PlayerNotPaused        PlayerErrorCode = "not_paused"
+	PlayerNoTrack          PlayerErrorCode = "no_track"
+	PlayerNoPlaylist       PlayerErrorCode = "no_playlist"
+	PlayerPlaylistEmpty    PlayerErrorCode = "playlist_empty"
+	PlayerPlaylistEnd      PlayerErrorCode = "playlist_end"
+	PlayerPlaylistStart    PlayerErrorCode = "playlist_start"
+	PlayerTrackNotFound    PlayerErrorCode = "track_not_found"
+	PlayerPlaylistNotFound PlayerErrorCode = "playlist_not_found"
+	PlayerNoMatchingTrack  PlayerErrorCode = "no_matching_track"
+)
+
+// PlayerError is the reason a player action can't be done, other errors of player actions are internal ones
+type PlayerError struct {
+	Code PlayerErrorCode
+	ID   uint // track or playlist the error is about
+}
+
+func (e *PlayerError) Error() string {
+	switch e.Code {
+	case PlayerAlreadyPlaying:
+		return "the track is playing already"
+	case PlayerNotPlaying:
+		return "no track is playing"
+	case PlayerAlreadyPaused:
+		return "the track is paused already"
+	case PlayerNotPaused:
+		return "the track is not paused"
+	case PlayerNoTrack:
+		return "track not selected"
+	case PlayerNoPlaylist:
+		return "no playlist selected"
+	case PlayerPlaylistEmpty:
+		return fmt.Sprintf("playlist %d is empty", e.ID)
+	case PlayerPlaylistEnd:
+		return fmt.Sprintf("playlist %d has no next track", e.ID)
+	case PlayerPlaylistStart:
+		return fmt.Sprintf("playlist %d has no previous track", e.ID)
+	case PlayerTrackNotFound:
+		return fmt.Sprintf("track %d not found", e.ID)
+	case PlayerPlaylistNotFound:
+		return fmt.Sprintf("playlist %d not found", e.ID)
+	case PlayerNoMatchingTrack:
+		return "no track matches"
+	}
+	return string(e.Code)
+}
+
+// playerErrorMessage returns the chat reply to the failed player action
+func (jm *JamManager) playerErrorMessage(err error) string {
+	playerErr, ok := err.(*PlayerError)
+	if !ok {
+		logrus.Error(err)
+		return p.Sprintf(errorGeneral)
+	}
+
+	switch playerErr.Code {
+	case PlayerAlreadyPlaying:
+		return p.Sprintf(messageAlreadyStarted)
+	case PlayerNotPlaying:
+		return p.Sprintf(messageVoteNothingPlaying)
+	case PlayerNoTrack:
+		return p.Sprintf(errorTrackNotSelected)
+	case PlayerNoPlaylist:
+		return p.Sprintf(errorNoPlaylistSelected)
+	case PlayerPlaylistEmpty:
+		return p.Sprintf(errorPlaylistIsEmpty, playerErr.ID)
+	case PlayerPlaylistEnd:
+		return p.Sprintf(messagePlaylistFinished)
+	case PlayerTrackNotFound:
+		return p.Sprintf(errorTrackNotFound, playerErr.ID)
+	case PlayerPlaylistNotFound:
+		return p.Sprintf(errorPlaylistNotFound, playerErr.ID)
+	case PlayerNoMatchingTrack:
+		return p.Sprintf(messageCantStartRandomTrack)
+	}
+
+	// паузы и предыдущего трека в чате нет
+	logrus.Error(err)
+	return p.Sprintf(errorGeneral)
+}
+
+// PlayerPrev stops the track and starts the previous one of the playlist
+func (jm *JamManager) PlayerPrev() error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	if jm.playlist == nil {
+		return &PlayerError{Code: PlayerNoPlaylist}
+	}
+	i := jm.playlistIndex()
+	if i < 1 {
+		return &PlayerError{Code: PlayerPlaylistStart, ID: jm.playlist.ID}
+	}
+	jm.stop()
+
+	return jm.playlistTrack(i - 1)
+}
+
+// PlayerPause stops sending the track to the server keeping its position
+func (jm *JamManager) PlayerPause() error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	if !jm.playing || jm.jamPlayer == nil {
+		return &PlayerError{Code: PlayerNotPlaying}
+	}
+	if jm.jamPlayer.Paused() {
+		return &PlayerError{Code: PlayerAlreadyPaused}
+	}
+	jm.jamPlayer.Pause()
+
+	return nil
+}
+
+// PlayerResume continues the paused track
+func (jm *JamManager) PlayerResume() error {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	if !jm.playing || jm.jamPlayer == nil {
+		return &PlayerError{Code: PlayerNotPlaying}
+	}
+	if !jm.jamPlayer.Paused() {
+		return &PlayerError{Code: PlayerNotPaused}
+	}
+	jm.jamPlayer.Resume()
+
+	return nil
+}
+
+// PlayerState is what the player is doing, times are in seconds
+type PlayerState struct {
+	Mode        string         `json:"mode"` // track, playlist or empty if nothing was started
+	Playing     bool           `json:"playing"`
+	Paused      bool           `json:"paused"`
+	Track       *tracks.Track  `json:"track"`
+	Playlist    *PlaylistState `json:"playlist"`
+	RepeatsLeft uint           `json:"repeats_left"`
+	Duration    float64        `json:"duration"` // playing time of the track with repeats
+	Elapsed     float64        `json:"elapsed"`
+	Remaining   float64        `json:"remaining"`
+	BPM         uint           `json:"bpm"`
+	BPI         uint           `json:"bpi"`
+}
+
+// PlaylistState is the position in the playing playlist
+type PlaylistState struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"` // position of the track starting from 1
+	Tracks   int    `json:"tracks"`
+}
+
+// PlayerState returns the state of the player
+func (jm *JamManager) PlayerState() PlayerState {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	return jm.playerState()
+}
+
+// playerState is PlayerState, playerMtx must be held
+func (jm *JamManager) playerState() (state PlayerState) {
+	switch jm.playingMode {
+	case playingTrack:
+		state.Mode = "track"
+	case playingPlaylist:
+		state.Mode = "playlist"
+	}
+	state.Playing = jm.playing
+	state.Track = jm.track
+
+	if jm.playingMode == playingPlaylist && jm.playlist != nil {
+		state.Playlist = &PlaylistState{
+			ID:       jm.playlist.ID,
+			Name:     jm.playlist.Name,
+			Position: jm.playlistIndex() + 1,
+			Tracks:   len(jm.playlist.Tracks),
+		}
+	}
+
+	if jm.track != nil {
+		state.Duration = jm.calcTrackTime(jm.track, jm.repeats).Seconds()
+	}
+	if jm.jamPlayer == nil || !jm.playing {
+		return
+	}
+
+	state.Paused = jm.jamPlayer.Paused()
+	state.RepeatsLeft = jm.jamPlayer.Repeats()
+	state.BPM, state.BPI = jm.jamPlayer.Tempo()
+	elapsed := jm.jamPlayer.Elapsed()
+	state.Elapsed = elapsed.Seconds()
+	if remaining := time.Duration(state.Duration*float64(time.Second)) - elapsed; remaining > 0 {
+		state.Remaining = remaining.Seconds()
+	}
+
+	return
+}
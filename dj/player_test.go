@@ -0,0 +1,115 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestJamManager_Player(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dj")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := tracks.NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	playlist := &tracks.Playlist{Name: "Blues"}
+	var list []*tracks.Track
+	for i := 0; i < 3; i++ {
+		track := &tracks.Track{Title: "Track", Length: 60000000, LoopStart: 10000000, LoopEnd: 50000000}
+		if !assert.NoError(t, jdb.DB().Save(track).Error) {
+			return
+		}
+		list = append(list, track)
+		playlist.Tracks = append(playlist.Tracks, tracks.PlaylistTrack{TrackID: track.ID, Repeats: 1})
+	}
+	empty := &tracks.Playlist{Name: "Empty"}
+	if !assert.NoError(t, jdb.DB().Save(playlist).Error) || !assert.NoError(t, jdb.DB().Save(empty).Error) {
+		return
+	}
+
+	jm := &JamManager{jamDB: jdb, jamChatBot: &testChatBot{}}
+
+	assert.Equal(t, &PlayerError{Code: PlayerTrackNotFound, ID: 100}, jm.PlayerTrack(100))
+	assert.Equal(t, &PlayerError{Code: PlayerPlaylistNotFound, ID: 100}, jm.PlayerPlaylist(100))
+	assert.Equal(t, &PlayerError{Code: PlayerPlaylistEmpty, ID: empty.ID}, jm.PlayerPlaylist(empty.ID))
+	assert.Equal(t, &PlayerError{Code: PlayerNotPlaying}, jm.PlayerStop())
+	assert.Equal(t, &PlayerError{Code: PlayerNotPlaying}, jm.PlayerPause())
+	assert.Equal(t, &PlayerError{Code: PlayerNoPlaylist}, jm.PlayerNext())
+	assert.Equal(t, &PlayerError{Code: PlayerNoTrack}, jm.PlayerStart())
+	assert.Equal(t, PlayerState{}, jm.PlayerState())
+
+	// плеера нет, поэтому выбираем трек плейлиста вручную
+	loaded, _ := jdb.Playlist(playlist.ID)
+	jm.playlist, jm.track, jm.repeats, jm.playingMode = loaded, list[1], 2, playingPlaylist
+
+	state := jm.PlayerState()
+	assert.Equal(t, "playlist", state.Mode)
+	assert.Equal(t, &PlaylistState{ID: playlist.ID, Name: "Blues", Position: 2, Tracks: 3}, state.Playlist)
+	assert.Equal(t, 100.0, state.Duration)
+
+	jm.track = list[0]
+	assert.Equal(t, &PlayerError{Code: PlayerPlaylistStart, ID: playlist.ID}, jm.PlayerPrev())
+	jm.track = list[2]
+	assert.Equal(t, &PlayerError{Code: PlayerPlaylistEnd, ID: playlist.ID}, jm.next())
+
+	assert.Equal(t, p.Sprintf(messagePlaylistFinished), jm.playerErrorMessage(jm.next()))
+	assert.Equal(t, p.Sprintf(errorTrackNotFound, 100), jm.StartTrack(100))
+	assert.Equal(t, p.Sprintf(errorPlaylistIsEmpty, empty.ID), jm.StartPlaylist(empty.ID))
+}
+
+func TestJamManager_PlayerConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dj")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := tracks.NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	track := &tracks.Track{Title: "Track", Length: 60000000}
+	if !assert.NoError(t, jdb.DB().Save(track).Error) {
+		return
+	}
+
+	jm := &JamManager{jamDB: jdb, jamChatBot: &testChatBot{}}
+
+	// API, чат и плеер обращаются к состоянию плеера одновременно, гонки ловит go test -race
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			jm.PlayerTrack(track.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			jm.PlayerPause()
+		}()
+		go func() {
+			defer wg.Done()
+			jm.Stop()
+		}()
+		go func() {
+			defer wg.Done()
+			jm.PlayerState()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, track.ID, jm.PlayerState().Track.ID)
+}
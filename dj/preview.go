@@ -0,0 +1,157 @@
+package dj
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/burillo-se/lv2host-go/lv2host"
+	"github.com/hajimehoshi/go-mp3"
+	"io"
+	"math"
+	"os"
+	"path"
+	"time"
+)
+
+// MaxPreviewRepeats limits loop repeats of the track preview
+const MaxPreviewRepeats = 10
+
+// Preview renders the track the way the player plays it: processed by LV2 plugins of the player
+// with the loop repeated repeats times, and writes it to w as 16-bit stereo WAV.
+// Previews are rendered one at a time, the track being played is not affected.
+func (jp *JamPlayer) Preview(track *tracks.Track, repeats uint, w io.Writer) error {
+	if repeats > MaxPreviewRepeats {
+		return fmt.Errorf("repeats must be %d or less", MaxPreviewRepeats)
+	}
+
+	jp.previewMtx.Lock()
+	defer jp.previewMtx.Unlock()
+
+	file, err := os.Open(path.Join(jp.tracksPath, track.FilePath))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		return fmt.Errorf("NewDecoder error in %s: %s", track.FilePath, err)
+	}
+	sampleRate := decoder.SampleRate()
+
+	// громкость в конфиге - загруженного трека, для превью нужна своя
+	hostConfig, err := jp.trackHostConfig(track)
+	if err != nil {
+		return err
+	}
+	host, err := jp.prepareLV2Host(float64(sampleRate), hostConfig)
+	if err != nil {
+		return err
+	}
+	lv2host.Activate(host)
+	defer lv2host.Free(host)
+
+	// плагины обрабатывают звук такими же блоками, как при игре трека
+	var bpm, bpi uint = 100, 16
+	if track.BPM > 0 {
+		bpm = track.BPM
+	}
+	if track.BPI > 0 {
+		bpi = track.BPI
+	}
+	intervalTime := (float64(time.Minute) / float64(bpm)) * float64(bpi)
+	intervalSamples := int(math.Ceil(float64(sampleRate) * intervalTime / float64(time.Second)))
+
+	samples := make([][]float32, channels)
+	for {
+		interval, err := readInterval(decoder, host, intervalSamples*channels)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for i := 0; i < channels; i++ {
+			samples[i] = append(samples[i], interval[i]...)
+		}
+	}
+	if len(samples[0]) == 0 {
+		return fmt.Errorf("track %d has no audio", track.ID)
+	}
+
+	loopStartPos := timeToSamples(time.Duration(track.LoopStart)*time.Microsecond, sampleRate) - 1
+	loopEndPos := timeToSamples(time.Duration(track.LoopEnd)*time.Microsecond, sampleRate) - 1
+	if loopEndPos <= loopStartPos {
+		repeats = 0
+	}
+
+	var rendered [][][]float32
+	length := 0
+	for pos, last := 0, false; !last; {
+		var interval [][]float32
+		var loops uint
+		interval, pos, loops, last = cutInterval(samples, pos, loopStartPos, loopEndPos, intervalSamples, repeats)
+		if loops > repeats {
+			loops = repeats
+		}
+		repeats -= loops
+		rendered = append(rendered, interval)
+		length += len(interval[0])
+	}
+
+	return writeWAV(w, sampleRate, length, rendered)
+}
+
+// writeWAV writes 16-bit stereo WAV of length samples per channel taken from the intervals
+func writeWAV(w io.Writer, sampleRate, length int, intervals [][][]float32) error {
+	const bytesPerSample = 2
+	dataSize := uint32(length * channels * bytesPerSample)
+
+	bw := bufio.NewWriter(w)
+	header := []interface{}{
+		[]byte("RIFF"), 36 + dataSize, []byte("WAVE"),
+		[]byte("fmt "), uint32(16), uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * bytesPerSample), uint16(channels * bytesPerSample), uint16(bytesPerSample * 8),
+		[]byte("data"), dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	sample := make([]byte, bytesPerSample)
+	for _, interval := range intervals {
+		for i := range interval[0] {
+			for c := 0; c < channels; c++ {
+				binary.LittleEndian.PutUint16(sample, uint16(Float32ToInt16(interval[c][i])))
+				if _, err := bw.Write(sample); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Float32ToInt16 converts the sample back to 16 bits, clipping it if plugins made it louder than full scale
+func Float32ToInt16(s float32) int16 {
+	v := math.Round(float64(s) * (math.MaxInt16 + 1))
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// Preview renders the track with the loop repeated repeats times as WAV
+func (jm *JamManager) Preview(track *tracks.Track, repeats uint, w io.Writer) error {
+	if jm.jamPlayer == nil {
+		return fmt.Errorf("no player")
+	}
+	return jm.jamPlayer.Preview(track, repeats, w)
+}
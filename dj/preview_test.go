@@ -0,0 +1,95 @@
+package dj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/burillo-se/lv2hostconfig"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func Test_cutInterval(t *testing.T) {
+	// 10 сэмплов, цикл с 2 по 5
+	s := make([][]float32, channels)
+	for i := 0; i < 10; i++ {
+		for c := 0; c < channels; c++ {
+			s[c] = append(s[c], float32(i))
+		}
+	}
+
+	res, next, loops, last := cutInterval(s, 0, 2, 5, 4, 1)
+	assert.Equal(t, []float32{0, 1, 2, 3}, res[0])
+	assert.Equal(t, 4, next)
+	assert.Equal(t, uint(0), loops)
+	assert.False(t, last)
+
+	res, next, loops, last = cutInterval(s, next, 2, 5, 4, 1)
+	assert.Equal(t, []float32{4, 5, 2, 3}, res[1])
+	assert.Equal(t, uint(1), loops)
+	assert.False(t, last)
+
+	// повторов не осталось - играем до конца
+	res, next, loops, last = cutInterval(s, next, 2, 5, 4, 0)
+	assert.Equal(t, []float32{4, 5, 6, 7}, res[0])
+	res, next, loops, last = cutInterval(s, next, 2, 5, 4, 0)
+	assert.Equal(t, []float32{8, 9}, res[0])
+	assert.Equal(t, 10, next)
+	assert.True(t, last)
+}
+
+func Test_writeWAV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	intervals := [][][]float32{{{0, 0.5}, {-1, 2}}, {{0.25}, {0}}}
+	assert.NoError(t, writeWAV(buf, 44100, 3, intervals))
+
+	data := buf.Bytes()
+	if !assert.Len(t, data, 44+3*channels*2) {
+		return
+	}
+	assert.Equal(t, "RIFF", string(data[:4]))
+	assert.Equal(t, "WAVE", string(data[8:12]))
+	assert.Equal(t, uint32(44100), binary.LittleEndian.Uint32(data[24:28]))
+	assert.Equal(t, uint32(3*channels*2), binary.LittleEndian.Uint32(data[40:44]))
+
+	samples := make([]int16, 6)
+	assert.NoError(t, binary.Read(bytes.NewReader(data[44:]), binary.LittleEndian, samples))
+	assert.Equal(t, []int16{0, math.MinInt16, 16384, math.MaxInt16, 8192, 0}, samples)
+}
+
+func TestFloat32ToInt16(t *testing.T) {
+	for _, s := range []int16{0, 1, -1, 1000, math.MaxInt16, math.MinInt16} {
+		assert.Equal(t, s, Float32ToInt16(Int16ToFloat32(s)))
+	}
+}
+
+func TestJamPlayer_trackHostConfig(t *testing.T) {
+	hostConfig := lv2hostconfig.NewLV2HostConfig()
+	plugin := lv2hostconfig.NewLV2PluginConfig()
+	plugin.PluginURI = "http://calf.sourceforge.net/plugins/MultibandLimiter"
+	plugin.DataFmt["gain"] = "reference - integrated"
+	hostConfig.Plugins = append(hostConfig.Plugins, plugin)
+	hostConfig.ValueMap["reference"] = float32(-16)
+
+	jp := &JamPlayer{hostConfig: hostConfig}
+	setLoudness(hostConfig, &tracks.Track{Integrated: -20})
+
+	// у превью громкость своего трека, конфиг загруженного трека не меняется
+	config, err := jp.trackHostConfig(&tracks.Track{Integrated: -10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, config.Evaluate())
+	assert.Equal(t, float32(-6), config.Plugins[0].Data["gain"])
+	assert.Equal(t, -20.0, hostConfig.ValueMap["integrated"])
+	assert.Empty(t, hostConfig.Plugins[0].Data)
+
+	_, err = (&JamPlayer{}).trackHostConfig(&tracks.Track{})
+	assert.Error(t, err)
+
+	// ошибка выражения возвращается, а не завершает бота
+	hostConfig.Plugins[0].DataFmt["gain"] = "reference -"
+	_, err = jp.prepareLV2Host(44100, hostConfig)
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// QueueHistory stores queue sessions and turns
+type QueueHistory interface {
+	SessionStart(startedAt time.Time)
+	SessionStop(stoppedAt time.Time)
+	Turn(turn tracks.QueueTurn)
+}
+
+// QueueWaiting is a user waiting for their turn
+type QueueWaiting struct {
+	UserName string    `json:"user_name"`
+	Since    time.Time `json:"since"`   // end of the last turn or time the user joined the queue
+	Seconds  uint      `json:"seconds"` // time waiting
+}
+
+// dbQueueHistory writes queue history to the tracks DB
+type dbQueueHistory struct {
+	db        tracks.JamTracksDB
+	sessionID uint
+}
+
+func newDBQueueHistory(db tracks.JamTracksDB) *dbQueueHistory {
+	return &dbQueueHistory{db: db}
+}
+
+func (h *dbQueueHistory) SessionStart(startedAt time.Time) {
+	session, err := h.db.QueueSessionStart(startedAt)
+	if err != nil {
+		logrus.Errorf("queue session start: %s", err)
+		return
+	}
+	h.sessionID = session.ID
+}
+
+func (h *dbQueueHistory) SessionStop(stoppedAt time.Time) {
+	if h.sessionID == 0 {
+		return
+	}
+	if err := h.db.QueueSessionStop(h.sessionID, stoppedAt); err != nil {
+		logrus.Errorf("queue session %d stop: %s", h.sessionID, err)
+	}
+	h.sessionID = 0
+}
+
+func (h *dbQueueHistory) Turn(turn tracks.QueueTurn) {
+	turn.SessionID = h.sessionID
+	if err := h.db.QueueTurnAdd(&turn); err != nil {
+		logrus.Errorf("queue turn of %s: %s", turn.UserName, err)
+	}
+}
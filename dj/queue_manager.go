@@ -1,52 +1,94 @@
 package dj
 
 import (
+	"fmt"
 	"github.com/ayvan/ninjam-chatbot/models"
 	"github.com/ayvan/ninjam-dj-bot/lib"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
 	"github.com/sirupsen/logrus"
+	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// QueueManager keeps the order of musicians taking turns to solo.
+// All state is guarded by mtx, chat and voice announcements are collected while
+// the lock is held and sent only after it has been released.
 type QueueManager struct {
-	botName           string
+	botName          string
+	sendMessage      func(msg string)
+	sendVoiceMessage func(msg string)
+
+	mtx               sync.Mutex
+	users             []string // users[0] is the current soloist, the rest wait in order
 	userStartTime     *time.Time
 	delayedStartTime  *time.Time
-	userStartsPlaying *user
-
+	userStartsPlaying string
 	userPlayDuration  time.Duration
+	soloPolicy        lib.SoloPolicy
+	track             lib.SoloContext // track the queue plays over, its duration is 0 if there is no track
+	trackStartTime    time.Time       // start of the first track interval, turns change on interval boundaries
 	trackEndTime      time.Time
-	sendMessage       func(msg string)
-	sendVoiceMessage  func(msg string)
-	first             *user
-	current           *user
 	after15SecMsgSent bool // флаг что сообщение messageAfter15Seconds уже отправлено
-	mtx               *sync.Mutex
+	stopped           bool
+	skip              map[string]bool // users who pass their next turn keeping their place
+	announcements     []announcement
+
+	serverBPM, serverBPI uint                 // server tempo, used to measure intervals when no track is playing
+	idleIntervals        uint                 // silent intervals after which the current user loses the turn, 0 disables
+	maxIdleTurns         uint                 // idle turns in a row after which the user is removed from queue, 0 never removes
+	lastActivity         map[string]time.Time // time of the last non-silent interval received from the user
+	idleTurns            map[string]uint
+	subscribe            func(userNames []string) // subscription to intervals of the queue members
+	subscribed           string                   // the queue members subscribed to, to subscribe on changes only
+
+	mode        QueueMode
+	played      map[string]bool // users who have played in the current round of random mode
+	tradeLineup string          // users trading bars, the lineup is announced when it changes
+
+	history      QueueHistory
+	records      []func(h QueueHistory) // history records made while mtx is held, written by flush
+	turns        []*tracks.QueueTurn    // open turns of the current players
+	sessionOpen  bool
+	waitingSince map[string]time.Time // end of the last turn of the user or time they joined the queue
+
+	flushMtx sync.Mutex // keeps announcements and history records in order
+
+	events     *EventBus
+	turnEvents []TurnEvent // turns started while mtx is held, published by flush
+	queueEvent string      // the last published queue state to publish only changes
 
-	stopped     bool
 	stopChannel chan bool
+	closeOnce   sync.Once
 }
 
-type user struct {
-	Name string
-	Prev *user
-	Next *user
+type announcement struct {
+	text  string
+	voice string
 }
 
 func NewQueueManager(botName string, sendMessageFunc, sendVoiceMessageFunc func(msg string)) *QueueManager {
 	qm := &QueueManager{botName: botName, sendMessage: sendMessageFunc, sendVoiceMessage: sendVoiceMessageFunc}
-	qm.stopChannel = make(chan bool, 1)
-	qm.mtx = new(sync.Mutex)
+	qm.stopChannel = make(chan bool)
 	qm.stopped = true
+	qm.skip = make(map[string]bool)
+	qm.lastActivity = make(map[string]time.Time)
+	qm.idleTurns = make(map[string]uint)
+	qm.waitingSince = make(map[string]time.Time)
+	qm.played = make(map[string]bool)
+	qm.mode = QueueMode{Kind: QueueModeRoundRobin}
 	go qm.supervisor()
 
 	return qm
 }
 
+// Close stops the supervisor, it may be called more than once
 func (qm *QueueManager) Close() {
-	qm.stopChannel <- true
-	close(qm.stopChannel)
+	qm.closeOnce.Do(func() {
+		close(qm.stopChannel)
+	})
 }
 
 func (qm *QueueManager) supervisor() {
@@ -55,36 +97,7 @@ func (qm *QueueManager) supervisor() {
 	for {
 		select {
 		case <-ticker.C:
-			if qm.stopped {
-				continue
-			}
-			if qm.delayedStartTime != nil && qm.delayedStartTime.Before(time.Now()) {
-				qm.delayedStartTime = nil
-				qm.start(0)
-				continue
-			}
-			if qm.userStartTime == nil {
-				continue
-			}
-			// если до конца трека осталось менее чем qm.userPlayDuration то ничего не делаем
-			if qm.trackEndTime.After(time.Now()) && qm.trackEndTime.Sub(time.Now()) < time.Second*15 {
-				continue
-			}
-			if qm.userStartTime.Add(qm.userPlayDuration).Before(time.Now()) &&
-				qm.userStartTime.Add(qm.userPlayDuration+time.Second*15).After(time.Now()) {
-				if qm.current != nil && qm.current.Next != nil && qm.sendMessage != nil && !qm.after15SecMsgSent {
-					qm.sendMessage(p.Sprintf(messageAfter15Seconds, qm.current.Next.Name))
-					if qm.sendVoiceMessage != nil {
-						qm.sendVoiceMessage(p.Sprintf(messageAfter15Seconds, cleanName(qm.current.Next.Name)))
-					}
-					qm.after15SecMsgSent = true
-				}
-				continue
-			}
-			if qm.userStartTime.Add(qm.userPlayDuration).After(time.Now()) {
-				continue
-			}
-			qm.next()
+			qm.tick(time.Now())
 		case <-qm.stopChannel:
 			ticker.Stop()
 			return
@@ -92,296 +105,717 @@ func (qm *QueueManager) supervisor() {
 	}
 }
 
-func (qm *QueueManager) UsersCount() (i uint) {
-	users := qm.Users()
-	return uint(len(users))
-}
+func (qm *QueueManager) tick(now time.Time) {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
 
-func (qm *QueueManager) Users() (users []string) {
-	if qm.current == nil {
+	if qm.stopped {
 		return
 	}
-
-	i := 0
-	curr := qm.current
-	for {
-		users = append(users, curr.Name)
-		i++
-		if curr.Next == nil {
-			return
-		}
-		curr = curr.Next
-
-		// shit happened...
-		if i > 1000 {
-			i = 0
-			return
+	if qm.delayedStartTime != nil && qm.delayedStartTime.Before(now) {
+		qm.delayedStartTime = nil
+		qm.start(0)
+		return
+	}
+	if qm.userStartTime == nil {
+		return
+	}
+	if qm.checkIdle(now) {
+		return
+	}
+	// если до конца трека осталось менее 15 секунд то ничего не делаем
+	if qm.trackEndTime.After(now) && qm.trackEndTime.Sub(now) < time.Second*15 {
+		return
+	}
+	turnEnd := qm.userStartTime.Add(qm.userPlayDuration)
+	// при обмене квадратами ходы короткие, переключаем без предупреждения
+	if qm.mode.Kind != QueueModeTrade && turnEnd.Before(now) && turnEnd.Add(time.Second*15).After(now) {
+		if size := qm.groupSize(); len(qm.users) > size && !qm.after15SecMsgSent {
+			qm.announcements = append(qm.announcements, groupAnnouncement(messageAfter15Seconds, messageAfter15SecondsDuet, qm.group(size)))
+			qm.after15SecMsgSent = true
 		}
+		return
+	}
+	if turnEnd.After(now) {
+		return
 	}
+	qm.next()
 }
 
-func (qm *QueueManager) Add(userName string) bool {
-	if userName == qm.botName {
+// checkIdle passes the turn of the current players on if nothing was heard from them
+// for idleIntervals intervals, repeat offenders are removed from queue, mtx must be held
+func (qm *QueueManager) checkIdle(now time.Time) bool {
+	size := qm.groupSize()
+	if qm.idleIntervals == 0 || len(qm.users) <= size || qm.userStartTime == nil {
+		return false
+	}
+	interval := qm.interval()
+	if interval <= 0 {
 		return false
 	}
 
-	exists := qm.checkExists(userName)
-	if exists {
+	players := qm.group(0)
+	idle := map[string]bool{}
+	for _, userName := range players {
+		since := *qm.userStartTime
+		if last, ok := qm.lastActivity[userName]; ok && last.After(since) {
+			since = last
+		}
+		if now.Sub(since) >= interval*time.Duration(qm.idleIntervals) {
+			idle[userName] = true
+		}
+	}
+	if len(idle) == 0 {
 		return false
 	}
 
-	qm.mtx.Lock()
-	defer qm.mtx.Unlock()
-	logrus.Debugf("user %s joined", userName)
+	var removed []string
+	for _, userName := range players {
+		if !idle[userName] {
+			continue
+		}
+		qm.idleTurns[userName]++
+		logrus.Debugf("user %s is idle %d turns", userName, qm.idleTurns[userName])
+		if qm.maxIdleTurns > 0 && qm.idleTurns[userName] >= qm.maxIdleTurns {
+			qm.announce(messageQueueUserIdleRemoved, userName)
+			removed = append(removed, userName)
+		} else {
+			qm.announce(messageQueueUserIdle, userName)
+		}
+	}
+	for _, turn := range qm.turns {
+		turn.Skipped = idle[turn.UserName]
+	}
+	qm.endTurn(now, false, removed...)
 
-	newUser := &user{Name: userName}
-	if qm.current == nil {
-		qm.current = newUser
+	// молчат все игроки - ход переходит следующим как обычно
+	if len(idle) == size && len(removed) == 0 {
+		qm.next()
 		return true
 	}
 
-	i := 0
-	curr := qm.current
-	for {
-		if curr.Next == nil {
-			curr.Next = newUser
-			curr.Next.Prev = curr
-			return true
+	// молчащие уступают место в группе следующим по очереди и встают в конец, выбывшие покидают очередь
+	for _, userName := range players {
+		if !idle[userName] {
+			continue
 		}
-		curr = curr.Next
-
-		if curr == qm.current {
-			logrus.Error("Shit happened! QueueManager.Add curr == qm.current")
-			return false
+		i := qm.indexOf(userName)
+		qm.users = append(qm.users[:i], qm.users[i+1:]...)
+		if qm.maxIdleTurns > 0 && qm.idleTurns[userName] >= qm.maxIdleTurns {
+			qm.forget(userName)
+		} else {
+			qm.users = append(qm.users, userName)
 		}
+	}
+	qm.restartTurn()
+	return true
+}
 
-		i++
-		if i > 1000 {
-			logrus.Error("Shit happened! QueueManager.Add")
-			return false
-		}
+// interval returns the duration of one interval of the track or of the server if no track is playing, mtx must be held
+func (qm *QueueManager) interval() time.Duration {
+	if interval := lib.IntervalDuration(qm.track.BPM, qm.track.BPI); interval > 0 {
+		return interval
 	}
+	return lib.IntervalDuration(qm.serverBPM, qm.serverBPI)
 }
 
-func (qm *QueueManager) checkExists(userName string) bool {
-	if userName == qm.botName {
-		return false
+// announce queues a message for the chat and for the voice channel, mtx must be held
+func (qm *QueueManager) announce(format string, userNames ...string) {
+	qm.announcements = append(qm.announcements, newAnnouncement(format, userNames...))
+}
+
+// newAnnouncement formats a message for the chat and for the voice channel,
+// the voice one is spoken without the @ip suffix of the user names
+func newAnnouncement(format string, userNames ...string) announcement {
+	text := make([]interface{}, len(userNames))
+	voice := make([]interface{}, len(userNames))
+	for i, name := range userNames {
+		text[i] = name
+		voice[i] = cleanName(name)
 	}
+	return announcement{text: p.Sprintf(format, text...), voice: p.Sprintf(format, voice...)}
+}
 
-	if qm.current == nil {
-		return false
+// groupAnnouncement formats a message naming one player or both players of a duet
+func groupAnnouncement(single, duet string, userNames []string) announcement {
+	if len(userNames) > 1 {
+		return newAnnouncement(duet, userNames[0], userNames[1])
 	}
+	return newAnnouncement(single, userNames...)
+}
 
-	curr := qm.current
-	i := 0
-	for {
-		if curr == nil {
-			return false
+// flush sends collected announcements and writes history records, must be called without mtx held
+func (qm *QueueManager) flush() {
+	qm.flushMtx.Lock()
+	defer qm.flushMtx.Unlock()
+
+	qm.mtx.Lock()
+	announcements := qm.announcements
+	qm.announcements = nil
+	records := qm.records
+	qm.records = nil
+	history := qm.history
+	subscribe := qm.subscribe
+	var users []string
+	if key := strings.Join(qm.users, "\n"); subscribe != nil && key != qm.subscribed {
+		qm.subscribed = key
+		users = append([]string{}, qm.users...)
+	} else {
+		subscribe = nil
+	}
+	turnEvents := qm.turnEvents
+	qm.turnEvents = nil
+	var state QueueState
+	stateChanged := false
+	if qm.events != nil {
+		state = qm.state()
+		key := fmt.Sprint(state)
+		stateChanged = key != qm.queueEvent
+		qm.queueEvent = key
+	}
+	qm.mtx.Unlock()
+
+	if stateChanged {
+		qm.events.Publish(EventQueueChanged, state)
+	}
+	for _, turn := range turnEvents {
+		qm.events.Publish(EventTurnChanged, turn)
+	}
+	if subscribe != nil {
+		subscribe(users)
+	}
+
+	for _, record := range records {
+		record(history)
+	}
+
+	for _, a := range announcements {
+		if qm.sendMessage != nil {
+			qm.sendMessage(a.text)
 		}
-		if curr.Name == userName {
-			return true
+		if qm.sendVoiceMessage != nil {
+			qm.sendVoiceMessage(a.voice)
 		}
-		curr = curr.Next
+	}
+}
 
-		if curr == qm.current {
-			logrus.Error("Shit happened! QueueManager.checkExists curr == qm.current")
-			return false
-		}
+func (qm *QueueManager) UsersCount() (i uint) {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
 
-		i++
-		if i > 1000 {
-			logrus.Error("Shit happened! QueueManager.Del i > 1000")
-			return false
-		}
+	return uint(len(qm.users))
+}
+
+// Users returns a copy of the queue, starting with the current soloist
+func (qm *QueueManager) Users() (users []string) {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	if len(qm.users) == 0 {
+		return
 	}
+
+	users = make([]string, len(qm.users))
+	copy(users, qm.users)
+	return
+}
+
+// State returns the queue, its players and mode
+func (qm *QueueManager) State() QueueState {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	return qm.state()
+}
+
+// state mtx must be held
+func (qm *QueueManager) state() QueueState {
+	users := make([]string, len(qm.users))
+	copy(users, qm.users)
+	return QueueState{Users: users, Players: qm.group(0), Mode: qm.mode, Stopped: qm.stopped}
+}
+
+// SetEvents sets the bus to publish changes of the queue and turns to
+func (qm *QueueManager) SetEvents(events *EventBus) {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.events = events
+}
+
+// Players returns the users playing now, two of them in duet mode
+func (qm *QueueManager) Players() []string {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	return qm.group(0)
+}
+
+// Mode returns the way the queue passes turns
+func (qm *QueueManager) Mode() QueueMode {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	return qm.mode
+}
+
+// SetMode changes the way the queue passes turns, a running queue starts a new turn right away
+func (qm *QueueManager) SetMode(mode QueueMode) {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.mode = mode
+	qm.played = make(map[string]bool)
+	qm.tradeLineup = ""
+	if qm.userStartTime != nil {
+		qm.restartTurn()
+	}
+}
+
+// Current returns the name of the current soloist or an empty string if the queue is empty
+func (qm *QueueManager) Current() string {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	if len(qm.users) == 0 {
+		return ""
+	}
+	return qm.users[0]
+}
+
+func (qm *QueueManager) Stopped() bool {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	return qm.stopped
+}
+
+func (qm *QueueManager) Add(userName string) bool {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	if qm.isBot(userName) || qm.indexOf(userName) >= 0 {
+		return false
+	}
+
+	logrus.Debugf("user %s joined", userName)
+	qm.users = append(qm.users, userName)
+	qm.waitingSince[userName] = time.Now()
+
+	return true
 }
 
 func (qm *QueueManager) Del(userName string) bool {
+	defer qm.flush()
 	qm.mtx.Lock()
 	defer qm.mtx.Unlock()
+
+	if qm.isBot(userName) {
+		return false
+	}
+
+	i := qm.indexOf(userName)
+	if i < 0 {
+		return false
+	}
+
 	logrus.Debugf("user %s leaved", userName)
-	defer func() {
-		if qm.current != nil {
-			logrus.Debugf("current user %s", qm.current.Name)
+	qm.del(i)
 
-			if qm.current.Next != nil {
-				logrus.Debugf("next user %s", qm.current.Next.Name)
-			}
-		}
-	}()
+	return true
+}
+
+// del removes the user at position i, mtx must be held
+func (qm *QueueManager) del(i int) {
+	userName := qm.users[i]
+	playing := i < qm.groupSize()
+	if playing {
+		qm.endTurn(time.Now(), false, userName)
+	}
+	qm.users = append(qm.users[:i], qm.users[i+1:]...)
+	qm.forget(userName)
 
-	if userName == qm.botName {
+	if len(qm.users) == 0 {
+		// больше нет юзеров, последний вышел - всё обнуляем
+		qm.users = nil
+		qm.userStartTime = nil
+		qm.userStartsPlaying = ""
+		qm.userPlayDuration = 0
+		return
+	}
+
+	if playing {
+		// если текущий юзер и есть выбывший - сразу переключаем
+		qm.restartTurn()
+	}
+}
+
+// forget drops the state of the user who left the queue, mtx must be held
+func (qm *QueueManager) forget(userName string) {
+	delete(qm.skip, userName)
+	delete(qm.lastActivity, userName)
+	delete(qm.idleTurns, userName)
+	delete(qm.waitingSince, userName)
+}
+
+// Next passes the turn to the next user in the queue
+func (qm *QueueManager) Next() {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.next()
+}
+
+// MoveTo moves the user to the given zero-based position in the queue,
+// moving to position 0 makes the user the current soloist
+func (qm *QueueManager) MoveTo(userName string, position int) bool {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	i := qm.find(userName)
+	if i < 0 || position < 0 {
 		return false
 	}
-	if qm.current == nil {
+	userName = qm.users[i]
+	if position > len(qm.users)-1 {
+		position = len(qm.users) - 1
+	}
+	if i == position {
+		return true
+	}
+
+	players := strings.Join(qm.group(0), "\n")
+
+	qm.users = append(qm.users[:i], qm.users[i+1:]...)
+	qm.users = append(qm.users[:position], append([]string{userName}, qm.users[position:]...)...)
+
+	if strings.Join(qm.group(0), "\n") != players {
+		qm.restartTurn()
+	}
+
+	return true
+}
+
+// Swap exchanges the positions of two users in the queue
+func (qm *QueueManager) Swap(userName1, userName2 string) bool {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	i, j := qm.find(userName1), qm.find(userName2)
+	if i < 0 || j < 0 {
 		return false
 	}
-	curr := qm.current
-	i := 0
-	for {
-		if curr == nil {
-			return false
-		}
-		if curr.Name == userName {
-			if curr.Prev != nil && curr.Prev != curr.Next { // только если есть предыдущий юзер, и при этом его следующим не станет он сам после удаления ушедшего юзера
-				curr.Prev.Next = curr.Next
-			}
-			if curr.Next == nil && i == 0 {
-				// больше нет юзеров, последний вышел - всё обнуляем
-				qm.current = nil
-				qm.userStartTime = nil
-				qm.userStartsPlaying = nil
-				qm.userPlayDuration = 0
-				// TODO остановить плеер
-				return true
-			}
+	if i == j {
+		return true
+	}
 
-			if curr.Next != nil && curr.Next != curr.Prev {
-				curr.Next.Prev = curr.Prev
-			}
+	players := strings.Join(qm.group(0), "\n")
 
-			if i == 0 {
-				qm.current = curr.Next
-				qm.current.Prev = nil
-				// если текущий юзер и есть выбывший - сразу переключаем
-				qm.userStartTime = nil
-				qm.userStartsPlaying = nil
-				if !qm.stopped {
-					qm.start(0)
-				}
-			}
+	qm.users[i], qm.users[j] = qm.users[j], qm.users[i]
 
-			return true
-		}
-		curr = curr.Next
+	if strings.Join(qm.group(0), "\n") != players {
+		qm.restartTurn()
+	}
 
-		if curr == qm.current {
-			logrus.Error("Shit happened! QueueManager.Del curr == qm.current")
-			return false
-		}
+	return true
+}
 
-		i++
-		if i > 1000 {
-			logrus.Error("Shit happened! QueueManager.Del i > 1000")
-			return false
-		}
+// Skip makes the user pass the next turn keeping the place in the queue,
+// if the user is the current soloist the turn passes right away
+func (qm *QueueManager) Skip(userName string) bool {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	i := qm.find(userName)
+	if i < 0 {
+		return false
 	}
+
+	if i < qm.groupSize() {
+		qm.endTurn(time.Now(), true)
+		qm.next()
+		return true
+	}
+
+	qm.skip[qm.users[i]] = true
+
+	return true
 }
 
-func (qm *QueueManager) next() {
+// Contains reports whether the user is in the queue, the name may be given without the @ip suffix
+func (qm *QueueManager) Contains(userName string) bool {
 	qm.mtx.Lock()
 	defer qm.mtx.Unlock()
 
-	if qm.current != nil && qm.current.Next != nil {
-		next := qm.current.Next
-
-		curr := qm.current
-		// перекинем текущего в конец списка
-		i := 0
-		for {
-			if curr.Next != nil {
-				if curr == curr.Next {
-					logrus.Error("Shit happened! QueueManager.next current == current.Next")
-					curr.Next = nil
-					break
-				}
-
-				curr = curr.Next
-
-				if curr == qm.current {
-					logrus.Error("Shit happened! QueueManager.next curr == qm.current")
-					return
-				}
-
-				i++
-				if i > 1000 {
-					logrus.Error("Shit happened! QueueManager.next i > 1000")
-					return
-				}
-				continue
+	return qm.find(userName) >= 0
+}
+
+func (qm *QueueManager) isBot(userName string) bool {
+	return userName == qm.botName || cleanName(userName) == qm.botName
+}
+
+func (qm *QueueManager) indexOf(userName string) int {
+	for i, name := range qm.users {
+		if name == userName {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// find looks for the user by the full name first, then by the name without the @ip suffix
+func (qm *QueueManager) find(userName string) int {
+	if i := qm.indexOf(userName); i >= 0 {
+		return i
+	}
+
+	found := -1
+	for i, name := range qm.users {
+		if cleanName(name) == cleanName(userName) {
+			if found >= 0 {
+				// ambiguous, several users with the same name from different addresses
+				return -1
 			}
-			curr.Next = qm.current
-			curr.Next.Prev = curr
-			curr.Next.Next = nil
-			break
+			found = i
+		}
+	}
+
+	return found
+}
+
+// restartTurn starts the turn of a new current user, mtx must be held
+func (qm *QueueManager) restartTurn() {
+	qm.endTurn(time.Now(), false)
+	qm.userStartTime = nil
+	qm.userStartsPlaying = ""
+	if !qm.stopped {
+		qm.start(0)
+	}
+}
+
+// next moves the current players to the end of the queue, mtx must be held
+func (qm *QueueManager) next() {
+	if size := qm.groupSize(); len(qm.users) > size {
+		prev := qm.users[0]
+		// перекинем текущих в конец списка
+		qm.users = append(qm.users[size:], qm.users[:size]...)
+		// пропускаем тех, кто попросил пропустить ход, каждого не более одного раза
+		for i := 0; i < len(qm.users)-1 && qm.skip[qm.users[0]]; i++ {
+			delete(qm.skip, qm.users[0])
+			qm.users = append(qm.users[1:], qm.users[0])
+		}
+		if qm.mode.Kind == QueueModeRandom {
+			qm.shuffleRound(prev)
 		}
-		qm.current = next
-		qm.current.Prev = nil
 		qm.userStartTime = nil
-		qm.userStartsPlaying = nil
+		qm.userStartsPlaying = ""
 		qm.start(0)
 		return
 	}
 
 	// если следующего нет - просто обновим таймер и текущий продолжит играть
-	tn := time.Now()
+	tn := qm.alignedTime(time.Now())
 	qm.userStartTime = &tn
+	qm.openTurn()
+}
+
+// shuffleRound shuffles the queue when everybody has played in the round, mtx must be held
+func (qm *QueueManager) shuffleRound(prev string) {
+	qm.played[prev] = true
+	if !qm.played[qm.users[0]] {
+		return
+	}
+
+	qm.played = make(map[string]bool)
+	rand.Shuffle(len(qm.users), func(i, j int) {
+		qm.users[i], qm.users[j] = qm.users[j], qm.users[i]
+	})
+	// тот, кто только что играл, не начинает новый раунд
+	if qm.users[0] == prev {
+		qm.users[0], qm.users[1] = qm.users[1], qm.users[0]
+	}
+}
+
+// groupSize returns the number of users playing at the same time, mtx must be held
+func (qm *QueueManager) groupSize() int {
+	if qm.mode.Kind == QueueModeDuet && len(qm.users) > 1 {
+		return 2
+	}
+	return 1
+}
+
+// group returns the players of the turn starting at position from of the queue, mtx must be held
+func (qm *QueueManager) group(from int) (users []string) {
+	if len(qm.users) == 0 {
+		return
+	}
+	size := qm.groupSize()
+	for i := 0; i < size; i++ {
+		users = append(users, qm.users[(from+i)%len(qm.users)])
+	}
+	return
 }
 
-func (qm *QueueManager) start(intervalDuration time.Duration) {
+// turnPolicy returns the solo policy of the mode, mtx must be held
+func (qm *QueueManager) turnPolicy() (lib.SoloPolicy, lib.SoloContext) {
+	track := qm.track
+	size := qm.groupSize()
+	track.Users = uint((len(qm.users) + size - 1) / size)
+	if qm.mode.Kind != QueueModeTrade {
+		return qm.soloPolicy, track
+	}
+
+	// без трека меряем такты по темпу сервера
+	if track.BPM == 0 {
+		track.BPM, track.BPI = qm.serverBPM, qm.serverBPI
+	}
+	return lib.SoloPolicy{Kind: lib.SoloPolicyBars, Value: qm.mode.Bars}, track
+}
+
+// alignedTime returns the interval boundary nearest to t, mtx must be held
+func (qm *QueueManager) alignedTime(t time.Time) time.Time {
+	interval := lib.IntervalDuration(qm.track.BPM, qm.track.BPI)
+	if interval <= 0 || qm.trackStartTime.IsZero() || t.Before(qm.trackStartTime) {
+		return t
+	}
+
+	n := (t.Sub(qm.trackStartTime) + interval/2) / interval
+
+	return qm.trackStartTime.Add(n * interval)
+}
+
+// start begins the turn of the current user after delay, mtx must be held
+func (qm *QueueManager) start(delay time.Duration) {
 	//  если уже кто-то играл - переключим на следующего на новом треке
 	if qm.userStartTime != nil &&
-		qm.current != nil &&
-		qm.userStartsPlaying == qm.current && // may be different if current user leaved server and next user has become current
-		qm.userStartTime.Add(qm.userPlayDuration).Before(time.Now()) &&
-		qm.current.Next != nil {
-		qm.userStartTime = nil
-		qm.userStartsPlaying = nil
-
+		len(qm.users) > 1 &&
+		qm.userStartsPlaying == qm.users[0] && // may be different if current user leaved server and next user has become current
+		qm.userStartTime.Add(qm.userPlayDuration).Before(time.Now()) {
 		qm.next()
 		return
 	}
-	tn := time.Now().Add(intervalDuration)
+	policy, track := qm.turnPolicy()
+	qm.userPlayDuration = policy.Duration(track)
+
+	tn := qm.alignedTime(time.Now().Add(delay))
 	qm.userStartTime = &tn
-	qm.userStartsPlaying = qm.current
 	qm.after15SecMsgSent = false
 	qm.stopped = false
-	if qm.current != nil && qm.sendMessage != nil {
-		// если до конца трека осталось примерно время игры одного музыканта - не объявляем следующего
-		if qm.current.Next == nil || time.Now().Add(qm.userPlayDuration+time.Second*10).After(qm.trackEndTime) {
-			qm.sendMessage(p.Sprintf(messageNowPlaying, qm.current.Name))
-			if qm.sendVoiceMessage != nil {
-				qm.sendVoiceMessage(p.Sprintf(messageNowPlaying, cleanName(qm.current.Name)))
-			}
-		} else {
-			qm.sendMessage(p.Sprintf(messageNowPlaying, qm.current.Name) + ", " + p.Sprintf(messageIsNext, qm.current.Next.Name))
-			if qm.sendVoiceMessage != nil {
-				qm.sendVoiceMessage(p.Sprintf(messageNowPlaying, cleanName(qm.current.Name)) + ", " + p.Sprintf(messageIsNext, cleanName(qm.current.Next.Name)))
-			}
-		}
+	qm.openSession()
+	if len(qm.users) == 0 {
+		qm.userStartsPlaying = ""
+		qm.endTurn(time.Now(), false)
+		return
+	}
+	qm.userStartsPlaying = qm.users[0]
+	qm.openTurn()
+
+	if qm.mode.Kind == QueueModeTrade {
+		qm.announceTrade()
+		return
 	}
+
+	size := qm.groupSize()
+	nowPlaying := groupAnnouncement(messageNowPlaying, messageNowPlayingDuet, qm.group(0))
+	// если до конца трека осталось примерно время игры одного музыканта - не объявляем следующего
+	if len(qm.users) == size ||
+		!qm.trackEndTime.IsZero() && time.Now().Add(qm.userPlayDuration+time.Second*10).After(qm.trackEndTime) {
+		qm.announcements = append(qm.announcements, nowPlaying)
+		return
+	}
+
+	isNext := groupAnnouncement(messageIsNext, messageAreNextDuet, qm.group(size))
+	nowPlaying.text += ", " + isNext.text
+	nowPlaying.voice += ", " + isNext.voice
+	qm.announcements = append(qm.announcements, nowPlaying)
 }
 
-func (qm *QueueManager) delayedStart(intervalDuration, delayDuration time.Duration) {
-	tn := time.Now().Add(intervalDuration).Add(delayDuration)
+// announceTrade names the users trading bars in their order when it changes, mtx must be held
+func (qm *QueueManager) announceTrade() {
+	// порядок меняется каждый ход, объявляем только когда меняется состав
+	members := append([]string{}, qm.users...)
+	sort.Strings(members)
+	key := strings.Join(members, "\n")
+	if key == qm.tradeLineup {
+		return
+	}
+	qm.tradeLineup = key
+	lineup := strings.Join(qm.users, ", ")
+
+	voice := make([]string, len(qm.users))
+	for i, name := range qm.users {
+		voice[i] = cleanName(name)
+	}
+	qm.announcements = append(qm.announcements, announcement{
+		text:  p.Sprintf(messageTradingBars, qm.mode.Bars, lineup),
+		voice: p.Sprintf(messageTradingBars, qm.mode.Bars, strings.Join(voice, ", ")),
+	})
+}
+
+// delayedStart mtx must be held
+func (qm *QueueManager) delayedStart(delay time.Duration) {
+	tn := time.Now().Add(delay)
 	qm.delayedStartTime = &tn
 	qm.userStartTime = nil
-	qm.userStartsPlaying = nil
+	qm.userStartsPlaying = ""
 	qm.stopped = false
-	if qm.current != nil && qm.sendMessage != nil {
-		qm.sendMessage(p.Sprintf(messageAfter15Seconds, qm.current.Name))
-		if qm.sendVoiceMessage != nil {
-			qm.sendVoiceMessage(p.Sprintf(messageAfter15Seconds, cleanName(qm.current.Name)))
-		}
+	qm.endTurn(time.Now(), false)
+	qm.openSession()
+	if len(qm.users) > 0 {
+		qm.announcements = append(qm.announcements, groupAnnouncement(messageAfter15Seconds, messageAfter15SecondsDuet, qm.group(0)))
 		qm.after15SecMsgSent = true
 	}
 }
 
-func (qm *QueueManager) OnStart(trackDuration, intervalDuration time.Duration) {
-	qm.userPlayDuration = lib.CalcUserPlayDuration(trackDuration)
-	qm.trackEndTime = time.Now().Add(trackDuration)
-	qm.start(intervalDuration)
+// setTrack mtx must be held
+func (qm *QueueManager) setTrack(track lib.SoloContext, policy lib.SoloPolicy) {
+	qm.track = track
+	qm.soloPolicy = policy
+	qm.trackStartTime = time.Now()
+	qm.trackEndTime = time.Time{}
+	if track.TrackDuration > 0 {
+		qm.trackEndTime = qm.trackStartTime.Add(track.TrackDuration)
+	}
 }
 
-func (qm *QueueManager) OnDelayedStart(trackDuration, intervalDuration, delayDuration time.Duration) {
-	qm.userPlayDuration = lib.CalcUserPlayDuration(trackDuration)
-	qm.trackEndTime = time.Now().Add(trackDuration)
-	qm.delayedStart(intervalDuration, delayDuration)
+// OnStart is called when the track starts playing, the first turn begins with the first interval heard by others
+func (qm *QueueManager) OnStart(track lib.SoloContext, policy lib.SoloPolicy) {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.setTrack(track, policy)
+	qm.start(lib.IntervalDuration(track.BPM, track.BPI))
+}
+
+// OnDelayedStart starts the queue after delay, track may be empty if the queue is started without a track
+func (qm *QueueManager) OnDelayedStart(track lib.SoloContext, policy lib.SoloPolicy, delay time.Duration) {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.setTrack(track, policy)
+	qm.delayedStart(lib.IntervalDuration(track.BPM, track.BPI) + delay)
 }
 
 func (qm *QueueManager) OnStop() {
+	defer qm.flush()
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
 	qm.stopped = true
 	qm.delayedStartTime = nil
+	qm.tradeLineup = ""
+	qm.endTurn(time.Now(), false)
+	qm.closeSession()
 }
 
 func (qm *QueueManager) OnUserinfoChange(user models.UserInfo) {
@@ -392,6 +826,159 @@ func (qm *QueueManager) OnUserinfoChange(user models.UserInfo) {
 	qm.Del(string(user.Name))
 }
 
+// OnServerConfigChange keeps the server tempo to measure intervals when the queue plays without a track
+func (qm *QueueManager) OnServerConfigChange(bpm, bpi uint) {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.serverBPM, qm.serverBPI = bpm, bpi
+}
+
+// SetIdlePolicy sets the number of silent intervals after which the current user loses the turn
+// and the number of idle turns in a row after which the user is removed from queue, zeros disable them
+func (qm *QueueManager) SetIdlePolicy(silentIntervals, maxTurns uint) {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.idleIntervals = silentIntervals
+	qm.maxIdleTurns = maxTurns
+}
+
+// SetSubscriber sets the subscription to intervals of users, flush calls it with the queue members when they change
+func (qm *QueueManager) SetSubscriber(subscribe func(userNames []string)) {
+	qm.mtx.Lock()
+	qm.subscribe = subscribe
+	qm.subscribed = ""
+	qm.mtx.Unlock()
+
+	qm.flush()
+}
+
+// OnIntervalBegin is called for every interval the server sends us from other users,
+// an interval with an empty GUID means the channel transmits nothing
+func (qm *QueueManager) OnIntervalBegin(userName string, channelIndex uint8, guid [16]byte) {
+	if guid == [16]byte{} {
+		return
+	}
+
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	i := qm.indexOf(userName)
+	if i < 0 {
+		return
+	}
+	qm.lastActivity[userName] = time.Now()
+	if i < qm.groupSize() {
+		// играет в свой ход - сбрасываем счётчик пропущенных ходов
+		delete(qm.idleTurns, userName)
+	}
+}
+
+// SetHistory sets the storage of queue sessions and turns
+func (qm *QueueManager) SetHistory(history QueueHistory) {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	qm.history = history
+}
+
+// Waiting returns users waiting for their turn, the one who has been waiting longest goes first
+func (qm *QueueManager) Waiting() (waiting []QueueWaiting) {
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	now := time.Now()
+	waiting = []QueueWaiting{}
+	for i := qm.groupSize(); i < len(qm.users); i++ {
+		since := qm.waitingSince[qm.users[i]]
+		waiting = append(waiting, QueueWaiting{UserName: qm.users[i], Since: since, Seconds: uint(now.Sub(since).Seconds())})
+	}
+	sort.SliceStable(waiting, func(i, j int) bool {
+		return waiting[i].Since.Before(waiting[j].Since)
+	})
+
+	return
+}
+
+// record adds a history record to be written by flush, mtx must be held
+func (qm *QueueManager) record(r func(h QueueHistory)) {
+	if qm.history == nil {
+		return
+	}
+	qm.records = append(qm.records, r)
+}
+
+// openSession mtx must be held
+func (qm *QueueManager) openSession() {
+	if qm.sessionOpen {
+		return
+	}
+	qm.sessionOpen = true
+	now := time.Now()
+	qm.record(func(h QueueHistory) {
+		h.SessionStart(now)
+	})
+}
+
+// closeSession mtx must be held
+func (qm *QueueManager) closeSession() {
+	if !qm.sessionOpen {
+		return
+	}
+	qm.sessionOpen = false
+	now := time.Now()
+	qm.record(func(h QueueHistory) {
+		h.SessionStop(now)
+	})
+}
+
+// openTurn ends the open turns and starts the turns of the current players, mtx must be held
+func (qm *QueueManager) openTurn() {
+	qm.endTurn(time.Now(), false)
+	if qm.userStartTime == nil {
+		return
+	}
+	for _, userName := range qm.group(0) {
+		qm.turns = append(qm.turns, &tracks.QueueTurn{
+			UserName:  userName,
+			TrackID:   qm.track.TrackID,
+			StartedAt: *qm.userStartTime,
+		})
+	}
+	if qm.events != nil {
+		qm.turnEvents = append(qm.turnEvents, TurnEvent{
+			Players:  qm.group(0),
+			StartsAt: *qm.userStartTime,
+			Duration: qm.userPlayDuration.Seconds(),
+		})
+	}
+}
+
+// endTurn records the open turns, leftUsers are the players who left the queue if any,
+// turns already marked skipped stay skipped, mtx must be held
+func (qm *QueueManager) endTurn(now time.Time, skipped bool, leftUsers ...string) {
+	for _, t := range qm.turns {
+		turn := *t
+		turn.EndedAt = now
+		if now.After(turn.StartedAt) {
+			turn.Seconds = uint(now.Sub(turn.StartedAt).Seconds())
+		}
+		turn.Skipped = skipped || t.Skipped
+		for _, leftUser := range leftUsers {
+			turn.Left = turn.Left || turn.UserName == leftUser
+		}
+		if !turn.Left {
+			qm.waitingSince[turn.UserName] = now
+		}
+
+		qm.record(func(h QueueHistory) {
+			h.Turn(turn)
+		})
+	}
+	qm.turns = nil
+}
+
 // @deprecated
 func cleanName(userName string) string {
 	i := strings.Index(userName, "@")
@@ -2,8 +2,13 @@ package dj
 
 import (
 	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/lib"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -13,16 +18,15 @@ func TestQueueManager_Add(t *testing.T) {
 	assert.Equal(t, uint(0), qm.UsersCount())
 
 	qm.Add("test1")
-	assert.NotNil(t, qm.current)
-	assert.Nil(t, qm.current.Next)
+	assert.Equal(t, "test1", qm.Current())
 	assert.Equal(t, uint(1), qm.UsersCount())
 
 	qm.Add("test2")
-	assert.NotNil(t, qm.current.Next)
+	assert.Equal(t, []string{"test1", "test2"}, qm.Users())
 	assert.Equal(t, uint(2), qm.UsersCount())
 
 	qm.Add("test3")
-	assert.NotNil(t, qm.current.Next.Next)
+	assert.Equal(t, []string{"test1", "test2", "test3"}, qm.Users())
 	assert.Equal(t, uint(3), qm.UsersCount())
 
 	qm.Add("test4")
@@ -36,7 +40,7 @@ func TestQueueManager_Add(t *testing.T) {
 
 	qm.Add("test1")
 	assert.Equal(t, uint(4), qm.UsersCount())
-	assert.Equal(t, "test2", qm.current.Name)
+	assert.Equal(t, "test1", qm.Current())
 
 	qm.Add("dj")
 	assert.Equal(t, uint(4), qm.UsersCount())
@@ -49,32 +53,28 @@ func TestQueueManager_queue(t *testing.T) {
 	qm := NewQueueManager("dj", func(string) {}, func(string) {})
 
 	qm.Add("burillo")
-	assert.Nil(t, qm.current.Prev)
 	qm.Add("cronos")
-	assert.Nil(t, qm.current.Prev)
 	qm.Add("archi")
-	assert.Nil(t, qm.current.Prev)
 
 	qm.Del("burillo")
-	assert.Nil(t, qm.current.Prev)
+	assert.Equal(t, []string{"cronos", "archi"}, qm.Users())
 
 	qm.Add("burillo")
-	assert.Nil(t, qm.current.Prev)
+	assert.Equal(t, []string{"cronos", "archi", "burillo"}, qm.Users())
 
-	qm.next()
-	assert.Nil(t, qm.current.Prev)
+	qm.Next()
+	assert.Equal(t, []string{"archi", "burillo", "cronos"}, qm.Users())
 
-	qm.next()
-	assert.Nil(t, qm.current.Prev)
+	qm.Next()
+	assert.Equal(t, []string{"burillo", "cronos", "archi"}, qm.Users())
 
-	qm.next()
-	assert.Nil(t, qm.current.Prev)
+	qm.Next()
+	assert.Equal(t, []string{"cronos", "archi", "burillo"}, qm.Users())
 
 	qm.Del("cronos")
-	assert.Nil(t, qm.current.Prev)
-	assert.Nil(t, qm.current.Next.Next)
+	assert.Equal(t, []string{"archi", "burillo"}, qm.Users())
 	qm.Del("archi")
-	assert.Nil(t, qm.current.Prev)
+	assert.Equal(t, []string{"burillo"}, qm.Users())
 }
 
 func TestQueueManager_Del(t *testing.T) {
@@ -115,22 +115,18 @@ func TestQueueManager_Del(t *testing.T) {
 	qm.Add("dj")
 	assert.Equal(t, uint(3), qm.UsersCount())
 
-	assert.Equal(t, "test1", qm.current.Name)
-	assert.Equal(t, "test3", qm.current.Next.Name)
+	assert.Equal(t, []string{"test1", "test3", "test2"}, qm.Users())
 	qm.Del("test1")
 	assert.Equal(t, uint(2), qm.UsersCount())
-	assert.Equal(t, "test3", qm.current.Name)
-	assert.Equal(t, "test2", qm.current.Next.Name)
+	assert.Equal(t, []string{"test3", "test2"}, qm.Users())
 
 	qm.Del("test2")
 	assert.Equal(t, uint(1), qm.UsersCount())
-	assert.Equal(t, "test3", qm.current.Name)
-	assert.Nil(t, qm.current.Prev)
-	assert.Nil(t, qm.current.Next)
+	assert.Equal(t, []string{"test3"}, qm.Users())
 
 	qm.Del("test3")
 	assert.Equal(t, uint(0), qm.UsersCount())
-	assert.Nil(t, qm.current)
+	assert.Equal(t, "", qm.Current())
 }
 
 func TestQueueManager_Del_2(t *testing.T) {
@@ -153,8 +149,7 @@ func TestQueueManager_Del_2(t *testing.T) {
 	qm.Del("test1")
 	assert.Equal(t, uint(3), qm.UsersCount())
 
-	assert.Equal(t, "test2", qm.current.Name)
-	assert.Equal(t, "test3", qm.current.Next.Name)
+	assert.Equal(t, []string{"test2", "test3", "test4"}, qm.Users())
 
 	qm.Add("test1")
 	assert.Equal(t, uint(4), qm.UsersCount())
@@ -175,6 +170,287 @@ func TestQueueManager_Del_2(t *testing.T) {
 	assert.Equal(t, uint(3), qm.UsersCount())
 }
 
+func TestQueueManager_MoveTo(t *testing.T) {
+	qm := NewQueueManager("dj", func(string) {}, func(string) {})
+
+	qm.Add("test1")
+	qm.Add("test2")
+	qm.Add("test3")
+	qm.Add("test4")
+
+	assert.True(t, qm.MoveTo("test4", 1))
+	assert.Equal(t, []string{"test1", "test4", "test2", "test3"}, qm.Users())
+
+	assert.True(t, qm.MoveTo("test1", 10))
+	assert.Equal(t, []string{"test4", "test2", "test3", "test1"}, qm.Users())
+
+	assert.True(t, qm.MoveTo("test3", 0))
+	assert.Equal(t, []string{"test3", "test4", "test2", "test1"}, qm.Users())
+
+	assert.False(t, qm.MoveTo("test5", 0))
+	assert.False(t, qm.MoveTo("test3", -1))
+	assert.Equal(t, []string{"test3", "test4", "test2", "test1"}, qm.Users())
+}
+
+func TestQueueManager_Swap(t *testing.T) {
+	qm := NewQueueManager("dj", func(string) {}, func(string) {})
+
+	qm.Add("test1")
+	qm.Add("test2")
+	qm.Add("test3")
+
+	assert.True(t, qm.Swap("test1", "test3"))
+	assert.Equal(t, []string{"test3", "test2", "test1"}, qm.Users())
+
+	assert.True(t, qm.Swap("test2", "test2"))
+	assert.Equal(t, []string{"test3", "test2", "test1"}, qm.Users())
+
+	assert.False(t, qm.Swap("test2", "test5"))
+	assert.Equal(t, []string{"test3", "test2", "test1"}, qm.Users())
+}
+
+func TestQueueManager_Skip(t *testing.T) {
+	qm := NewQueueManager("dj", func(string) {}, func(string) {})
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+	qm.Add("test3@127.x.x.3")
+
+	assert.True(t, qm.Skip("test2"))
+	qm.Next()
+	// test2 passes the turn but keeps the place before test1
+	assert.Equal(t, []string{"test3@127.x.x.3", "test1@127.x.x.1", "test2@127.x.x.2"}, qm.Users())
+
+	qm.Next()
+	assert.Equal(t, []string{"test1@127.x.x.1", "test2@127.x.x.2", "test3@127.x.x.3"}, qm.Users())
+
+	qm.Next()
+	assert.Equal(t, "test2@127.x.x.2", qm.Current())
+
+	// the current soloist passes the turn right away
+	assert.True(t, qm.Skip("test2@127.x.x.2"))
+	assert.Equal(t, "test3@127.x.x.3", qm.Current())
+
+	assert.False(t, qm.Skip("test4"))
+}
+
+func TestQueueManager_idle(t *testing.T) {
+	qm := NewQueueManager("dj", nil, nil)
+	qm.SetIdlePolicy(2, 2)
+	// 120 BPM, 16 BPI - interval is 8 seconds
+	qm.OnServerConfigChange(120, 16)
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+	qm.OnStart(lib.SoloContext{}, lib.SoloPolicy{Kind: lib.SoloPolicySeconds, Value: 600})
+
+	qm.tick(time.Now().Add(time.Second * 10))
+	assert.Equal(t, "test1@127.x.x.1", qm.Current())
+
+	// two silent intervals - the turn is passed on
+	qm.tick(time.Now().Add(time.Second * 17))
+	assert.Equal(t, "test2@127.x.x.2", qm.Current())
+
+	// silent intervals with empty GUID are not an activity, others are
+	qm.OnIntervalBegin("test2@127.x.x.2", 0, [16]byte{})
+	qm.OnIntervalBegin("test2@127.x.x.2", 0, [16]byte{1})
+	qm.tick(time.Now().Add(time.Second * 10))
+	assert.Equal(t, "test2@127.x.x.2", qm.Current())
+
+	// the second idle turn in a row removes the user from queue
+	qm.Next()
+	assert.Equal(t, "test1@127.x.x.1", qm.Current())
+	qm.tick(time.Now().Add(time.Second * 17))
+	assert.Equal(t, []string{"test2@127.x.x.2"}, qm.Users())
+}
+
+func TestQueueManager_announce(t *testing.T) {
+	var messages, voiceMessages []string
+	qm := NewQueueManager("dj", func(msg string) {
+		messages = append(messages, msg)
+	}, func(msg string) {
+		voiceMessages = append(voiceMessages, msg)
+	})
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+
+	qm.OnStart(lib.SoloContext{TrackDuration: time.Minute * 20}, lib.SoloPolicy{})
+	assert.Equal(t, []string{p.Sprintf(messageNowPlaying, "test1@127.x.x.1") + ", " + p.Sprintf(messageIsNext, "test2@127.x.x.2")}, messages)
+	assert.Equal(t, []string{p.Sprintf(messageNowPlaying, "test1") + ", " + p.Sprintf(messageIsNext, "test2")}, voiceMessages)
+
+	qm.OnStop()
+	assert.True(t, qm.Stopped())
+
+	// while the queue is stopped changing the current user is silent
+	qm.Del("test1@127.x.x.1")
+	assert.Len(t, messages, 1)
+}
+
+func TestQueueManager_alignedTime(t *testing.T) {
+	qm := NewQueueManager("dj", nil, nil)
+	defer qm.Close()
+
+	qm.Add("test1")
+	qm.Add("test2")
+	qm.OnStart(lib.SoloContext{TrackDuration: time.Minute * 10, BPM: 120, BPI: 16}, lib.SoloPolicy{Kind: lib.SoloPolicySeconds, Value: 60})
+
+	qm.mtx.Lock()
+	defer qm.mtx.Unlock()
+
+	// 120 BPM, 16 BPI - 8 seconds interval, 60 seconds rounded to 8 intervals
+	assert.Equal(t, time.Second*64, qm.userPlayDuration)
+	// the first turn starts with the first interval heard by others
+	assert.Equal(t, qm.trackStartTime.Add(time.Second*8), *qm.userStartTime)
+
+	start := qm.trackStartTime
+	assert.Equal(t, start, qm.alignedTime(start.Add(time.Second*3)))
+	assert.Equal(t, start.Add(time.Second*8), qm.alignedTime(start.Add(time.Second*5)))
+	assert.Equal(t, start.Add(time.Second*72), qm.alignedTime(start.Add(time.Second*73)))
+}
+
+// queueOp is a random operation applied to the queue by the property tests
+type queueOp struct {
+	Kind     uint8
+	User     uint8
+	Other    uint8
+	Position int8
+}
+
+func (op queueOp) apply(qm *QueueManager, model []string) []string {
+	user := fmt.Sprintf("user%d", op.User%6)
+	other := fmt.Sprintf("user%d", op.Other%6)
+
+	indexOf := func(name string) int {
+		for i, n := range model {
+			if n == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	switch op.Kind % 5 {
+	case 0:
+		if qm.Add(user) {
+			model = append(model, user)
+		}
+	case 1:
+		if qm.Del(user) {
+			i := indexOf(user)
+			model = append(model[:i], model[i+1:]...)
+		}
+	case 2:
+		qm.Next()
+		if len(model) > 1 {
+			model = append(model[1:], model[0])
+		}
+	case 3:
+		position := int(op.Position)
+		if qm.MoveTo(user, position) {
+			i := indexOf(user)
+			if position > len(model)-1 {
+				position = len(model) - 1
+			}
+			model = append(model[:i], model[i+1:]...)
+			model = append(model[:position], append([]string{user}, model[position:]...)...)
+		}
+	case 4:
+		if qm.Swap(user, other) {
+			i, j := indexOf(user), indexOf(other)
+			model[i], model[j] = model[j], model[i]
+		}
+	}
+
+	return model
+}
+
+func TestQueueManager_orderInvariants(t *testing.T) {
+	f := func(ops []queueOp, started bool) bool {
+		qm := NewQueueManager("dj", nil, nil)
+		defer qm.Close()
+
+		if started {
+			qm.OnStart(lib.SoloContext{TrackDuration: time.Hour}, lib.SoloPolicy{})
+		}
+
+		var model []string
+		for _, op := range ops {
+			model = op.apply(qm, model)
+
+			users := qm.Users()
+			if len(users) != len(model) || qm.UsersCount() != uint(len(model)) {
+				return false
+			}
+			seen := map[string]bool{}
+			for i, u := range users {
+				// order follows the model and nobody is queued twice
+				if u != model[i] || seen[u] {
+					return false
+				}
+				seen[u] = true
+			}
+			if len(users) > 0 && qm.Current() != users[0] {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	err := quick.Check(f, &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(1))})
+	assert.NoError(t, err)
+}
+
+func TestQueueManager_concurrency(t *testing.T) {
+	qm := NewQueueManager("dj", func(string) {}, func(string) {})
+	defer qm.Close()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(i)))
+			for j := 0; j < 200; j++ {
+				user := fmt.Sprintf("user%d", r.Intn(5))
+				switch r.Intn(9) {
+				case 0:
+					qm.Add(user)
+				case 1:
+					qm.Del(user)
+				case 2:
+					qm.Next()
+				case 3:
+					qm.MoveTo(user, r.Intn(5))
+				case 4:
+					qm.Swap(user, fmt.Sprintf("user%d", r.Intn(5)))
+				case 5:
+					qm.OnStart(lib.SoloContext{TrackDuration: time.Minute * 10, BPM: 120, BPI: 16}, lib.SoloPolicy{Kind: lib.SoloPolicySplit})
+				case 6:
+					qm.OnStop()
+				case 7:
+					qm.tick(time.Now().Add(time.Duration(r.Intn(600)) * time.Second))
+				case 8:
+					qm.Users()
+					qm.Current()
+					qm.Stopped()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.True(t, qm.UsersCount() <= 5)
+}
+
+func TestQueueManager_Close(t *testing.T) {
+	qm := NewQueueManager("dj", nil, nil)
+	qm.Close()
+	// повторное закрытие, например при переподключении, не паникует
+	assert.NotPanics(t, qm.Close)
+}
+
 func TestNewQueueManager(t *testing.T) {
 	t.Skip()
 	qm := NewQueueManager("dj", func(msg string) {
@@ -187,8 +463,7 @@ func TestNewQueueManager(t *testing.T) {
 	qm.Add("User 2")
 	qm.Add("User 3")
 
-	qm.OnStart(time.Minute*20, time.Second*10)
-	qm.userPlayDuration = time.Second * 30
+	qm.OnStart(lib.SoloContext{TrackDuration: time.Minute * 20, BPM: 96, BPI: 16}, lib.SoloPolicy{Kind: lib.SoloPolicySeconds, Value: 30})
 
 	time.Sleep(time.Second * 10)
 	qm.Del("User 1")
@@ -206,3 +481,199 @@ func Test_cleanName(t *testing.T) {
 	assert.Equal(t, "dj", cleanName("dj@210.x.x.101"))
 	assert.Equal(t, "dj", cleanName("dj"))
 }
+
+type testHistory struct {
+	mtx      sync.Mutex
+	sessions []string
+	turns    []tracks.QueueTurn
+}
+
+func (h *testHistory) SessionStart(time.Time) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.sessions = append(h.sessions, "start")
+}
+
+func (h *testHistory) SessionStop(time.Time) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.sessions = append(h.sessions, "stop")
+}
+
+func (h *testHistory) Turn(turn tracks.QueueTurn) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.turns = append(h.turns, turn)
+}
+
+func TestQueueManager_history(t *testing.T) {
+	history := &testHistory{}
+	qm := NewQueueManager("dj", nil, nil)
+	qm.SetHistory(history)
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+	qm.Add("test3@127.x.x.3")
+
+	qm.OnStart(lib.SoloContext{TrackID: 7}, lib.SoloPolicy{})
+	// test2 has been waiting longer than test3
+	assert.Equal(t, []string{"test2@127.x.x.2", "test3@127.x.x.3"}, waitingNames(qm.Waiting()))
+
+	qm.Next()
+	assert.True(t, qm.Skip("test2@127.x.x.2"))
+	assert.True(t, qm.Del("test3@127.x.x.3"))
+	qm.OnStop()
+
+	assert.Equal(t, []string{"start", "stop"}, history.sessions)
+	if assert.Len(t, history.turns, 4) {
+		assert.Equal(t, "test1@127.x.x.1", history.turns[0].UserName)
+		assert.Equal(t, uint(7), history.turns[0].TrackID)
+		assert.False(t, history.turns[0].Skipped)
+
+		assert.Equal(t, "test2@127.x.x.2", history.turns[1].UserName)
+		assert.True(t, history.turns[1].Skipped)
+
+		assert.Equal(t, "test3@127.x.x.3", history.turns[2].UserName)
+		assert.True(t, history.turns[2].Left)
+
+		// test1 got the turn after test3 left, it ended with the queue stop
+		assert.Equal(t, "test1@127.x.x.1", history.turns[3].UserName)
+	}
+
+	assert.Equal(t, []string{"test2@127.x.x.2"}, waitingNames(qm.Waiting()))
+}
+
+func TestQueueManager_idleDuet(t *testing.T) {
+	var messages []string
+	qm := NewQueueManager("dj", func(msg string) {
+		messages = append(messages, msg)
+	}, nil)
+	qm.SetMode(QueueMode{Kind: QueueModeDuet})
+	qm.SetIdlePolicy(2, 2)
+	qm.OnServerConfigChange(120, 16)
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+	qm.Add("test3@127.x.x.3")
+	qm.Add("test4@127.x.x.4")
+	qm.OnStart(lib.SoloContext{}, lib.SoloPolicy{Kind: lib.SoloPolicySeconds, Value: 600})
+	assert.Equal(t, []string{"test1@127.x.x.1", "test2@127.x.x.2"}, qm.Players())
+
+	// молчит только второй игрок дуэта - его место занимает следующий, первый продолжает играть
+	qm.mtx.Lock()
+	qm.lastActivity["test1@127.x.x.1"] = time.Now().Add(time.Second * 10)
+	qm.mtx.Unlock()
+	messages = nil
+	qm.tick(time.Now().Add(time.Second * 17))
+	assert.Equal(t, []string{"test1@127.x.x.1", "test3@127.x.x.3"}, qm.Players())
+	assert.Equal(t, []string{"test1@127.x.x.1", "test3@127.x.x.3", "test4@127.x.x.4", "test2@127.x.x.2"}, qm.Users())
+	assert.Contains(t, messages, p.Sprintf(messageQueueUserIdle, "test2@127.x.x.2"))
+
+	// молчат оба - ход переходит следующей паре
+	qm.mtx.Lock()
+	delete(qm.lastActivity, "test1@127.x.x.1")
+	qm.mtx.Unlock()
+	qm.tick(time.Now().Add(time.Second * 17))
+	assert.Equal(t, []string{"test4@127.x.x.4", "test2@127.x.x.2"}, qm.Players())
+
+	// второй пропуск подряд удаляет из очереди, молчавший впервые встаёт в конец
+	qm.tick(time.Now().Add(time.Second * 17))
+	assert.Equal(t, []string{"test1@127.x.x.1", "test3@127.x.x.3", "test4@127.x.x.4"}, qm.Users())
+	assert.Contains(t, messages, p.Sprintf(messageQueueUserIdleRemoved, "test2@127.x.x.2"))
+}
+
+func TestQueueManager_SetSubscriber(t *testing.T) {
+	qm := NewQueueManager("dj", nil, nil)
+	var subscribed [][]string
+	qm.SetSubscriber(func(userNames []string) {
+		subscribed = append(subscribed, userNames)
+	})
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+	// очередь не изменилась - повторно не подписываемся
+	qm.Add("test2@127.x.x.2")
+	qm.Del("test1@127.x.x.1")
+
+	assert.Equal(t, [][]string{{"test1@127.x.x.1"}, {"test1@127.x.x.1", "test2@127.x.x.2"}, {"test2@127.x.x.2"}}, subscribed)
+}
+
+func waitingNames(waiting []QueueWaiting) (names []string) {
+	for _, w := range waiting {
+		names = append(names, w.UserName)
+	}
+	return
+}
+
+func TestQueueManager_duet(t *testing.T) {
+	var messages []string
+	qm := NewQueueManager("dj", func(msg string) {
+		messages = append(messages, msg)
+	}, nil)
+	qm.SetMode(QueueMode{Kind: QueueModeDuet})
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+	qm.Add("test3@127.x.x.3")
+
+	qm.OnStart(lib.SoloContext{TrackDuration: time.Minute * 20}, lib.SoloPolicy{})
+	assert.Equal(t, []string{"test1@127.x.x.1", "test2@127.x.x.2"}, qm.Players())
+	assert.Equal(t, []string{p.Sprintf(messageNowPlayingDuet, "test1@127.x.x.1", "test2@127.x.x.2") + ", " +
+		p.Sprintf(messageAreNextDuet, "test3@127.x.x.3", "test1@127.x.x.1")}, messages)
+
+	qm.Next()
+	assert.Equal(t, []string{"test3@127.x.x.3", "test1@127.x.x.1"}, qm.Players())
+	qm.Next()
+	assert.Equal(t, []string{"test2@127.x.x.2", "test3@127.x.x.3"}, qm.Players())
+
+	// the partner leaving restarts the turn with a new pair
+	assert.True(t, qm.Del("test3@127.x.x.3"))
+	assert.Equal(t, []string{"test2@127.x.x.2", "test1@127.x.x.1"}, qm.Players())
+}
+
+func TestQueueManager_random(t *testing.T) {
+	qm := NewQueueManager("dj", nil, nil)
+	qm.SetMode(QueueMode{Kind: QueueModeRandom})
+
+	users := []string{"test1", "test2", "test3", "test4", "test5"}
+	for _, u := range users {
+		qm.Add(u)
+	}
+	qm.OnStart(lib.SoloContext{}, lib.SoloPolicy{})
+
+	// everybody plays once in every round, nobody plays twice in a row
+	prev := ""
+	for round := 0; round < 10; round++ {
+		played := map[string]bool{}
+		for range users {
+			current := qm.Current()
+			assert.NotEqual(t, prev, current)
+			assert.False(t, played[current])
+			played[current] = true
+			prev = current
+			qm.Next()
+		}
+		assert.Len(t, played, len(users))
+	}
+}
+
+func TestQueueManager_trade(t *testing.T) {
+	var messages []string
+	qm := NewQueueManager("dj", func(msg string) {
+		messages = append(messages, msg)
+	}, nil)
+	qm.SetMode(QueueMode{Kind: QueueModeTrade, Bars: 4})
+
+	qm.Add("test1@127.x.x.1")
+	qm.Add("test2@127.x.x.2")
+
+	// 120 BPM, 16 BPI - 4 bars are one interval of 8 seconds
+	qm.OnStart(lib.SoloContext{BPM: 120, BPI: 16}, lib.SoloPolicy{Kind: lib.SoloPolicyBars, Value: 32})
+	messages = nil
+
+	// the turn changes right after 4 bars without the 15 seconds warning
+	qm.tick(time.Now().Add(time.Second * 16).Add(time.Millisecond * 100))
+	assert.Equal(t, "test2@127.x.x.2", qm.Current())
+	// the lineup is the same, nothing to announce
+	assert.Empty(t, messages)
+}
@@ -0,0 +1,66 @@
+package dj
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	QueueModeRoundRobin = "roundrobin" // one soloist at a time in the queue order
+	QueueModeDuet       = "duet"       // two players at a time
+	QueueModeTrade      = "trade"      // players take turns every few bars, turns are rounded to whole intervals
+	QueueModeRandom     = "random"     // one soloist at a time, the order is shuffled every round
+
+	defaultTradeBars = 4
+)
+
+// QueueMode is the way the queue passes turns
+type QueueMode struct {
+	Kind string `json:"kind"`
+	Bars uint   `json:"bars,omitempty"` // length of a turn for trade mode
+}
+
+// ParseQueueMode parses mode from command arguments: duet, trade 4, random or roundrobin
+func ParseQueueMode(args []string) (mode QueueMode, err error) {
+	if len(args) == 0 {
+		err = fmt.Errorf("queue mode is not set")
+		return
+	}
+
+	mode.Kind = strings.ToLower(args[0])
+	switch mode.Kind {
+	case QueueModeRoundRobin, QueueModeDuet, QueueModeRandom:
+		if len(args) > 1 {
+			err = fmt.Errorf("queue mode %s has no arguments", mode.Kind)
+		}
+	case QueueModeTrade:
+		mode.Bars = defaultTradeBars
+		if len(args) > 2 {
+			err = fmt.Errorf("queue mode %s has one argument", mode.Kind)
+			return
+		}
+		if len(args) == 2 {
+			bars, e := strconv.ParseUint(args[1], 10, 32)
+			if e != nil || bars == 0 {
+				err = fmt.Errorf("bad number of bars %s", args[1])
+				return
+			}
+			mode.Bars = uint(bars)
+		}
+	default:
+		err = fmt.Errorf("unknown queue mode %s", args[0])
+	}
+
+	return
+}
+
+func (m QueueMode) String() string {
+	if m.Kind == "" {
+		return QueueModeRoundRobin
+	}
+	if m.Kind == QueueModeTrade {
+		return fmt.Sprintf("%s %d", m.Kind, m.Bars)
+	}
+	return m.Kind
+}
@@ -0,0 +1,37 @@
+package dj
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseQueueMode(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    QueueMode
+		wantErr bool
+	}{
+		{args: []string{"roundrobin"}, want: QueueMode{Kind: QueueModeRoundRobin}},
+		{args: []string{"Duet"}, want: QueueMode{Kind: QueueModeDuet}},
+		{args: []string{"random"}, want: QueueMode{Kind: QueueModeRandom}},
+		{args: []string{"trade"}, want: QueueMode{Kind: QueueModeTrade, Bars: 4}},
+		{args: []string{"trade", "8"}, want: QueueMode{Kind: QueueModeTrade, Bars: 8}},
+		{args: []string{"trade", "0"}, wantErr: true},
+		{args: []string{"trade", "x"}, wantErr: true},
+		{args: []string{"duet", "2"}, wantErr: true},
+		{args: []string{"solo"}, wantErr: true},
+		{args: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseQueueMode(tt.args)
+		if tt.wantErr {
+			assert.Error(t, err, tt.args)
+			continue
+		}
+		assert.NoError(t, err, tt.args)
+		assert.Equal(t, tt.want, got, tt.args)
+	}
+
+	assert.Equal(t, "trade 4", QueueMode{Kind: QueueModeTrade, Bars: 4}.String())
+	assert.Equal(t, "roundrobin", QueueMode{}.String())
+}
@@ -0,0 +1,218 @@
+package dj
+
+import (
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRequests        = 20
+	maxRequestsPerUser = 3
+)
+
+var (
+	errorRequestsLimit    = fmt.Errorf("too many requests")
+	errorRequestDuplicate = fmt.Errorf("track is requested already")
+)
+
+// TrackRequest is a track requested by a user to play after the current one
+type TrackRequest struct {
+	Track       *tracks.Track `json:"track"`
+	UserName    string        `json:"user_name"`
+	RequestedAt time.Time     `json:"requested_at"`
+}
+
+// requestList keeps requested tracks in order of requests
+type requestList struct {
+	mtx      sync.Mutex
+	requests []TrackRequest
+}
+
+// add appends the request and returns its position starting from 1
+func (l *requestList) add(track *tracks.Track, userName string) (position int, err error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	userRequests := 0
+	for _, r := range l.requests {
+		if r.Track.ID == track.ID {
+			return 0, errorRequestDuplicate
+		}
+		if r.UserName == userName {
+			userRequests++
+		}
+	}
+	if len(l.requests) >= maxRequests || userRequests >= maxRequestsPerUser {
+		return 0, errorRequestsLimit
+	}
+
+	l.requests = append(l.requests, TrackRequest{Track: track, UserName: userName, RequestedAt: time.Now()})
+
+	return len(l.requests), nil
+}
+
+// pop takes the first request
+func (l *requestList) pop() (request TrackRequest, ok bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if len(l.requests) == 0 {
+		return
+	}
+	request, l.requests = l.requests[0], l.requests[1:]
+
+	return request, true
+}
+
+func (l *requestList) list() []TrackRequest {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	res := make([]TrackRequest, len(l.requests))
+	copy(res, l.requests)
+
+	return res
+}
+
+// Request finds a track by ID or by title, artist or album and adds it to the requests,
+// the track starts right away if nothing is playing
+func (jm *JamManager) Request(query, userName string) (msg string) {
+	if query == "" {
+		return p.Sprintf(messageRequestEmpty)
+	}
+
+	var track *tracks.Track
+	if id, err := strconv.Atoi(query); err == nil {
+		track, err = jm.jamDB.Track(uint(id))
+		if err == tracks.ErrorNotFound {
+			return p.Sprintf(messageRequestNotFound, query)
+		} else if err != nil {
+			logrus.Error(err)
+			return p.Sprintf(errorGeneral)
+		}
+	} else {
+		found, _, err := jm.jamDB.FindTracks(tracks.TrackFilter{Query: query, Limit: 1})
+		if err != nil {
+			logrus.Error(err)
+			return p.Sprintf(errorGeneral)
+		}
+		if len(found) == 0 {
+			return p.Sprintf(messageRequestNotFound, query)
+		}
+		track = found[0]
+	}
+
+	position, err := jm.requests.add(track, userName)
+	switch err {
+	case nil:
+	case errorRequestDuplicate:
+		return p.Sprintf(messageRequestDuplicate, track)
+	case errorRequestsLimit:
+		return p.Sprintf(messageRequestLimit, userName)
+	default:
+		logrus.Error(err)
+		return p.Sprintf(errorGeneral)
+	}
+
+	msg = p.Sprintf(messageRequestAdded, userName, track, position)
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+	if !jm.playing {
+		if startMsg, ok := jm.playRequest(); ok {
+			msg += "\n" + startMsg
+		}
+	}
+
+	return
+}
+
+// Requests returns requested tracks in order they will play
+func (jm *JamManager) Requests() []TrackRequest {
+	return jm.requests.list()
+}
+
+func (jm *JamManager) RequestsMessage() (msg string) {
+	requests := jm.Requests()
+	if len(requests) == 0 {
+		return p.Sprintf(messageRequestsEmpty)
+	}
+
+	var res []string
+	for i, r := range requests {
+		res = append(res, fmt.Sprintf("%d. %s (%s)", i+1, r.Track, r.UserName))
+	}
+
+	return p.Sprintf(messageRequests, strings.Join(res, "; "))
+}
+
+// Skip stops the track and plays the next requested track or the next track of the playlist
+func (jm *JamManager) Skip() (msg string) {
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	jm.stop()
+
+	if msg, ok := jm.playRequest(); ok {
+		return msg
+	}
+	if ok, err := jm.resumePlaylist(); ok {
+		if err != nil {
+			return jm.playerErrorMessage(err)
+		}
+		return jm.playingMessage()
+	}
+	if jm.playingMode == playingPlaylist {
+		if err := jm.next(); err != nil {
+			return jm.playerErrorMessage(err)
+		}
+		return jm.playingMessage()
+	}
+
+	return
+}
+
+// playRequest starts the first requested track, ok is false if there are no requests.
+// The playlist being played is interrupted and continues when all requested tracks are played.
+// playerMtx must be held
+func (jm *JamManager) playRequest() (msg string, ok bool) {
+	request, found := jm.requests.pop()
+	if !found {
+		return
+	}
+
+	if jm.playingMode == playingPlaylist && jm.playlist != nil {
+		jm.pausedPlaylist, jm.pausedIndex = jm.playlist, jm.playlistIndex()
+	}
+	jm.track = request.Track
+	jm.playlist = nil
+	jm.playingMode = playingTrack
+	if err := jm.LoadTrack(jm.track); err != nil {
+		logrus.Error(err)
+		return p.Sprintf(errorGeneral), true
+	}
+	jm.setRepeats(0)
+
+	return p.Sprintf(messageRequestPlaying, request.UserName) + ", " + jm.startMessage(), true
+}
+
+// resumePlaylist starts the track after the one the playlist was interrupted on by requests,
+// ok is false if no playlist was interrupted. playerMtx must be held
+func (jm *JamManager) resumePlaylist() (ok bool, err error) {
+	if jm.pausedPlaylist == nil {
+		return false, nil
+	}
+	jm.playlist, jm.playingMode = jm.pausedPlaylist, playingPlaylist
+	i := jm.pausedIndex
+	jm.pausedPlaylist = nil
+
+	if i+1 >= len(jm.playlist.Tracks) {
+		return true, &PlayerError{Code: PlayerPlaylistEnd, ID: jm.playlist.ID}
+	}
+
+	return true, jm.playlistTrack(i + 1)
+}
@@ -0,0 +1,119 @@
+package dj
+
+import (
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/lib"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/message"
+	"strings"
+	"sync"
+)
+
+const searchResultsShown = 5
+
+// searchResults keeps the last search results of every user to pick tracks from
+type searchResults struct {
+	mtx     sync.Mutex
+	results map[string][]*tracks.Track
+}
+
+func (s *searchResults) set(userName string, found []*tracks.Track) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.results == nil {
+		s.results = make(map[string][]*tracks.Track)
+	}
+	s.results[userName] = found
+}
+
+// get returns the track number n of the last search of the user, n starts from 1
+func (s *searchResults) get(userName string, n int) (track *tracks.Track, ok bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	found := s.results[userName]
+	if n < 1 || n > len(found) {
+		return
+	}
+
+	return found[n-1], true
+}
+
+// searchFilter makes the filter from chat command args, a key like Am or F# selects the key and mode,
+// bpm=90-120 selects the tempo and the rest are words to find
+func searchFilter(args []string) (filter tracks.TrackFilter) {
+	var words []string
+	for _, arg := range args {
+		if min, max, err := lib.ParseBPMRange(arg); err == nil {
+			filter.BPMMin, filter.BPMMax = min, max
+			continue
+		}
+		if filter.Key == 0 {
+			if keyMode := lib.KeyModeByName(arg); keyMode.Key != 0 {
+				filter.Key, filter.Mode = keyMode.Key, keyMode.Mode
+				continue
+			}
+		}
+		words = append(words, arg)
+	}
+	filter.Query = strings.Join(words, " ")
+
+	return
+}
+
+// Search finds tracks by words and key and replies with a numbered list to pick a track from
+func (jm *JamManager) Search(p *message.Printer, args []string, userName string) (msg string) {
+	if len(args) == 0 {
+		return p.Sprintf(messageSearchEmpty)
+	}
+
+	filter := searchFilter(args)
+	filter.Limit = searchResultsShown
+	found, total, err := jm.jamDB.FindTracks(filter)
+	if err != nil {
+		logrus.Error(err)
+		return p.Sprintf(errorGeneral)
+	}
+	if total == 0 {
+		return p.Sprintf(messageRequestNotFound, strings.Join(args, " "))
+	}
+
+	jm.searches.set(userName, found)
+
+	var res []string
+	for i, track := range found {
+		res = append(res, fmt.Sprintf("%d. %s", i+1, track))
+	}
+
+	msg = p.Sprintf(messageSearchResults, total, strings.Join(res, "; "))
+	if total > len(found) {
+		msg += "\n" + p.Sprintf(messageSearchMore, total-len(found))
+	}
+
+	return msg + "\n" + p.Sprintf(messageSearchPick, jm.jamChatBot.UserName())
+}
+
+// Pick plays the track number n from the last search of the user
+func (jm *JamManager) Pick(n int, userName string) (msg string) {
+	track, ok := jm.searches.get(userName, n)
+	if !ok {
+		return p.Sprintf(messageSearchBadNumber, n)
+	}
+
+	jm.playerMtx.Lock()
+	defer jm.playerMtx.Unlock()
+
+	jm.stop()
+	jm.track = track
+	if err := jm.LoadTrack(jm.track); err != nil {
+		logrus.Error(err)
+		return p.Sprintf(errorGeneral)
+	}
+	jm.setRepeats(0)
+	jm.playlist, jm.pausedPlaylist = nil, nil
+	jm.playingMode = playingTrack
+
+	return jm.startMessage()
+}
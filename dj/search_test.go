@@ -0,0 +1,51 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_searchFilter(t *testing.T) {
+	filter := searchFilter([]string{"blues", "shuffle", "A"})
+	assert.Equal(t, "blues shuffle", filter.Query)
+	assert.Equal(t, tracks.KeyA, filter.Key)
+	assert.Equal(t, tracks.ModeMajor, filter.Mode)
+
+	filter = searchFilter([]string{"Am", "slow", "Dm"})
+	assert.Equal(t, "slow Dm", filter.Query)
+	assert.Equal(t, tracks.KeyA, filter.Key)
+	assert.Equal(t, tracks.ModeMinor, filter.Mode)
+
+	filter = searchFilter([]string{"funk", "bpm=90-120"})
+	assert.Equal(t, uint(90), filter.BPMMin)
+	assert.Equal(t, uint(120), filter.BPMMax)
+
+	filter = searchFilter([]string{"funk"})
+	assert.Equal(t, "funk", filter.Query)
+	assert.Equal(t, tracks.KeyUnknown, filter.Key)
+}
+
+func TestSearchResults(t *testing.T) {
+	s := searchResults{}
+
+	_, ok := s.get("Alice", 1)
+	assert.False(t, ok)
+
+	s.set("Alice", []*tracks.Track{testTrack(1), testTrack(2)})
+	s.set("Bob", []*tracks.Track{testTrack(3)})
+
+	track, ok := s.get("Alice", 2)
+	if assert.True(t, ok) {
+		assert.Equal(t, uint(2), track.ID)
+	}
+	_, ok = s.get("Alice", 3)
+	assert.False(t, ok)
+	_, ok = s.get("Alice", 0)
+	assert.False(t, ok)
+
+	track, ok = s.get("Bob", 1)
+	if assert.True(t, ok) {
+		assert.Equal(t, uint(3), track.ID)
+	}
+}
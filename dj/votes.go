@@ -0,0 +1,188 @@
+package dj
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	VoteSkip = "skip"
+	VoteStop = "stop"
+
+	defaultVoteShare  = 0.5
+	defaultVoteWindow = time.Minute * 2
+)
+
+// VoteStatus is a vote in progress
+type VoteStatus struct {
+	Action    string    `json:"action"`
+	Voters    []string  `json:"voters"`
+	Needed    int       `json:"needed"`     // votes needed for the action to happen
+	ExpiresAt time.Time `json:"expires_at"` // the first vote expires at this time
+}
+
+// voteBox counts votes of active room users, the action happens when share of them
+// have voted within window
+type voteBox struct {
+	mtx    sync.Mutex
+	share  float64
+	window time.Duration
+	votes  map[string]map[string]time.Time // action -> voter -> time of the vote
+}
+
+func newVoteBox(share float64, window time.Duration) *voteBox {
+	if share <= 0 || share > 1 {
+		share = defaultVoteShare
+	}
+	if window <= 0 {
+		window = defaultVoteWindow
+	}
+	return &voteBox{share: share, window: window, votes: make(map[string]map[string]time.Time)}
+}
+
+// vote counts the vote of the user, users are the active room users without the bot,
+// passed votes are cleared
+func (v *voteBox) vote(action, userName string, users []string, now time.Time) (count, needed int, passed bool) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	if v.votes[action] == nil {
+		v.votes[action] = make(map[string]time.Time)
+	}
+	v.votes[action][userName] = now
+
+	count, needed = v.count(action, users, now)
+	if count >= needed {
+		delete(v.votes, action)
+		passed = true
+	}
+
+	return
+}
+
+// clear drops votes for the action, e.g. when the track it was about has stopped
+func (v *voteBox) clear(action string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	delete(v.votes, action)
+}
+
+// status returns votes in progress ordered by action
+func (v *voteBox) status(users []string, now time.Time) (res []VoteStatus) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	res = []VoteStatus{}
+	for action := range v.votes {
+		_, needed := v.count(action, users, now)
+		status := VoteStatus{Action: action, Voters: []string{}, Needed: needed}
+		for voter, t := range v.votes[action] {
+			status.Voters = append(status.Voters, voter)
+			if status.ExpiresAt.IsZero() || t.Add(v.window).Before(status.ExpiresAt) {
+				status.ExpiresAt = t.Add(v.window)
+			}
+		}
+		if len(status.Voters) == 0 {
+			continue
+		}
+		sort.Strings(status.Voters)
+		res = append(res, status)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Action < res[j].Action
+	})
+
+	return
+}
+
+// count drops expired votes and votes of users who have left, mtx must be held
+func (v *voteBox) count(action string, users []string, now time.Time) (count, needed int) {
+	active := make(map[string]bool, len(users))
+	for _, u := range users {
+		active[u] = true
+	}
+
+	for voter, t := range v.votes[action] {
+		if t.Add(v.window).Before(now) || !active[voter] {
+			delete(v.votes[action], voter)
+		}
+	}
+	if len(v.votes[action]) == 0 {
+		delete(v.votes, action)
+	}
+
+	needed = int(math.Ceil(v.share * float64(len(users))))
+	if needed < 1 {
+		needed = 1
+	}
+
+	return len(v.votes[action]), needed
+}
+
+// Vote counts the vote of the user to skip or stop the playing track
+func (jm *JamManager) Vote(action, userName string) (msg string) {
+	jm.playerMtx.Lock()
+	playing := jm.playing
+	jm.playerMtx.Unlock()
+	if !playing {
+		return p.Sprintf(messageVoteNothingPlaying)
+	}
+
+	count, needed, passed := jm.votes.vote(action, userName, jm.activeUsers(), time.Now())
+	format := messageVoteSkip
+	if action == VoteStop {
+		format = messageVoteStop
+	}
+	msg = p.Sprintf(format, userName, count, needed)
+	if !passed {
+		return
+	}
+
+	if action == VoteStop {
+		jm.Stop()
+		return msg + "\n" + p.Sprintf(messageVoteStopPassed)
+	}
+
+	msg += "\n" + p.Sprintf(messageVoteSkipPassed)
+	if skipMsg := jm.Skip(); skipMsg != "" {
+		msg += "\n" + skipMsg
+	}
+
+	return
+}
+
+// Votes returns votes in progress
+func (jm *JamManager) Votes() []VoteStatus {
+	return jm.votes.status(jm.activeUsers(), time.Now())
+}
+
+func (jm *JamManager) VotesMessage() (msg string) {
+	votes := jm.Votes()
+	if len(votes) == 0 {
+		return p.Sprintf(messageVotesEmpty)
+	}
+
+	var res []string
+	for _, v := range votes {
+		res = append(res, p.Sprintf(messageVoteStatus, v.Action, len(v.Voters), v.Needed))
+	}
+
+	return p.Sprintf(messageVotesStatus, strings.Join(res, ", "))
+}
+
+// activeUsers returns users of the room without the bot
+func (jm *JamManager) activeUsers() (users []string) {
+	botName := jm.jamChatBot.UserName()
+	for _, u := range jm.jamChatBot.Users() {
+		if u == botName || cleanName(u) == botName {
+			continue
+		}
+		users = append(users, u)
+	}
+
+	return
+}
@@ -0,0 +1,143 @@
+package dj
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVoteBox_vote(t *testing.T) {
+	now := time.Date(2020, 5, 1, 20, 0, 0, 0, time.UTC)
+	users := []string{"alice", "bob", "carol", "dave", "eve"}
+	v := newVoteBox(0.5, time.Minute)
+
+	count, needed, passed := v.vote(VoteSkip, "alice", users, now)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 3, needed)
+	assert.False(t, passed)
+
+	// the same user votes once
+	count, _, _ = v.vote(VoteSkip, "alice", users, now)
+	assert.Equal(t, 1, count)
+
+	// votes of users who have left are not counted
+	count, _, _ = v.vote(VoteSkip, "bob", users, now.Add(time.Second))
+	assert.Equal(t, 2, count)
+	count, needed, _ = v.vote(VoteSkip, "carol", []string{"alice", "carol", "dave", "eve", "frank"}, now.Add(time.Second*2))
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 3, needed)
+
+	status := v.status(users, now.Add(time.Second*3))
+	if assert.Len(t, status, 1) {
+		assert.Equal(t, []string{"alice", "carol"}, status[0].Voters)
+		assert.Equal(t, now.Add(time.Minute), status[0].ExpiresAt)
+	}
+
+	// expired votes are dropped
+	count, _, passed = v.vote(VoteSkip, "dave", users, now.Add(time.Second*61))
+	assert.Equal(t, 2, count)
+	assert.False(t, passed)
+
+	count, _, passed = v.vote(VoteSkip, "eve", users, now.Add(time.Second*62))
+	assert.Equal(t, 3, count)
+	assert.True(t, passed)
+	assert.Empty(t, v.status(users, now.Add(time.Second*62)))
+}
+
+func TestRequestList(t *testing.T) {
+	l := requestList{}
+
+	for i := uint(1); i <= maxRequestsPerUser; i++ {
+		pos, err := l.add(testTrack(i), "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, int(i), pos)
+	}
+	_, err := l.add(testTrack(10), "alice")
+	assert.Equal(t, errorRequestsLimit, err)
+	_, err = l.add(testTrack(1), "bob")
+	assert.Equal(t, errorRequestDuplicate, err)
+
+	r, ok := l.pop()
+	assert.True(t, ok)
+	assert.Equal(t, uint(1), r.Track.ID)
+	assert.Len(t, l.list(), maxRequestsPerUser-1)
+}
+
+func testTrack(id uint) *tracks.Track {
+	track := &tracks.Track{Title: "test"}
+	track.ID = id
+	return track
+}
+
+func TestJamManager_playRequest_playlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dj")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := tracks.NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	playlist := &tracks.Playlist{Name: "Blues"}
+	var list []*tracks.Track
+	for i := 0; i < 3; i++ {
+		track := &tracks.Track{Title: "Track"}
+		if !assert.NoError(t, jdb.DB().Save(track).Error) {
+			return
+		}
+		list = append(list, track)
+		playlist.Tracks = append(playlist.Tracks, tracks.PlaylistTrack{TrackID: track.ID})
+	}
+	if !assert.NoError(t, jdb.DB().Save(playlist).Error) {
+		return
+	}
+
+	bot := &testChatBot{}
+	jm := &JamManager{jamDB: jdb, jamChatBot: bot, queueManager: NewQueueManager("dj", nil, nil), events: NewEventBus()}
+
+	// плеера нет, поэтому треки только выбираются: играет первый трек плейлиста, во время него заказывают трек
+	loaded, _ := jdb.Playlist(playlist.ID)
+	jm.playlist, jm.track, jm.playingMode = loaded, list[0], playingPlaylist
+	_, err = jm.requests.add(testTrack(100), "bob")
+	assert.NoError(t, err)
+	_, err = jm.requests.add(testTrack(101), "alice")
+	assert.NoError(t, err)
+
+	// трек плейлиста закончился - играют заказы
+	jm.playing = true
+	jm.onStop()
+	assert.Equal(t, uint(100), jm.track.ID)
+	assert.Equal(t, "track", jm.PlayerState().Mode)
+
+	jm.playing = true
+	jm.onStop()
+	assert.Equal(t, uint(101), jm.track.ID)
+
+	// заказы закончились - плейлист продолжается со следующего трека
+	jm.playing = true
+	jm.onStop()
+	assert.Equal(t, list[1].ID, jm.track.ID)
+	if assert.NotNil(t, jm.playlist) {
+		assert.Equal(t, playlist.ID, jm.playlist.ID)
+	}
+	assert.Equal(t, playingPlaylist, jm.playingMode)
+
+	// плейлист, прерванный на последнем треке, заканчивается
+	jm.track = list[2]
+	_, err = jm.requests.add(testTrack(102), "bob")
+	assert.NoError(t, err)
+	jm.playing = true
+	jm.onStop()
+	jm.playing = true
+	bot.messages = nil
+	jm.onStop()
+	assert.Equal(t, []string{p.Sprintf(messagePlaylistFinished)}, bot.messages)
+}
@@ -21,7 +21,7 @@ require (
 	github.com/labstack/gommon v0.3.0 // indirect
 	github.com/luci/go-render v0.0.0-20160219211803-9a04cc21af0f
 	github.com/mattn/go-colorable v0.1.8 // indirect
-	github.com/mattn/go-sqlite3 v1.14.5 // indirect
+	github.com/mattn/go-sqlite3 v1.14.5
 	github.com/satori/go.uuid v1.2.1-0.20181028125025-b2ce2384e17b
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.4.0
@@ -30,8 +30,11 @@ require (
 	github.com/xlab/vorbis-go v0.0.0-20200504083151-f071a4d5d8b6 // indirect
 	github.com/zaf/resample v0.0.0-20200305235742-54008d320155
 	golang.org/x/crypto v0.0.0-20201117144127-c1f2f97bffc9
-	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b // indirect
+	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b
 	golang.org/x/text v0.3.4
 	gopkg.in/yaml.v1 v1.0.0-20140924161607-9f9df34309c0 // indirect
 	gopkg.in/yaml.v2 v2.3.0
 )
+
+// models and ninjam-bot with intervals of other users and private messages, see third_party/ninjam-chatbot
+replace github.com/ayvan/ninjam-chatbot => ./third_party/ninjam-chatbot
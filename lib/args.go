@@ -0,0 +1,190 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type ArgKind uint
+
+const (
+	ArgWord     ArgKind = iota + 1 // any word
+	ArgNumber                      // whole number
+	ArgID                          // ID of a track or playlist
+	ArgKey                         // key like Am or F#
+	ArgTags                        // [blues, rock]
+	ArgDuration                    // (10m), 7:30, 5 loops, 3 choruses or 32 bars
+	ArgBPM                         // bpm=90-120
+	ArgUser                        // NINJAM user name
+	ArgText                        // the rest of the line
+)
+
+// ArgSpec describes an argument of a chat command
+type ArgSpec struct {
+	Name     string
+	Kind     ArgKind
+	Optional bool
+}
+
+// String returns the argument for the command usage: <user>, [tags], (duration), optional ones end with ?
+func (a ArgSpec) String() (res string) {
+	switch a.Kind {
+	case ArgTags:
+		res = "[" + a.Name + "]"
+	case ArgDuration:
+		res = "(" + a.Name + ")"
+	case ArgText:
+		res = "<" + a.Name + "...>"
+	default:
+		res = "<" + a.Name + ">"
+	}
+	if a.Optional {
+		res += "?"
+	}
+
+	return
+}
+
+// Args are parsed arguments of a chat command, numbers, users and words are in order of the arguments
+type Args struct {
+	Key     uint
+	Mode    uint
+	ID      uint
+	Numbers []int
+	Tags    []string
+	Length  PlayLength
+	BPMMin  uint
+	BPMMax  uint
+	Users   []string
+	Words   []string
+	Text    string
+}
+
+const (
+	ArgMissing    = iota + 1 // a required argument is not given
+	ArgBad                   // the value doesn't fit the argument
+	ArgUnexpected            // the value is left after all arguments
+)
+
+// ArgError is an error of one argument
+type ArgError struct {
+	Reason uint
+	Arg    ArgSpec
+	Value  string
+}
+
+func (e *ArgError) Error() string {
+	switch e.Reason {
+	case ArgMissing:
+		return fmt.Sprintf("missing argument %s", e.Arg)
+	case ArgBad:
+		return fmt.Sprintf("bad argument %s: %s", e.Arg, e.Value)
+	}
+	return fmt.Sprintf("unexpected argument %s", e.Value)
+}
+
+// ParseArgs matches every token to the first argument spec which accepts it, optional arguments
+// may go in any order but not before the required argument which is not given yet
+func ParseArgs(specs []ArgSpec, tokens []Token) (args Args, err error) {
+	given := make([]bool, len(specs))
+
+tokens:
+	for i, token := range tokens {
+		for j, spec := range specs {
+			if given[j] {
+				continue
+			}
+			if spec.Kind == ArgText {
+				var raw []string
+				for _, t := range tokens[i:] {
+					raw = append(raw, t.Raw)
+				}
+				args.Text = strings.Join(raw, " ")
+				given[j] = true
+				break tokens
+			}
+			if args.set(spec.Kind, token) {
+				given[j] = true
+				continue tokens
+			}
+			if !spec.Optional {
+				return args, &ArgError{Reason: ArgBad, Arg: spec, Value: token.Raw}
+			}
+		}
+
+		return args, &ArgError{Reason: ArgUnexpected, Value: token.Raw}
+	}
+
+	for j, spec := range specs {
+		if !given[j] && !spec.Optional {
+			return args, &ArgError{Reason: ArgMissing, Arg: spec}
+		}
+	}
+
+	return
+}
+
+// set parses the token as the argument of kind, false if it doesn't fit
+func (args *Args) set(kind ArgKind, token Token) bool {
+	switch kind {
+	case ArgTags:
+		if token.Kind != TokenTags {
+			return false
+		}
+		args.Tags = parseTags(token.Text)
+		return true
+	case ArgDuration:
+		if token.Kind == TokenTags {
+			return false
+		}
+		if _, err := strconv.Atoi(token.Text); err == nil && token.Kind == TokenWord {
+			return false
+		}
+		length, err := ParseLength(token.Text)
+		if err != nil {
+			return false
+		}
+		args.Length = length
+		return true
+	}
+
+	if token.Kind != TokenWord {
+		return false
+	}
+
+	switch kind {
+	case ArgNumber:
+		n, err := strconv.Atoi(token.Text)
+		if err != nil {
+			return false
+		}
+		args.Numbers = append(args.Numbers, n)
+	case ArgID:
+		id, err := strconv.ParseUint(token.Text, 10, 32)
+		if err != nil || id == 0 {
+			return false
+		}
+		args.ID = uint(id)
+	case ArgBPM:
+		min, max, err := ParseBPMRange(token.Text)
+		if err != nil {
+			return false
+		}
+		args.BPMMin, args.BPMMax = min, max
+	case ArgKey:
+		keyMode := KeyModeByName(token.Text)
+		if keyMode.Key == 0 {
+			return false
+		}
+		args.Key, args.Mode = keyMode.Key, keyMode.Mode
+	case ArgUser:
+		args.Users = append(args.Users, token.Text)
+	case ArgWord:
+		args.Words = append(args.Words, token.Text)
+	default:
+		return false
+	}
+
+	return true
+}
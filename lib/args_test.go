@@ -0,0 +1,224 @@
+package lib
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize(" random Am [blues, rock](5m) ")
+	assert.NoError(t, err)
+	assert.Equal(t, []Token{
+		{Kind: TokenWord, Text: "random", Raw: "random"},
+		{Kind: TokenWord, Text: "Am", Raw: "Am"},
+		{Kind: TokenTags, Text: "blues, rock", Raw: "[blues, rock]"},
+		{Kind: TokenDuration, Text: "5m", Raw: "(5m)"},
+	}, tokens)
+
+	_, err = Tokenize("random [blues")
+	assert.Error(t, err)
+}
+
+func TestParseArgs(t *testing.T) {
+	random := []ArgSpec{
+		{Name: "key", Kind: ArgKey, Optional: true},
+		{Name: "tags", Kind: ArgTags, Optional: true},
+		{Name: "duration", Kind: ArgDuration, Optional: true},
+	}
+	qmove := []ArgSpec{{Name: "user", Kind: ArgUser}, {Name: "position", Kind: ArgNumber}}
+
+	parse := func(specs []ArgSpec, s string) (Args, error) {
+		tokens, err := Tokenize(s)
+		if !assert.NoError(t, err) {
+			return Args{}, err
+		}
+		return ParseArgs(specs, tokens)
+	}
+
+	args, err := parse(random, "Am [blues] (10m)")
+	assert.NoError(t, err)
+	assert.Equal(t, Args{Key: tracks.KeyA, Mode: tracks.ModeMinor, Tags: []string{"blues"}, Length: PlayLength{Duration: 10 * time.Minute}}, args)
+
+	args, err = parse(random, "(10m)")
+	assert.NoError(t, err)
+	assert.Equal(t, Args{Length: PlayLength{Duration: 10 * time.Minute}}, args)
+
+	_, err = parse(random, "blues")
+	assert.Equal(t, &ArgError{Reason: ArgUnexpected, Value: "blues"}, err)
+
+	args, err = parse(qmove, "Bob 2")
+	assert.NoError(t, err)
+	assert.Equal(t, Args{Users: []string{"Bob"}, Numbers: []int{2}}, args)
+
+	_, err = parse(qmove, "Bob")
+	assert.Equal(t, &ArgError{Reason: ArgMissing, Arg: qmove[1]}, err)
+
+	_, err = parse(qmove, "Bob two")
+	assert.Equal(t, &ArgError{Reason: ArgBad, Arg: qmove[1], Value: "two"}, err)
+	assert.Equal(t, "bad argument <position>: two", err.Error())
+
+	args, err = parse([]ArgSpec{{Name: "words", Kind: ArgText}}, "blues  shuffle [A]")
+	assert.NoError(t, err)
+	assert.Equal(t, "blues shuffle [A]", args.Text)
+}
+
+func TestArgSpec_String(t *testing.T) {
+	assert.Equal(t, "<user>", ArgSpec{Name: "user", Kind: ArgUser}.String())
+	assert.Equal(t, "[tags]?", ArgSpec{Name: "tags", Kind: ArgTags, Optional: true}.String())
+	assert.Equal(t, "(duration)?", ArgSpec{Name: "duration", Kind: ArgDuration, Optional: true}.String())
+	assert.Equal(t, "<words...>", ArgSpec{Name: "words", Kind: ArgText}.String())
+}
+
+func TestParseLength(t *testing.T) {
+	cases := map[string]PlayLength{
+		"5 loops":    {Loops: 5},
+		"1 loop":     {Loops: 1},
+		"3 Choruses": {Loops: 3},
+		"32 bars":    {Bars: 32},
+		"7:30":       {Duration: time.Minute*7 + time.Second*30},
+		"0:45":       {Duration: time.Second * 45},
+		"1:00:00":    {Duration: time.Hour},
+		"10m":        {Duration: time.Minute * 10},
+		"5m 30s":     {Duration: time.Minute*5 + time.Second*30},
+	}
+	for s, expected := range cases {
+		l, err := ParseLength(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, l, s)
+	}
+
+	for _, s := range []string{"", "5", "0 loops", "five loops", "7:3", "7:60", "1:2:3:4", "-5m", "blues"} {
+		_, err := ParseLength(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseBPMRange(t *testing.T) {
+	cases := map[string][2]uint{
+		"bpm=90-120": {90, 120},
+		"BPM=100":    {100, 100},
+		"bpm=90-":    {90, 0},
+		"bpm=-120":   {0, 120},
+	}
+	for s, expected := range cases {
+		min, max, err := ParseBPMRange(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, [2]uint{min, max}, s)
+	}
+
+	for _, s := range []string{"bpm=", "bpm=-", "bpm=120-90", "bpm=fast", "tempo=90", "bpm=1-2-3"} {
+		_, _, err := ParseBPMRange(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseArgs_anyOrder(t *testing.T) {
+	random := []ArgSpec{
+		{Name: "key", Kind: ArgKey, Optional: true},
+		{Name: "bpm", Kind: ArgBPM, Optional: true},
+		{Name: "tags", Kind: ArgTags, Optional: true},
+		{Name: "length", Kind: ArgDuration, Optional: true},
+	}
+
+	tokens, err := Tokenize(`random 32 bars ["slow blues"] bpm=60-80 B♭m`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	args, err := ParseArgs(random, tokens[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, Args{
+		Key: tracks.KeyASharp, Mode: tracks.ModeMinor, BPMMin: 60, BPMMax: 80,
+		Tags: []string{"slow blues"}, Length: PlayLength{Bars: 32},
+	}, args)
+
+	// a number is not a length without a unit
+	tokens, _ = Tokenize("5")
+	_, err = ParseArgs(random, tokens)
+	assert.Equal(t, &ArgError{Reason: ArgUnexpected, Value: "5"}, err)
+}
+
+func TestParseArgs_random(t *testing.T) {
+	// аргументы команды random в dj
+	random := []ArgSpec{
+		{Name: "key", Kind: ArgKey, Optional: true},
+		{Name: "bpm=min-max", Kind: ArgBPM, Optional: true},
+		{Name: "tags", Kind: ArgTags, Optional: true},
+		{Name: "length", Kind: ArgDuration, Optional: true},
+	}
+
+	cases := map[string]Args{
+		"random":                            {},
+		"  	 random  ":                      {},
+		"random A":                          {Key: tracks.KeyA, Mode: tracks.ModeMajor},
+		"random Dm [metal,death]":           {Key: tracks.KeyD, Mode: tracks.ModeMinor, Tags: []string{"metal", "death"}},
+		"random C [metal,death] (10m)":      {Key: tracks.KeyC, Mode: tracks.ModeMajor, Tags: []string{"metal", "death"}, Length: PlayLength{Duration: time.Minute * 10}},
+		"random Bb":                         {Key: tracks.KeyASharp, Mode: tracks.ModeMajor},
+		"random Ebm":                        {Key: tracks.KeyDSharp, Mode: tracks.ModeMinor},
+		"random Am 5 loops":                 {Key: tracks.KeyA, Mode: tracks.ModeMinor, Length: PlayLength{Loops: 5}},
+		"random (3 choruses)":               {Length: PlayLength{Loops: 3}},
+		"random Dm 32 bars":                 {Key: tracks.KeyD, Mode: tracks.ModeMinor, Length: PlayLength{Bars: 32}},
+		"random 1 bar":                      {Length: PlayLength{Bars: 1}},
+		"random 7:30":                       {Length: PlayLength{Duration: time.Minute*7 + time.Second*30}},
+		"random (1:05:00)":                  {Length: PlayLength{Duration: time.Hour + time.Minute*5}},
+		"random 10m":                        {Length: PlayLength{Duration: time.Minute * 10}},
+		"random [blues] (5m 30s)":           {Tags: []string{"blues"}, Length: PlayLength{Duration: time.Minute*5 + time.Second*30}},
+		"random bpm=90-120":                 {BPMMin: 90, BPMMax: 120},
+		"random BPM=100 C":                  {Key: tracks.KeyC, Mode: tracks.ModeMajor, BPMMin: 100, BPMMax: 100},
+		"random bpm=-120":                   {BPMMax: 120},
+		" random   [metal,  death]":         {Tags: []string{"metal", "death"}},
+		`random ["slow rock", blues]`:       {Tags: []string{"slow rock", "blues"}},
+		`random ["rock, roll", "r&b"]`:      {Tags: []string{"rock, roll", "r&b"}},
+		"random [блюз, Рок-н-ролл]":         {Tags: []string{"блюз", "Рок-н-ролл"}},
+		"random F# [blues] bpm=80- 3 loops": {Key: tracks.KeyFSharp, Mode: tracks.ModeMajor, Tags: []string{"blues"}, BPMMin: 80, Length: PlayLength{Loops: 3}},
+	}
+	for s, expected := range cases {
+		tokens, err := Tokenize(s)
+		if !assert.NoError(t, err, s) {
+			continue
+		}
+		args, err := ParseArgs(random, tokens[1:])
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, args, s)
+	}
+
+	// ID трека random не принимает
+	for s, value := range map[string]string{"random Ebm 12": "12", "random 12 Ebm": "12", "random Am Dm": "Dm"} {
+		tokens, _ := Tokenize(s)
+		_, err := ParseArgs(random, tokens[1:])
+		assert.Equal(t, &ArgError{Reason: ArgUnexpected, Value: value}, err, s)
+	}
+
+	_, err := Tokenize("random [blues")
+	assert.Error(t, err)
+}
+
+func TestParseArgs_idAndUsers(t *testing.T) {
+	id := []ArgSpec{{Name: "id", Kind: ArgID}}
+	for s, expected := range map[string]uint{" track  123": 123, " play 123   ": 123, "\tlist  54": 54, "\tplaylist  279": 279} {
+		tokens, err := Tokenize(s)
+		if !assert.NoError(t, err, s) {
+			continue
+		}
+		args, err := ParseArgs(id, tokens[1:])
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, args.ID, s)
+	}
+
+	users := []ArgSpec{{Name: "user", Kind: ArgUser}, {Name: "with", Kind: ArgUser, Optional: true}}
+	for s, expected := range map[string][]string{
+		" qswap  Alice  Bob ":  {"Alice", "Bob"},
+		"qmove Bob@127.0.0.x":  {"Bob@127.0.0.x"},
+		"qfirst\tAlice":        {"Alice"},
+		`qskip "Alice Cooper"`: {"Alice Cooper"},
+	} {
+		tokens, err := Tokenize(s)
+		if !assert.NoError(t, err, s) {
+			continue
+		}
+		args, err := ParseArgs(users, tokens[1:])
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, args.Users, s)
+	}
+}
@@ -1,138 +1,135 @@
 package lib
 
 import (
-	"regexp"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
+type TokenKind uint
+
 const (
-	CommandUnknown = iota
-	CommandRandom
-	CommandTrack
-	CommandPlaylist
-	CommandStop
-	CommandPlay
-	CommandNext
-	CommandPrev
-	CommandPlaying
-	CommandHelp
-	CommandQStart
-	CommandQFinish
-	CommandQNext
-	CommandQLeave
-	CommandQJoin
-	CommandVoiceTest
+	TokenWord     TokenKind = iota + 1
+	TokenTags               // [blues, "slow rock"]
+	TokenDuration           // (10m), (5 loops) or 5 loops
 )
 
-var commandAliases = map[uint][]string{
-	CommandRandom:    {"random"},
-	CommandTrack:     {"track"},
-	CommandPlaylist:  {"playlist", "list"},
-	CommandStop:      {"stop"},
-	CommandPlay:      {"play", "start"},
-	CommandNext:      {"next"},
-	CommandPrev:      {"prev", "previous"},
-	CommandPlaying:   {"playing", "current", "now"},
-	CommandHelp:      {"help"},
-	CommandQStart:    {"qstart", "qs"},
-	CommandQFinish:   {"qfinish", "qf"},
-	CommandQNext:     {"qnext", "qn"},
-	CommandQLeave:    {"qleave", "ql"},
-	CommandQJoin:     {"qjoin", "qj"},
-	CommandVoiceTest: {"vt"},
+// Token is a word or a bracketed group of the chat command
+type Token struct {
+	Kind TokenKind
+	Text string // the word without quotes or the text inside the brackets
+	Raw  string // the token as typed
 }
 
-var commandMap = make(map[string]uint)
+var closingBrackets = map[rune]rune{'[': ']', '(': ')'}
+
+// Tokenize splits the chat command into words, "quoted words", [tags] and (duration) groups,
+// a number followed by loops, choruses or bars is a duration too
+func Tokenize(command string) (tokens []Token, err error) {
+	runes := []rune(command)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case closingBrackets[r] != 0 || r == '"':
+			closing := closingBrackets[r]
+			if r == '"' {
+				closing = '"'
+			}
+			end := closingIndex(runes, i+1, closing)
+			if end == -1 {
+				return nil, fmt.Errorf("%c is not closed", r)
+			}
+			token := Token{Kind: TokenWord, Text: string(runes[i+1 : end]), Raw: string(runes[i : end+1])}
+			switch r {
+			case '[':
+				token.Kind = TokenTags
+				token.Text = strings.TrimSpace(token.Text)
+			case '(':
+				token.Kind = TokenDuration
+				token.Text = strings.TrimSpace(token.Text)
+			}
+			tokens = append(tokens, token)
+			i = end + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && closingBrackets[runes[j]] == 0 && runes[j] != '"' {
+				j++
+			}
+			word := string(runes[i:j])
+			if n := len(tokens); n > 0 && isLengthUnit(word) && isCount(tokens[n-1]) {
+				tokens[n-1] = Token{Kind: TokenDuration, Text: tokens[n-1].Text + " " + word, Raw: tokens[n-1].Raw + " " + word}
+			} else {
+				tokens = append(tokens, Token{Kind: TokenWord, Text: word, Raw: word})
+			}
+			i = j
+		}
+	}
+
+	return
+}
 
-func init() {
-	for command, aliases := range commandAliases {
-		for _, alias := range aliases {
-			commandMap[alias] = command
+// closingIndex returns the index of closing starting from i skipping quoted text, -1 if not found
+func closingIndex(runes []rune, i int, closing rune) int {
+	quoted := false
+	for ; i < len(runes); i++ {
+		switch {
+		case runes[i] == closing && (!quoted || closing == '"'):
+			return i
+		case runes[i] == '"':
+			quoted = !quoted
 		}
 	}
+	return -1
 }
 
-type JamChatCommand struct {
-	Command  string
-	Param    string
-	Tags     []string
-	ID       uint
-	Duration time.Duration
+func isCount(token Token) bool {
+	if token.Kind != TokenWord || token.Raw != token.Text {
+		return false
+	}
+	_, err := strconv.ParseUint(token.Text, 10, 32)
+	return err == nil
 }
 
 type JamCommand struct {
-	Command  uint
 	Param    string
 	Key      uint
 	Mode     uint
 	ID       uint
 	Tags     []uint
 	Duration time.Duration
+	Loops    uint
+	Bars     uint
+	BPMMin   uint
+	BPMMax   uint
 }
 
-func commandByName(name string) uint {
-	return commandMap[strings.ToLower(name)]
-}
-
-var commandRegexp = regexp.MustCompile(`(\w+)[ \t]*([\w#]*)[ \t]*(?:\[([\w, ]+)\])*[\t ]*(?:\(([\w ]+)\))*`)
-
-func CommandParse(command string) (jamCommand JamChatCommand) {
-	commandStrings := commandRegexp.FindStringSubmatch(command)
-
-	if len(commandStrings) == 0 {
-		return
-	}
-
-	jamCommand = JamChatCommand{}
-
-	jamCommand.Command = strings.Trim(commandStrings[1], " ")
-
-	if len(commandStrings) > 2 {
-		commParam := strings.Trim(commandStrings[2], " ")
-
-		if id, err := strconv.Atoi(commParam); err == nil {
-			jamCommand.ID = uint(id)
-		} else {
-			jamCommand.Param = commParam
+// parseTags splits comma separated tags, tags with commas or spaces around may be quoted
+func parseTags(s string) (tags []string) {
+	var tag []rune
+	quoted := false
+	add := func() {
+		if t := strings.TrimSpace(string(tag)); t != "" {
+			tags = append(tags, strings.Trim(t, `"`))
 		}
+		tag = tag[:0]
 	}
 
-	if len(commandStrings) > 3 {
-		tagsString := strings.Trim(commandStrings[3], " []")
-		if tagsString != "" {
-
-			tags := strings.Split(tagsString, ",")
-			for i, tag := range tags {
-				tags[i] = strings.Trim(tag, " ")
-			}
-			jamCommand.Tags = tags
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			tag = append(tag, r)
+		case r == ',' && !quoted:
+			add()
+		default:
+			tag = append(tag, r)
 		}
 	}
-	if len(commandStrings) > 4 {
-		commParam := strings.Trim(commandStrings[4], " ")
-		commParam = strings.Replace(commParam, " ", "", -1)
-		duration, err := time.ParseDuration(commParam)
-		if err == nil {
-			jamCommand.Duration = duration
-		}
-	}
-
-	return
-}
-
-func Command(jamChatCommand JamChatCommand) (command JamCommand) {
-
-	command.Command = commandByName(jamChatCommand.Command)
-	command.Param = jamChatCommand.Param
-
-	keyMode := KeyModeByName(jamChatCommand.Param)
-	command.Key = keyMode.Key
-	command.Mode = keyMode.Mode
-
-	command.ID = jamChatCommand.ID
-	command.Duration = jamChatCommand.Duration
+	add()
 
 	return
 }
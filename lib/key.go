@@ -14,8 +14,8 @@ type KeyMode struct {
 var keysAliases = map[uint][]string{
 	tracks.KeyA:      {"A"},
 	tracks.KeyASharp: {"A#", "Bb"},
-	tracks.KeyB:      {"B"},
-	tracks.KeyC:      {"C"},
+	tracks.KeyB:      {"B", "Cb"},
+	tracks.KeyC:      {"C", "B#"},
 	tracks.KeyCSharp: {"C#", "Db"},
 	tracks.KeyD:      {"D"},
 	tracks.KeyDSharp: {"D#", "Eb"},
@@ -27,8 +27,8 @@ var keysAliases = map[uint][]string{
 }
 
 var modesAliases = map[uint][]string{
-	tracks.ModeMinor: {"m", "minor"},
-	tracks.ModeMajor: {"", "major"},
+	tracks.ModeMinor: {"m", "min", "minor"},
+	tracks.ModeMajor: {"", "maj", "major"},
 }
 
 var keysMap = make(map[string]KeyMode)
@@ -47,6 +47,8 @@ func init() {
 	}
 }
 
+// KeyModeByName returns the key and mode by name like Am, Ebm, F#, B♭ or Dmaj, zero if the name is not a key
 func KeyModeByName(name string) KeyMode {
+	name = strings.NewReplacer("♭", "b", "♯", "#").Replace(name)
 	return keysMap[strings.ToLower(name)]
 }
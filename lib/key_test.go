@@ -22,4 +22,18 @@ func TestKeyModeByName(t *testing.T) {
 	keyMode = KeyModeByName("Gm")
 	assert.Equal(t, tracks.KeyG, keyMode.Key)
 	assert.Equal(t, tracks.ModeMinor, keyMode.Mode)
+
+	keyMode = KeyModeByName("Ebm")
+	assert.Equal(t, tracks.KeyDSharp, keyMode.Key)
+	assert.Equal(t, tracks.ModeMinor, keyMode.Mode)
+
+	keyMode = KeyModeByName("G♭min")
+	assert.Equal(t, tracks.KeyFSharp, keyMode.Key)
+	assert.Equal(t, tracks.ModeMinor, keyMode.Mode)
+
+	keyMode = KeyModeByName("Dmaj")
+	assert.Equal(t, tracks.KeyD, keyMode.Key)
+	assert.Equal(t, tracks.ModeMajor, keyMode.Mode)
+
+	assert.Equal(t, KeyMode{}, KeyModeByName("blues"))
 }
@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlayLength is how long to play a track: time, loops of the track or bars, only one of them is set
+type PlayLength struct {
+	Duration time.Duration
+	Loops    uint // повторы зацикленной части трека, chorus - то же самое
+	Bars     uint
+}
+
+var lengthUnits = map[string]func(n uint) PlayLength{
+	"loop":     func(n uint) PlayLength { return PlayLength{Loops: n} },
+	"loops":    func(n uint) PlayLength { return PlayLength{Loops: n} },
+	"chorus":   func(n uint) PlayLength { return PlayLength{Loops: n} },
+	"choruses": func(n uint) PlayLength { return PlayLength{Loops: n} },
+	"bar":      func(n uint) PlayLength { return PlayLength{Bars: n} },
+	"bars":     func(n uint) PlayLength { return PlayLength{Bars: n} },
+}
+
+func isLengthUnit(s string) bool {
+	_, ok := lengthUnits[strings.ToLower(s)]
+	return ok
+}
+
+// ParseLength parses 5 loops, 3 choruses, 32 bars, 7:30, 1:05:00 or Go durations like 10m or 5m 30s
+func ParseLength(s string) (l PlayLength, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if fields := strings.Fields(s); len(fields) == 2 && isLengthUnit(fields[1]) {
+		n, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil || n == 0 {
+			return l, fmt.Errorf("bad length %s", s)
+		}
+		return lengthUnits[fields[1]](uint(n)), nil
+	}
+
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return l, fmt.Errorf("bad length %s", s)
+		}
+		for i, part := range parts {
+			n, err := strconv.ParseUint(part, 10, 32)
+			if err != nil || (i > 0 && (len(part) != 2 || n > 59)) {
+				return l, fmt.Errorf("bad length %s", s)
+			}
+			l.Duration = l.Duration*60 + time.Duration(n)*time.Second
+		}
+		return
+	}
+
+	l.Duration, err = time.ParseDuration(strings.Replace(s, " ", "", -1))
+	if err == nil && l.Duration <= 0 {
+		err = fmt.Errorf("bad length %s", s)
+	}
+
+	return
+}
+
+// ParseBPMRange parses bpm=90-120, bpm=100, bpm=90- or bpm=-120, zero means no limit
+func ParseBPMRange(s string) (min, max uint, err error) {
+	s = strings.ToLower(s)
+	if !strings.HasPrefix(s, "bpm=") {
+		return 0, 0, fmt.Errorf("bad BPM range %s", s)
+	}
+	s = strings.TrimPrefix(s, "bpm=")
+
+	parse := func(v string) (uint, error) {
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		return uint(n), err
+	}
+
+	parts := strings.Split(s, "-")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		min, err = parse(parts[0])
+		max = min
+	case len(parts) == 2 && (parts[0] != "" || parts[1] != ""):
+		if min, err = parse(parts[0]); err == nil {
+			max, err = parse(parts[1])
+		}
+	default:
+		err = fmt.Errorf("bad BPM range %s", s)
+	}
+	if err == nil && max != 0 && min > max {
+		err = fmt.Errorf("bad BPM range %s", s)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad BPM range bpm=%s", s)
+	}
+
+	return
+}
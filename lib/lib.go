@@ -2,8 +2,7 @@ package lib
 
 import "time"
 
+// CalcUserPlayDuration divides the track into whole 105-second slots
 func CalcUserPlayDuration(trackDuration time.Duration) time.Duration {
-
-	plays := trackDuration / (time.Second * 105)
-	return trackDuration / plays
+	return SoloPolicy{Kind: SoloPolicySlots}.Duration(SoloContext{TrackDuration: trackDuration})
 }
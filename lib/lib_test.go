@@ -21,3 +21,8 @@ func Test_calcUserPlayDuration(t *testing.T) {
 	dur = CalcUserPlayDuration(time.Minute*5 + time.Second*30)
 	assert.Equal(t, time.Minute*1+time.Second*50, dur)
 }
+
+func Test_calcUserPlayDuration_shortTrack(t *testing.T) {
+	dur := CalcUserPlayDuration(time.Second * 30)
+	assert.Equal(t, time.Second*30, dur)
+}
@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"time"
+)
+
+// TokenBucket allows up to size events at once and refills size tokens every period,
+// it is not safe for concurrent use
+type TokenBucket struct {
+	size   float64
+	period time.Duration
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(size uint, period time.Duration) *TokenBucket {
+	return &TokenBucket{size: float64(size), period: period, tokens: float64(size)}
+}
+
+// Allow takes a token if there is one
+func (b *TokenBucket) Allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Full reports whether the bucket has refilled completely, such bucket may be dropped
+func (b *TokenBucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.size
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) && b.period > 0 {
+		b.tokens += b.size * float64(now.Sub(b.last)) / float64(b.period)
+		if b.tokens > b.size {
+			b.tokens = b.size
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
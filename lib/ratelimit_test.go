@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Allow(t *testing.T) {
+	now := time.Date(2020, 5, 1, 20, 0, 0, 0, time.UTC)
+	b := NewTokenBucket(3, time.Minute)
+
+	assert.True(t, b.Allow(now))
+	assert.True(t, b.Allow(now))
+	assert.True(t, b.Allow(now))
+	assert.False(t, b.Allow(now))
+	assert.False(t, b.Full(now))
+
+	// one token per 20 seconds
+	assert.False(t, b.Allow(now.Add(time.Second*19)))
+	assert.True(t, b.Allow(now.Add(time.Second*21)))
+	assert.False(t, b.Allow(now.Add(time.Second*22)))
+
+	assert.True(t, b.Full(now.Add(time.Minute*5)))
+	assert.True(t, b.Allow(now.Add(time.Minute*5)))
+}
@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// solo length policies, they define how long each musician in the queue plays
+const (
+	SoloPolicySlots     = "slots"     // track is divided into whole slots of Value seconds (105 by default)
+	SoloPolicySeconds   = "seconds"   // every turn lasts Value seconds
+	SoloPolicyBars      = "bars"      // every turn lasts Value bars of 4 beats
+	SoloPolicyIntervals = "intervals" // every turn lasts Value NINJAM intervals
+	SoloPolicySplit     = "split"     // track is split equally between the queue members
+)
+
+// DefaultSoloSlot is used when the policy can't calculate turn length, e.g. queue is started without a track
+const DefaultSoloSlot = time.Second * 105
+
+// BeatsPerBar is the bar length, bars are counted in 4/4
+const BeatsPerBar = 4
+
+type SoloPolicy struct {
+	Kind  string `json:"kind" yaml:"kind"`
+	Value uint   `json:"value" yaml:"value"`
+}
+
+// SoloContext describes the track the queue plays over
+type SoloContext struct {
+	TrackID       uint          // 0 if the queue is started without a track
+	TrackDuration time.Duration // 0 if the queue is started without a track
+	BPM           uint
+	BPI           uint
+	Users         uint // number of users in the queue
+}
+
+func IntervalDuration(bpm, bpi uint) time.Duration {
+	if bpm == 0 {
+		return 0
+	}
+
+	return time.Duration(bpi) * time.Minute / time.Duration(bpm)
+}
+
+func (sp SoloPolicy) Valid() error {
+	switch sp.Kind {
+	case "", SoloPolicySlots, SoloPolicySplit:
+		return nil
+	case SoloPolicySeconds, SoloPolicyBars, SoloPolicyIntervals:
+		if sp.Value == 0 {
+			return fmt.Errorf("solo policy %s requires value", sp.Kind)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown solo policy %s", sp.Kind)
+}
+
+// Duration returns length of the user turn, if BPM and BPI are known it is a whole number of intervals,
+// so turns change on interval boundaries
+func (sp SoloPolicy) Duration(c SoloContext) time.Duration {
+	interval := IntervalDuration(c.BPM, c.BPI)
+	value := time.Duration(sp.Value)
+
+	var d time.Duration
+	switch sp.Kind {
+	case SoloPolicySeconds:
+		d = value * time.Second
+	case SoloPolicyBars:
+		if c.BPM > 0 {
+			d = value * BeatsPerBar * time.Minute / time.Duration(c.BPM)
+		}
+	case SoloPolicyIntervals:
+		d = value * interval
+	case SoloPolicySplit:
+		users := c.Users
+		if users == 0 {
+			users = 1
+		}
+		d = c.TrackDuration / time.Duration(users)
+	default:
+		slot := value * time.Second
+		if slot == 0 {
+			slot = DefaultSoloSlot
+		}
+		if c.TrackDuration > 0 {
+			plays := c.TrackDuration / slot
+			if plays == 0 {
+				// track is shorter than one slot - the whole track is one turn
+				plays = 1
+			}
+			d = c.TrackDuration / plays
+		}
+	}
+
+	if d <= 0 {
+		d = DefaultSoloSlot
+	}
+
+	return alignToInterval(d, interval)
+}
+
+// alignToInterval rounds duration to the nearest whole number of intervals, but not less than one interval
+func alignToInterval(d, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return d
+	}
+
+	n := (d + interval/2) / interval
+	if n < 1 {
+		n = 1
+	}
+
+	return n * interval
+}
@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSoloPolicy_Duration(t *testing.T) {
+	// 120 BPM, 16 BPI - 8 seconds interval, 2 seconds bar
+	tempo := SoloContext{TrackDuration: time.Minute * 10, BPM: 120, BPI: 16, Users: 3}
+
+	cases := []struct {
+		policy   SoloPolicy
+		context  SoloContext
+		duration time.Duration
+	}{
+		{SoloPolicy{Kind: SoloPolicySeconds, Value: 60}, SoloContext{}, time.Minute},
+		{SoloPolicy{Kind: SoloPolicySeconds, Value: 60}, tempo, time.Second * 64},
+		{SoloPolicy{Kind: SoloPolicySeconds, Value: 1}, tempo, time.Second * 8},
+		{SoloPolicy{Kind: SoloPolicyBars, Value: 32}, tempo, time.Second * 64},
+		{SoloPolicy{Kind: SoloPolicyBars, Value: 32}, SoloContext{}, DefaultSoloSlot},
+		{SoloPolicy{Kind: SoloPolicyIntervals, Value: 4}, tempo, time.Second * 32},
+		{SoloPolicy{Kind: SoloPolicySplit}, tempo, time.Second * 200},
+		{SoloPolicy{Kind: SoloPolicySplit}, SoloContext{TrackDuration: time.Minute}, time.Minute},
+		{SoloPolicy{Kind: SoloPolicySplit}, SoloContext{BPM: 120, BPI: 16, Users: 2}, time.Second * 104},
+		{SoloPolicy{Kind: SoloPolicySlots}, SoloContext{TrackDuration: time.Minute*10 + time.Second*15}, time.Minute*2 + time.Second*3},
+		{SoloPolicy{Kind: SoloPolicySlots, Value: 60}, SoloContext{TrackDuration: time.Minute*5 + time.Second*30}, time.Second * 66},
+		{SoloPolicy{}, SoloContext{TrackDuration: time.Second * 30}, time.Second * 30},
+		{SoloPolicy{}, SoloContext{TrackDuration: time.Second * 30, BPM: 120, BPI: 16}, time.Second * 32},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.duration, c.policy.Duration(c.context), "%v %v", c.policy, c.context)
+	}
+}
+
+func TestSoloPolicy_Valid(t *testing.T) {
+	assert.NoError(t, SoloPolicy{}.Valid())
+	assert.NoError(t, SoloPolicy{Kind: SoloPolicySplit}.Valid())
+	assert.NoError(t, SoloPolicy{Kind: SoloPolicyBars, Value: 16}.Valid())
+	assert.Error(t, SoloPolicy{Kind: SoloPolicyBars}.Valid())
+	assert.Error(t, SoloPolicy{Kind: "forever", Value: 1}.Valid())
+}
@@ -0,0 +1,278 @@
+// Package locales reads and writes translations of bot messages. Every language has its own catalogue file
+// named by the language, e.g. ru.json, in the gotext JSON layout:
+//
+//	{
+//	  "language": "ru",
+//	  "tts": "ru",
+//	  "messages": [
+//	    {"id": "queue started", "message": "queue started", "translation": "очередь запущена"},
+//	    {"id": "trading %d bars: %s", "message": "trading %d bars: %s", "translation": {
+//	      "select": {"feature": "plural", "arg": 1, "cases": {
+//	        "one": {"msg": "обмен соло по %d такту: %s"},
+//	        "few": {"msg": "обмен соло по %d такта: %s"},
+//	        "many": {"msg": "обмен соло по %d тактов: %s"},
+//	        "other": {"msg": "обмен соло по %d такта: %s"}
+//	      }}
+//	    }}
+//	  ]
+//	}
+//
+// Messages are English texts of the bot, the translation is a text with the same fmt verbs
+// or a plural select by the arg-th argument of the message starting from 1.
+// tts is the language of the text-to-speech voice, the catalogue language if empty.
+package locales
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefixes of constant names which are messages to translate
+var messagePrefixes = []string{"message", "help", "error", "topic"}
+
+// Plural forms in the order they are matched, the first matching case wins so other goes last
+var pluralForms = []string{"zero", "one", "two", "few", "many", "other"}
+
+type Catalog struct {
+	Language string     `json:"language"`
+	TTS      string     `json:"tts,omitempty"`
+	Messages []*Message `json:"messages"`
+}
+
+type Message struct {
+	ID          string      `json:"id"`
+	Message     string      `json:"message"`
+	Translation Translation `json:"translation"`
+}
+
+// Translation is a translated text or a plural select
+type Translation struct {
+	Text   string
+	Select *Select
+}
+
+type Select struct {
+	Feature string          `json:"feature"` // only plural is supported
+	Arg     int             `json:"arg"`     // argument to select by, starting from 1
+	Cases   map[string]Case `json:"cases"`   // zero, one, two, few, many, other or =N
+}
+
+type Case struct {
+	Msg string `json:"msg"`
+}
+
+func (t Translation) MarshalJSON() ([]byte, error) {
+	if t.Select != nil {
+		return json.Marshal(struct {
+			Select *Select `json:"select"`
+		}{t.Select})
+	}
+	return json.Marshal(t.Text)
+}
+
+func (t *Translation) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &t.Text)
+	}
+
+	var sel struct {
+		Select *Select `json:"select"`
+	}
+	if err := json.Unmarshal(data, &sel); err != nil {
+		return err
+	}
+	if sel.Select == nil {
+		return fmt.Errorf("translation must be a string or a select")
+	}
+	if sel.Select.Feature != "plural" {
+		return fmt.Errorf("unsupported select feature %q", sel.Select.Feature)
+	}
+	if sel.Select.Arg < 1 {
+		return fmt.Errorf("bad select arg %d", sel.Select.Arg)
+	}
+	if _, ok := sel.Select.Cases["other"]; !ok {
+		return fmt.Errorf("select has no other case")
+	}
+	t.Select = sel.Select
+
+	return nil
+}
+
+// Empty is true if the message is not translated yet
+func (t Translation) Empty() bool {
+	return t.Text == "" && t.Select == nil
+}
+
+// PluralCases returns selectors and messages of the plural select in the order they must be matched:
+// exact values like =0 first, then plural forms
+func (s *Select) PluralCases() (res []interface{}) {
+	var exact []string
+	for selector := range s.Cases {
+		if strings.HasPrefix(selector, "=") || strings.HasPrefix(selector, "<") {
+			exact = append(exact, selector)
+		}
+	}
+	sort.Strings(exact)
+
+	for _, selector := range append(exact, pluralForms...) {
+		if c, ok := s.Cases[selector]; ok {
+			res = append(res, selector, c.Msg)
+		}
+	}
+
+	return
+}
+
+// ReadFile reads the catalogue file
+func ReadFile(file string) (c *Catalog, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	c = &Catalog{}
+	if err = json.Unmarshal(data, c); err != nil {
+		err = fmt.Errorf("catalog %s: %s", file, err)
+	}
+
+	return
+}
+
+// WriteFile writes the catalogue file with messages in the order of the catalogue
+func (c *Catalog) WriteFile(file string) error {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// Files returns catalogue files of the directory
+func Files(dir string) ([]string, error) {
+	return filepath.Glob(filepath.Join(dir, "*.json"))
+}
+
+// FileName returns the catalogue file of the language
+func FileName(dir, lang string) string {
+	return filepath.Join(dir, lang+".json")
+}
+
+// Missing returns IDs which are not in the catalogue or not translated
+func (c *Catalog) Missing(ids []string) (res []string) {
+	translated := make(map[string]bool)
+	for _, msg := range c.Messages {
+		translated[msg.ID] = !msg.Translation.Empty()
+	}
+	for _, id := range ids {
+		if !translated[id] {
+			res = append(res, id)
+		}
+	}
+
+	return
+}
+
+// Update makes messages of the catalogue match ids: new messages are added untranslated
+// and obsolete ones are removed, English messages are translated as they are
+func (c *Catalog) Update(ids []string) (added, removed int) {
+	existing := make(map[string]*Message)
+	for _, msg := range c.Messages {
+		existing[msg.ID] = msg
+	}
+
+	messages := make([]*Message, 0, len(ids))
+	for _, id := range ids {
+		msg, ok := existing[id]
+		if !ok {
+			msg = &Message{ID: id}
+			added++
+		}
+		msg.Message = id
+		if msg.Translation.Empty() && c.Language == "en" {
+			msg.Translation.Text = id
+		}
+		messages = append(messages, msg)
+		delete(existing, id)
+	}
+	removed = len(existing)
+	c.Messages = messages
+
+	return
+}
+
+// Extract returns texts of message constants declared in Go files of the package dir,
+// constants named message..., help..., error... and topic... are messages
+func Extract(dir string) (ids []string, err error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return
+	}
+
+	var files []string
+	byName := make(map[string]*ast.File)
+	for _, pkg := range pkgs {
+		for name, file := range pkg.Files {
+			files = append(files, name)
+			byName[name] = file
+		}
+	}
+	sort.Strings(files)
+
+	seen := make(map[string]bool)
+	for _, name := range files {
+		for _, decl := range byName[name].Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				value := spec.(*ast.ValueSpec)
+				for i, ident := range value.Names {
+					if !isMessageName(ident.Name) || i >= len(value.Values) {
+						continue
+					}
+					lit, ok := value.Values[i].(*ast.BasicLit)
+					if !ok || lit.Kind != token.STRING {
+						continue
+					}
+					id, err := strconv.Unquote(lit.Value)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %s", fset.Position(lit.Pos()), err)
+					}
+					if !seen[id] {
+						seen[id] = true
+						ids = append(ids, id)
+					}
+				}
+			}
+		}
+	}
+
+	return
+}
+
+func isMessageName(name string) bool {
+	for _, prefix := range messagePrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
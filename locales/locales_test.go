@@ -0,0 +1,70 @@
+package locales
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestCatalogs fails if some bot message is not translated, run locales_util to add new messages to catalogues
+func TestCatalogs(t *testing.T) {
+	ids, err := Extract("../dj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, ids, "queue started")
+	assert.Contains(t, ids, "an error has occurred")
+
+	files, err := Files(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		c, err := ReadFile(file)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, FileName(".", c.Language), file)
+		assert.Empty(t, c.Missing(ids), "untranslated messages in %s", file)
+	}
+}
+
+func TestTranslation_UnmarshalJSON(t *testing.T) {
+	msg := &Message{}
+	err := json.Unmarshal([]byte(`{"id": "%d tracks", "translation": {"select": {"feature": "plural", "arg": 1,
+		"cases": {"other": {"msg": "%d треков"}, "one": {"msg": "%d трек"}, "=0": {"msg": "нет треков"}}}}}`), msg)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"=0", "нет треков", "one", "%d трек", "other", "%d треков"}, msg.Translation.Select.PluralCases())
+
+	data, err := json.Marshal(msg.Translation)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"select":{"feature":"plural","arg":1`)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"id": "queue started", "translation": "очередь запущена"}`), msg))
+	assert.Equal(t, "очередь запущена", msg.Translation.Text)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"translation": {"select": {"feature": "gender", "arg": 1}}}`), &Message{}))
+	assert.Error(t, json.Unmarshal([]byte(`{"translation": {"select": {"feature": "plural", "arg": 1,
+		"cases": {"one": {"msg": "%d трек"}}}}}`), &Message{}))
+}
+
+func TestCatalog_Update(t *testing.T) {
+	c := &Catalog{Language: "ru", Messages: []*Message{
+		{ID: "queue started", Message: "queue started", Translation: Translation{Text: "очередь запущена"}},
+		{ID: "obsolete", Message: "obsolete", Translation: Translation{Text: "устарело"}},
+	}}
+
+	added, removed := c.Update([]string{"queue finished", "queue started"})
+	assert.Equal(t, 1, added)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, "queue finished", c.Messages[0].ID)
+	assert.True(t, c.Messages[0].Translation.Empty())
+	assert.Equal(t, "очередь запущена", c.Messages[1].Translation.Text)
+	assert.Equal(t, []string{"queue finished"}, c.Missing([]string{"queue finished", "queue started"}))
+
+	en := &Catalog{Language: "en"}
+	en.Update([]string{"queue started"})
+	assert.Equal(t, "queue started", en.Messages[0].Translation.Text)
+}
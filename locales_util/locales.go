@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"github.com/ayvan/ninjam-dj-bot/locales"
+	"github.com/sirupsen/logrus"
+	"os"
+)
+
+// locales_util extracts bot messages from Go sources and updates translation catalogues:
+// new messages are added untranslated, obsolete ones removed. It fails if some message is not translated.
+//
+//	locales_util -src ./dj -dir ./locales
+//	locales_util -src ./dj -dir ./locales -lang de   # adds the de.json catalogue
+func main() {
+	src := flag.String("src", "dj", "Go package directory with message constants")
+	dir := flag.String("dir", "locales", "catalogues directory")
+	lang := flag.String("lang", "", "language of a new catalogue to add")
+	flag.Parse()
+
+	ids, err := locales.Extract(*src)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	logrus.Infof("%d messages found in %s", len(ids), *src)
+
+	files, err := locales.Files(*dir)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	var catalogs []*locales.Catalog
+	for _, file := range files {
+		c, err := locales.ReadFile(file)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		catalogs = append(catalogs, c)
+	}
+	if *lang != "" {
+		files = append(files, locales.FileName(*dir, *lang))
+		catalogs = append(catalogs, &locales.Catalog{Language: *lang})
+	}
+
+	untranslated := 0
+	for i, c := range catalogs {
+		added, removed := c.Update(ids)
+		if err = c.WriteFile(files[i]); err != nil {
+			logrus.Fatal(err)
+		}
+		missing := c.Missing(ids)
+		logrus.Infof("%s: %d added, %d removed, %d untranslated", files[i], added, removed, len(missing))
+		for _, id := range missing {
+			logrus.Warnf("%s: %q is not translated", c.Language, id)
+		}
+		untranslated += len(missing)
+	}
+
+	if untranslated > 0 {
+		os.Exit(1)
+	}
+}
@@ -86,15 +86,36 @@ func main() {
 	jp := dj.NewJamPlayer(dir, bot, hostConfig, speechConfig)
 
 	tracks_sync.Init(dir, jamDB)
+	tracks_sync.SetLoopOptions(config.Get().Loops.AutoApply, config.Get().Loops.MinScore)
+	if err = tracks_sync.SetFrameVersion(config.Get().ID3.FrameVersion); err != nil {
+		logrus.Fatal(err)
+	}
+
+	if config.Get().Watch.Enabled {
+		watcher := tracks_sync.NewWatcher(time.Duration(config.Get().Watch.Rescan)*time.Second, config.Get().Sync.Workers)
+		watcher.Start()
+		defer watcher.Stop()
+	}
 
 	bot.SetOnSuccessAuth(func() {
 		bot.ChannelInit("BackingTrack")
 		bot.ChannelInit("Voice", 2)
 	})
 
-	bot.SetOnServerConfigChange(jp.OnServerConfigChange)
+	if err = dj.LoadCatalogs(config.Get().LocalesPath()); err != nil {
+		logrus.Fatal(err)
+	}
 
 	jamManager := dj.NewJamManager(jamDB, jp, bot)
+	jamManager.SetRoleDB(authDB)
+	jamManager.SetLanguageDB(authDB)
+
+	bot.SetOnServerConfigChange(jamManager.OnServerConfigChange)
+	if config.Get().Idle.SilentIntervals > 0 {
+		// молчание участников очереди видно по их интервалам, сервер присылает интервалы только подписчикам
+		bot.SetOnIntervalBegin(jamManager.OnIntervalBegin)
+		jamManager.SetQueueSubscriber(bot.Subscribe)
+	}
 
 	go api.Run("0.0.0.0:"+config.Get().HTTPPort, jamManager)
 
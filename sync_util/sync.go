@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/ayvan/ninjam-dj-bot/tracks"
 	"github.com/ayvan/ninjam-dj-bot/tracks_sync"
 	"github.com/sirupsen/logrus"
@@ -9,13 +11,33 @@ import (
 	"path/filepath"
 )
 
+const modeExportTags = "export-tags"
+
 func main() {
-	if len(os.Args) == 1 {
+	workers := flag.Int("workers", 0, "number of files analysed at once, a file per CPU by default")
+	frameVersion := flag.Uint("frame-version", tracks_sync.DefaultFrameVersion, "version of GuitarJam frames written to files: 2 or 3")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [%s] tracks_dir\n", os.Args[0], modeExportTags)
+		fmt.Fprintf(flag.CommandLine.Output(), "syncs DB with MP3 files of tracks_dir, %s writes DB metadata to the files instead\n", modeExportTags)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	mode := ""
+	if len(args) > 0 && args[0] == modeExportTags {
+		mode, args = args[0], args[1:]
+	}
+	if len(args) == 0 {
 		logrus.Fatalf("you must specify tracks directory")
 	}
 
+	if err := tracks_sync.SetFrameVersion(uint16(*frameVersion)); err != nil {
+		logrus.Fatal(err)
+	}
+
 	var err error
-	dir, err := filepath.Abs(os.Args[1])
+	dir, err := filepath.Abs(args[0])
 	if err != nil {
 		logrus.Fatal(err)
 	}
@@ -30,7 +52,29 @@ func main() {
 
 	tracks_sync.Init(dir, db)
 
-	if err = filepath.Walk(dir, tracks_sync.Walk); err != nil {
-		logrus.Fatal(err)
+	failed := 0
+	if mode == modeExportTags {
+		exported, errs, err := tracks_sync.ExportTags()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		for _, fileErr := range errs {
+			logrus.Errorf("export tags to %s failed: %s", fileErr.Path, fileErr.Error)
+		}
+		logrus.Infof("tags exported to %d files, %d failed", exported, len(errs))
+		failed = len(errs)
+	} else {
+		status, err := tracks_sync.Sync(*workers, func(status tracks_sync.SyncStatus) {
+			logrus.Infof("processed %d of %d files", status.Processed, status.Total)
+		})
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		failed = status.Failed
+	}
+
+	if failed > 0 {
+		db.DBClose()
+		os.Exit(1)
 	}
 }
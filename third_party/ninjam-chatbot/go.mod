@@ -0,0 +1,11 @@
+module github.com/ayvan/ninjam-chatbot
+
+go 1.14
+
+require (
+	github.com/luci/go-render v0.0.0-20160219211803-9a04cc21af0f
+	github.com/sirupsen/logrus v1.7.0
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
+	gopkg.in/yaml.v2 v2.3.0 // indirect
+)
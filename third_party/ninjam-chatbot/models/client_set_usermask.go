@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/binary"
+)
+
+// ClientSetUsermask subscribes the client to channels of the users,
+// the server sends intervals of the channels set in ChannelsMask only
+// 0x81
+type ClientSetUsermask struct {
+	Usermasks []Usermask
+}
+
+type Usermask struct {
+	Username     string
+	ChannelsMask uint32
+}
+
+func (c *ClientSetUsermask) Marshal() (data []byte, err error) {
+	mask := make([]byte, 4)
+	for _, um := range c.Usermasks {
+		binary.LittleEndian.PutUint32(mask, um.ChannelsMask)
+
+		data = append(data, um.Username...)
+		data = append(data, 0)
+		data = append(data, mask...)
+	}
+
+	return
+}
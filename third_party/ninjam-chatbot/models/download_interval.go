@@ -0,0 +1,37 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// ServerDownloadIntervalBegin is sent for intervals of channels the client subscribed to,
+// an empty GUID means the channel transmits nothing
+// 0x04
+type ServerDownloadIntervalBegin struct {
+	GUID          [16]byte
+	EstimatedSize uint32
+	FourCC        [4]byte
+	ChannelIndex  uint8
+	Username      []byte // NUL-terminated
+}
+
+func (s *ServerDownloadIntervalBegin) Unmarshal(data []byte) (err error) {
+	if len(data) < 25 {
+		return fmt.Errorf("Input data error: interval begin of %d bytes", len(data))
+	}
+
+	copy(s.GUID[:], data[:16])
+	s.EstimatedSize = binary.LittleEndian.Uint32(data[16:20])
+	copy(s.FourCC[:], data[20:24])
+	s.ChannelIndex = data[24]
+
+	name := data[25:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	s.Username = name
+
+	return
+}
@@ -0,0 +1,9 @@
+package models
+
+type Mountser interface {
+	Mounts() map[string][]string
+}
+
+type Userser interface {
+	Users() []string
+}
@@ -0,0 +1,7 @@
+package models
+
+type Message struct {
+	Type string
+	Name string
+	Text string
+}
@@ -0,0 +1,84 @@
+package ninjam_bot
+
+import (
+	"encoding/binary"
+	"github.com/ayvan/ninjam-chatbot/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func inMessage(t uint8, payload []byte) *models.NetMessage {
+	header := [5]byte{t}
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(payload)))
+	nm := models.NewInNetMessage(header)
+	nm.Unmarshal(payload)
+
+	return nm
+}
+
+func outMessage(t uint8, payload string) []byte {
+	header := []byte{t, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(payload)))
+
+	return append(header, payload...)
+}
+
+func TestNinJamBot_Subscribe(t *testing.T) {
+	n := NewNinJamBot("localhost", "2049", "dj", "", true)
+
+	n.Subscribe([]string{"Bob@127.0.0.1"})
+	if assert.Len(t, n.toServerChan, 1) {
+		assert.Equal(t, outMessage(models.ClientSetUsermaskType, "Bob@127.0.0.1\x00\xff\xff\xff\xff"), <-n.toServerChan)
+	}
+
+	// подписки не меняются - серверу писать нечего
+	n.Subscribe([]string{"Bob@127.0.0.1"})
+	assert.Len(t, n.toServerChan, 0)
+
+	// новые подписываются, выбывшие отписываются
+	n.Subscribe([]string{"Ann@127.0.0.2"})
+	if assert.Len(t, n.toServerChan, 1) {
+		assert.Equal(t, outMessage(models.ClientSetUsermaskType, "Ann@127.0.0.2\x00\xff\xff\xff\xffBob@127.0.0.1\x00\x00\x00\x00\x00"), <-n.toServerChan)
+	}
+
+	// после переподключения подписки повторяются
+	n.handle(inMessage(models.ServerAuthReplyType, []byte{1, 0, 0}))
+	if assert.Len(t, n.toServerChan, 1) {
+		assert.Equal(t, outMessage(models.ClientSetUsermaskType, "Ann@127.0.0.2\x00\xff\xff\xff\xff"), <-n.toServerChan)
+	}
+}
+
+func TestNinJamBot_handle_intervalBegin(t *testing.T) {
+	n := NewNinJamBot("localhost", "2049", "dj", "", true)
+
+	type interval struct {
+		userName     string
+		channelIndex uint8
+		guid         [16]byte
+	}
+	var intervals []interval
+	n.SetOnIntervalBegin(func(userName string, channelIndex uint8, guid [16]byte) {
+		intervals = append(intervals, interval{userName, channelIndex, guid})
+	})
+
+	guid := [16]byte{1, 2, 3}
+	payload := append(guid[:], 0, 16, 0, 0)
+	payload = append(payload, "OGGv"...)
+	payload = append(payload, 1)
+	payload = append(payload, "Bob@127.0.0.1\x00"...)
+	n.handle(inMessage(models.ServerDownloadIntervalBeginType, payload))
+
+	assert.Equal(t, []interval{{"Bob@127.0.0.1", 1, guid}}, intervals)
+
+	// обрезанное сообщение не разбирается и до handle не доходит
+	assert.Error(t, models.NewNetMessage(models.ServerDownloadIntervalBeginType).Unmarshal(payload[:20]))
+}
+
+func TestNinJamBot_sendPrivateMessage(t *testing.T) {
+	n := NewNinJamBot("localhost", "2049", "dj", "", true)
+
+	n.sendPrivateMessage("Bob@127.0.0.1", "hi")
+	if assert.Len(t, n.toServerChan, 1) {
+		assert.Equal(t, outMessage(models.ChatMessageType, "PRIVMSG\x00Bob@127.0.0.1\x00hi\x00\x00\x00"), <-n.toServerChan)
+	}
+}
@@ -1,12 +1,26 @@
 package tracks
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mattn/go-sqlite3"
+	"strings"
 	"time"
 )
 
+// sqliteDriver is the SQLite driver with unicode_lower function, LOWER of SQLite changes the case of ASCII letters only
+const sqliteDriver = "sqlite3_jam"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("unicode_lower", strings.ToLower, true)
+		},
+	})
+}
+
 type Model struct {
 	ID        uint       `gorm:"primary_key" json:"id"`
 	CreatedAt time.Time  `json:"-"`
@@ -18,9 +32,17 @@ type JamTracksDB interface {
 	Tracks() ([]*Track, error)
 	CountTracks() (uint64, error)
 	Track(id uint) (*Track, error)
+	Tags() ([]*Tag, error)
+	FindTracks(filter TrackFilter) ([]*Track, int, error)
 	Playlists() ([]*Playlist, error)
 	CountPlaylists() (uint64, error)
 	Playlist(id uint) (*Playlist, error)
+	QueueSessionStart(startedAt time.Time) (*QueueSession, error)
+	QueueSessionStop(id uint, stoppedAt time.Time) error
+	LastQueueSession() (*QueueSession, error)
+	QueueTurnAdd(turn *QueueTurn) error
+	QueueTurns(sessionID uint) ([]*QueueTurn, error)
+	QueueStats(sessionID uint) ([]*QueueUserStats, error)
 }
 
 var _ JamTracksDB = &JamDB{} // check interface implementation
@@ -33,13 +55,16 @@ var ErrorNotFound = fmt.Errorf("not found")
 
 func NewJamDB(file string) (jamDB *JamDB, err error) {
 	var db *gorm.DB
-	db, err = gorm.Open("sqlite3", file)
+	db, err = gorm.Open("sqlite3", sqliteDriver, file)
 	if err != nil {
 		err = fmt.Errorf("failed to connect database: %s", err)
 		return
 	}
 
-	if err = db.AutoMigrate(&Track{}, &Tag{}, &Playlist{}, &Author{}).Error; err != nil {
+	// SQLite не допускает параллельной записи, синхронизация библиотеки пишет из нескольких горутин
+	db.DB().SetMaxOpenConns(1)
+
+	if err = db.AutoMigrate(&Track{}, &Tag{}, &Playlist{}, &Author{}, &QueueSession{}, &QueueTurn{}, &Waveform{}, &LoopSuggestion{}, &Detection{}).Error; err != nil {
 		err = fmt.Errorf("failed to migrate database: %s", err)
 		return
 	}
@@ -106,7 +131,8 @@ func (jdb *JamDB) TrackUpdate(id uint, req *Track) (res *Track, err error) {
 	}
 
 	req.Model = track.Model
-	db := jdb.db.Omit("tags", "author", "integrated", "range", "peak", "shortterm", "momentary", "length").Save(&req)
+	db := jdb.db.Omit("tags", "author", "integrated", "range", "peak", "shortterm", "momentary", "length",
+		"file_size", "file_mod_time", "file_hash", "unavailable").Save(&req)
 	if db.Error != nil {
 		err = db.Error
 		return
@@ -239,6 +265,36 @@ func (jdb *JamDB) TrackByPath(path string) (res *Track, err error) {
 	return
 }
 
+// TrackFileUpdate stores size, modification time and hash of the track file changed by the bot itself
+func (jdb *JamDB) TrackFileUpdate(path string, size, modTime int64, hash string) error {
+	return jdb.db.Unscoped().Model(&Track{}).Where("file_path = ?", path).
+		UpdateColumns(map[string]interface{}{"file_size": size, "file_mod_time": modTime, "file_hash": hash}).Error
+}
+
+// TracksByHash returns tracks with the file content hash
+func (jdb *JamDB) TracksByHash(hash string) (res []*Track, err error) {
+	res = []*Track{}
+	err = jdb.db.Where("file_hash = ?", hash).Order("id").Find(&res).Error
+	return
+}
+
+// TrackRename moves the track to the file keeping its ID, tags, play count and playlists, the track becomes available
+func (jdb *JamDB) TrackRename(id uint, path string, size, modTime int64) error {
+	return jdb.db.Model(&Track{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"file_path": path, "file_size": size, "file_mod_time": modTime, "unavailable": false}).Error
+}
+
+// TrackAvailable marks the track of the file available or unavailable
+func (jdb *JamDB) TrackAvailable(path string, available bool) error {
+	return jdb.db.Model(&Track{}).Where("file_path = ?", path).UpdateColumn("unavailable", !available).Error
+}
+
+// AvailableTrackPaths returns file paths of available tracks
+func (jdb *JamDB) AvailableTrackPaths() (paths []string, err error) {
+	err = jdb.db.Model(&Track{}).Where("NOT unavailable").Order("id").Pluck("file_path", &paths).Error
+	return
+}
+
 func (jdb *JamDB) Playlists() (playlists []*Playlist, err error) {
 	playlists = []*Playlist{}
 	err = jdb.db.Find(&playlists).Error
@@ -1,9 +1,40 @@
 package tracks
 
 import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func Test_load(t *testing.T) {
 
 }
+
+func TestJamDB_TrackUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	track := &Track{Title: "Lost Blues", FilePath: "lost.mp3", Unavailable: true}
+	if !assert.NoError(t, jdb.DB().Save(track).Error) {
+		return
+	}
+
+	// доступность файла меняют только синхронизация и watcher, API её не сбрасывает
+	res, err := jdb.TrackUpdate(track.ID, &Track{Title: "Found Blues", FilePath: "lost.mp3"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Found Blues", res.Title)
+	assert.True(t, res.Unavailable)
+}
@@ -0,0 +1,243 @@
+package tracks
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+// ReferencedError is returned if the item can't be deleted because other items refer to it
+type ReferencedError struct {
+	Kind string // kind of the referring items: playlists or tracks
+	IDs  []uint
+}
+
+func (e *ReferencedError) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i, id := range e.IDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	return fmt.Sprintf("used by %s %s", e.Kind, strings.Join(ids, ", "))
+}
+
+// Deleted lists soft deleted items which can be restored
+type Deleted struct {
+	Tracks    []*Track    `json:"tracks"`
+	Playlists []*Playlist `json:"playlists"`
+	Tags      []*Tag      `json:"tags"`
+	Authors   []*Author   `json:"authors"`
+}
+
+// Deleted returns soft deleted tracks, playlists, tags and authors
+func (jdb *JamDB) Deleted() (res *Deleted, err error) {
+	res = &Deleted{Tracks: []*Track{}, Playlists: []*Playlist{}, Tags: []*Tag{}, Authors: []*Author{}}
+	for _, list := range []interface{}{&res.Tracks, &res.Playlists, &res.Tags, &res.Authors} {
+		if err = jdb.db.Unscoped().Where("deleted_at IS NOT NULL").Find(list).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// TrackDelete deletes the track, if playlists contain it the track is removed from them when cascade is set,
+// otherwise ReferencedError is returned. Purge deletes the track permanently, it can't be restored then.
+// removeFile of the purged track is called before the DB is changed, its error leaves the track as is.
+func (jdb *JamDB) TrackDelete(id uint, cascade, purge bool, removeFile func(track *Track) error) (res *Track, err error) {
+	res, err = jdb.Track(id)
+	if err != nil {
+		return
+	}
+
+	playlists := []*Playlist{}
+	if err = jdb.db.Unscoped().Find(&playlists).Error; err != nil {
+		return
+	}
+
+	var used []*Playlist
+	var usedIDs []uint
+	for _, playlist := range playlists {
+		for _, listTrack := range playlist.Tracks {
+			if listTrack.TrackID == id {
+				used = append(used, playlist)
+				// удалённые плейлисты удалению не мешают, но трек из них тоже убираем
+				if playlist.DeletedAt == nil {
+					usedIDs = append(usedIDs, playlist.ID)
+				}
+				break
+			}
+		}
+	}
+	if len(usedIDs) > 0 && !cascade {
+		return nil, &ReferencedError{Kind: "playlists", IDs: usedIDs}
+	}
+
+	// файл удаляем раньше записи: запись без файла синхронизация пометит недоступной,
+	// а файл без записи вернётся в библиотеку как новый трек
+	if purge && removeFile != nil {
+		if err = removeFile(res); err != nil {
+			return nil, err
+		}
+	}
+
+	err = jdb.db.Transaction(func(tx *gorm.DB) error {
+		for _, playlist := range used {
+			listTracks := make([]PlaylistTrack, 0, len(playlist.Tracks))
+			for _, listTrack := range playlist.Tracks {
+				if listTrack.TrackID != id {
+					listTracks = append(listTracks, listTrack)
+				}
+			}
+			playlist.Tracks = listTracks
+			if err := tx.Unscoped().Save(playlist).Error; err != nil {
+				return err
+			}
+		}
+
+		if !purge {
+			return tx.Delete(res).Error
+		}
+		if err := tx.Model(res).Association("Tags").Clear().Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("track_id = ?", id).Delete(&Waveform{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("track_id = ?", id).Delete(&LoopSuggestion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("track_id = ?", id).Delete(&Detection{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(res).Error
+	})
+	if err != nil {
+		res = nil
+	}
+
+	return
+}
+
+// PlaylistDelete deletes the playlist
+func (jdb *JamDB) PlaylistDelete(id uint) (err error) {
+	playlist, err := jdb.Playlist(id)
+	if err != nil {
+		return
+	}
+
+	return jdb.db.Delete(playlist).Error
+}
+
+// TagDelete deletes the tag, if tracks have it the tag is removed from them when cascade is set,
+// otherwise ReferencedError is returned
+func (jdb *JamDB) TagDelete(id uint, cascade bool) (err error) {
+	tag, err := jdb.Tag(id)
+	if err != nil {
+		return
+	}
+
+	var ids []uint
+	err = jdb.db.Table("track_tags").
+		Joins("JOIN tracks ON tracks.id = track_tags.track_id AND tracks.deleted_at IS NULL").
+		Where("track_tags.tag_id = ?", id).Order("track_tags.track_id").Pluck("track_tags.track_id", &ids).Error
+	if err != nil {
+		return
+	}
+	if len(ids) > 0 && !cascade {
+		return &ReferencedError{Kind: "tracks", IDs: ids}
+	}
+
+	return jdb.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM track_tags WHERE tag_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tag).Error
+	})
+}
+
+// AuthorDelete deletes the author, if tracks have it the author is removed from them when cascade is set,
+// otherwise ReferencedError is returned
+func (jdb *JamDB) AuthorDelete(id uint, cascade bool) (err error) {
+	author, err := jdb.Author(id)
+	if err != nil {
+		return
+	}
+
+	var ids []uint
+	if err = jdb.db.Model(&Track{}).Where("author_id = ?", id).Order("id").Pluck("id", &ids).Error; err != nil {
+		return
+	}
+	if len(ids) > 0 && !cascade {
+		return &ReferencedError{Kind: "tracks", IDs: ids}
+	}
+
+	return jdb.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&Track{}).Where("author_id = ?", id).UpdateColumn("author_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(author).Error
+	})
+}
+
+// TrackRestore restores the soft deleted track, playlists it was removed from on delete stay without it
+func (jdb *JamDB) TrackRestore(id uint) (*Track, error) {
+	if err := jdb.restore(&Track{}, id); err != nil {
+		return nil, err
+	}
+	return jdb.Track(id)
+}
+
+// PlaylistRestore restores the soft deleted playlist
+func (jdb *JamDB) PlaylistRestore(id uint) (*Playlist, error) {
+	if err := jdb.restore(&Playlist{}, id); err != nil {
+		return nil, err
+	}
+	return jdb.Playlist(id)
+}
+
+// TagRestore restores the soft deleted tag, tracks it was removed from on delete stay without it
+func (jdb *JamDB) TagRestore(id uint) (*Tag, error) {
+	if err := jdb.restore(&Tag{}, id); err != nil {
+		return nil, err
+	}
+	return jdb.Tag(id)
+}
+
+// AuthorRestore restores the soft deleted author, tracks it was removed from on delete stay without it
+func (jdb *JamDB) AuthorRestore(id uint) (*Author, error) {
+	if err := jdb.restore(&Author{}, id); err != nil {
+		return nil, err
+	}
+	return jdb.Author(id)
+}
+
+// restore clears deleted_at of the item, ErrorNotFound is returned if there is no such deleted item
+func (jdb *JamDB) restore(model interface{}, id uint) error {
+	db := jdb.db.Unscoped().Model(model).Where("id = ? AND deleted_at IS NOT NULL", id).UpdateColumn("deleted_at", nil)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// DeletedTrackByPath returns the soft deleted track of the file
+func (jdb *JamDB) DeletedTrackByPath(path string) (res *Track, err error) {
+	track := &Track{}
+	dbRes := jdb.db.Unscoped().Where("deleted_at IS NOT NULL").First(track, "file_path = ?", path)
+	if dbRes.RecordNotFound() {
+		err = ErrorNotFound
+		return
+	}
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+
+	res = track
+
+	return
+}
@@ -0,0 +1,136 @@
+package tracks
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJamDB_TrackDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	blues := &Track{Title: "Slow Blues", FilePath: "blues.mp3", Tags: []Tag{{Name: "blues"}}}
+	funk := &Track{Title: "Funk Groove", FilePath: "funk.mp3"}
+	for _, track := range []*Track{blues, funk} {
+		assert.NoError(t, jdb.DB().Save(track).Error)
+	}
+	playlist := &Playlist{Name: "Jam", Tracks: []PlaylistTrack{{TrackID: blues.ID}, {TrackID: funk.ID}}}
+	assert.NoError(t, jdb.DB().Save(playlist).Error)
+
+	_, err = jdb.TrackDelete(blues.ID, false, false, nil)
+	assert.Equal(t, &ReferencedError{Kind: "playlists", IDs: []uint{playlist.ID}}, err)
+	assert.EqualError(t, err, "used by playlists 1")
+
+	deleted, err := jdb.TrackDelete(blues.ID, true, false, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "blues.mp3", deleted.FilePath)
+	}
+	_, err = jdb.Track(blues.ID)
+	assert.Equal(t, ErrorNotFound, err)
+	list, _ := jdb.Playlist(playlist.ID)
+	assert.Equal(t, []PlaylistTrack{{TrackID: funk.ID}}, list.Tracks)
+
+	trash, err := jdb.Deleted()
+	if assert.NoError(t, err) && assert.Len(t, trash.Tracks, 1) {
+		assert.Equal(t, blues.ID, trash.Tracks[0].ID)
+	}
+	_, err = jdb.DeletedTrackByPath("blues.mp3")
+	assert.NoError(t, err)
+
+	restored, err := jdb.TrackRestore(blues.ID)
+	if assert.NoError(t, err) {
+		assert.Len(t, restored.Tags, 1)
+	}
+	_, err = jdb.TrackRestore(blues.ID)
+	assert.Equal(t, ErrorNotFound, err)
+
+	// удалённый насовсем трек восстановить нельзя
+	_, err = jdb.TrackDelete(blues.ID, false, true, nil)
+	assert.NoError(t, err)
+	_, err = jdb.TrackRestore(blues.ID)
+	assert.Equal(t, ErrorNotFound, err)
+	_, err = jdb.DeletedTrackByPath("blues.mp3")
+	assert.Equal(t, ErrorNotFound, err)
+
+	_, err = jdb.TrackDelete(100, true, false, nil)
+	assert.Equal(t, ErrorNotFound, err)
+
+	// файл не удалился - трек остаётся
+	failed := errors.New("permission denied")
+	_, err = jdb.TrackDelete(funk.ID, true, true, func(track *Track) error { return failed })
+	assert.Equal(t, failed, err)
+	_, err = jdb.Track(funk.ID)
+	assert.NoError(t, err)
+
+	var removed string
+	_, err = jdb.TrackDelete(funk.ID, true, true, func(track *Track) error {
+		// файл удаляется, пока запись ещё есть
+		_, err := jdb.Track(track.ID)
+		assert.NoError(t, err)
+		removed = track.FilePath
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "funk.mp3", removed)
+	_, err = jdb.Track(funk.ID)
+	assert.Equal(t, ErrorNotFound, err)
+}
+
+func TestJamDB_TagDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	author := &Author{Name: "Павел"}
+	track := &Track{Title: "Shuffle", Tags: []Tag{{Name: "blues"}}, Author: author}
+	assert.NoError(t, jdb.DB().Save(track).Error)
+	tagID := track.Tags[0].ID
+
+	assert.Equal(t, &ReferencedError{Kind: "tracks", IDs: []uint{track.ID}}, jdb.TagDelete(tagID, false))
+	assert.Equal(t, &ReferencedError{Kind: "tracks", IDs: []uint{track.ID}}, jdb.AuthorDelete(author.ID, false))
+
+	assert.NoError(t, jdb.TagDelete(tagID, true))
+	assert.NoError(t, jdb.AuthorDelete(author.ID, true))
+
+	res, err := jdb.Track(track.ID)
+	if assert.NoError(t, err) {
+		assert.Empty(t, res.Tags)
+		assert.Nil(t, res.Author)
+		assert.Equal(t, uint64(0), res.AuthorID)
+	}
+
+	tag, err := jdb.TagRestore(tagID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "blues", tag.Name)
+	}
+	_, err = jdb.AuthorRestore(author.ID)
+	assert.NoError(t, err)
+
+	playlist := &Playlist{Name: "Jam"}
+	assert.NoError(t, jdb.DB().Save(playlist).Error)
+	assert.NoError(t, jdb.PlaylistDelete(playlist.ID))
+	assert.Equal(t, ErrorNotFound, jdb.PlaylistDelete(playlist.ID))
+	_, err = jdb.PlaylistRestore(playlist.ID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,72 @@
+package tracks
+
+// Detection is BPM and key of the track detected from audio by sync when the tags don't have them
+type Detection struct {
+	Model
+	TrackID       uint    `json:"track_id" gorm:"unique_index"`
+	BPM           uint    `json:"bpm"`
+	BPMConfidence float64 `json:"bpm_confidence"` // from 0 to 1
+	BPMDetected   bool    `json:"bpm_detected"`   // the track BPM is the detected one
+	Key           uint    `json:"key"`
+	Mode          uint    `json:"mode"`
+	KeyConfidence float64 `json:"key_confidence"` // from 0 to 1
+	KeyDetected   bool    `json:"key_detected"`   // the track key is the detected one
+	Reviewed      bool    `json:"reviewed"`       // a human confirmed or corrected the values
+}
+
+// Detection returns the detection of the track
+func (jdb *JamDB) Detection(trackID uint) (res *Detection, err error) {
+	detection := &Detection{}
+	dbRes := jdb.db.First(detection, "track_id = ?", trackID)
+	if dbRes.RecordNotFound() {
+		err = ErrorNotFound
+		return
+	}
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+
+	res = detection
+
+	return
+}
+
+// DetectionSave saves the detection replacing the previous one of the track
+func (jdb *JamDB) DetectionSave(detection *Detection) error {
+	if prev, err := jdb.Detection(detection.TrackID); err == nil {
+		detection.Model = prev.Model
+	} else if err != ErrorNotFound {
+		return err
+	}
+
+	return jdb.db.Save(detection).Error
+}
+
+// DetectionReview marks the detection of the track reviewed keeping BPM and key of the track,
+// so sync uses them instead of detected ones. ErrorNotFound is returned if the track has no detection.
+func (jdb *JamDB) DetectionReview(track *Track) (res *Detection, err error) {
+	res, err = jdb.Detection(track.ID)
+	if err != nil {
+		return
+	}
+
+	res.BPM, res.Key, res.Mode = track.BPM, track.Key, track.Mode
+	res.Reviewed = true
+	err = jdb.db.Save(res).Error
+
+	return
+}
+
+// DetectionsForReview returns not reviewed detections with a detected value of the track
+// having confidence less than minConfidence
+func (jdb *JamDB) DetectionsForReview(minConfidence float64) (res []*Detection, err error) {
+	res = []*Detection{}
+	err = jdb.db.Joins("JOIN tracks ON tracks.id = detections.track_id AND tracks.deleted_at IS NULL").
+		Where("NOT detections.reviewed").
+		Where("(detections.bpm_detected AND detections.bpm_confidence < ?) OR (detections.key_detected AND detections.key_confidence < ?)",
+			minConfidence, minConfidence).
+		Order("detections.track_id").Find(&res).Error
+
+	return
+}
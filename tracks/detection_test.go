@@ -0,0 +1,58 @@
+package tracks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJamDB_DetectionsForReview(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, jdb.DB().Save(&Track{Title: "track", BPM: 100, Key: KeyA}).Error)
+	}
+	// уверенно распознанный BPM, неуверенная тональность из тегов не используется
+	assert.NoError(t, jdb.DetectionSave(&Detection{TrackID: 1, BPMConfidence: 0.9, BPMDetected: true, KeyConfidence: 0.1}))
+	// неуверенно распознанная тональность
+	assert.NoError(t, jdb.DetectionSave(&Detection{TrackID: 2, BPMConfidence: 0.9, BPMDetected: true, KeyConfidence: 0.3, KeyDetected: true}))
+	assert.NoError(t, jdb.DetectionSave(&Detection{TrackID: 3, BPMConfidence: 0.2, BPMDetected: true}))
+	assert.NoError(t, jdb.DetectionSave(&Detection{TrackID: 4, BPMConfidence: 0.2, BPMDetected: true}))
+	_, err = jdb.TrackDelete(4, false, false, nil)
+	assert.NoError(t, err)
+
+	res, err := jdb.DetectionsForReview(0.5)
+	if !assert.NoError(t, err) || !assert.Len(t, res, 2) {
+		return
+	}
+	assert.Equal(t, uint(2), res[0].TrackID)
+	assert.Equal(t, uint(3), res[1].TrackID)
+
+	track, _ := jdb.Track(3)
+	track.BPM = 120
+	detection, err := jdb.DetectionReview(track)
+	if assert.NoError(t, err) {
+		assert.True(t, detection.Reviewed)
+		assert.Equal(t, uint(120), detection.BPM)
+	}
+
+	res, err = jdb.DetectionsForReview(0.5)
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.Equal(t, uint(2), res[0].TrackID)
+	}
+
+	_, err = jdb.DetectionReview(&Track{Model: Model{ID: 5}})
+	assert.Equal(t, ErrorNotFound, err)
+}
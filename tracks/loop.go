@@ -0,0 +1,42 @@
+package tracks
+
+// LoopSuggestion is the loop found by audio analysis for a track synced without loop points,
+// it is applied to the track on approval or automatically by sync if the score is high enough
+type LoopSuggestion struct {
+	Model
+	TrackID   uint    `json:"track_id" gorm:"unique_index"`
+	LoopStart uint64  `json:"loop_start"` // microseconds
+	LoopEnd   uint64  `json:"loop_end"`   // microseconds
+	Bars      uint    `json:"bars"`
+	Score     float64 `json:"score"` // similarity of the audio around loop start and loop end from -1 to 1
+	Applied   bool    `json:"applied"`
+}
+
+// LoopSuggestion returns the loop suggestion of the track
+func (jdb *JamDB) LoopSuggestion(trackID uint) (res *LoopSuggestion, err error) {
+	suggestion := &LoopSuggestion{}
+	dbRes := jdb.db.First(suggestion, "track_id = ?", trackID)
+	if dbRes.RecordNotFound() {
+		err = ErrorNotFound
+		return
+	}
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+
+	res = suggestion
+
+	return
+}
+
+// LoopSuggestionSave saves the loop suggestion replacing the previous one of the track
+func (jdb *JamDB) LoopSuggestionSave(suggestion *LoopSuggestion) error {
+	if prev, err := jdb.LoopSuggestion(suggestion.TrackID); err == nil {
+		suggestion.Model = prev.Model
+	} else if err != ErrorNotFound {
+		return err
+	}
+
+	return jdb.db.Save(suggestion).Error
+}
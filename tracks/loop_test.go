@@ -0,0 +1,41 @@
+package tracks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJamDB_LoopSuggestionSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	_, err = jdb.LoopSuggestion(1)
+	assert.Equal(t, ErrorNotFound, err)
+
+	assert.NoError(t, jdb.LoopSuggestionSave(&LoopSuggestion{TrackID: 1, LoopStart: 1000, LoopEnd: 9000, Bars: 4, Score: 0.5}))
+	assert.NoError(t, jdb.LoopSuggestionSave(&LoopSuggestion{TrackID: 1, LoopStart: 2000, LoopEnd: 18000, Bars: 8, Score: 0.9}))
+
+	res, err := jdb.LoopSuggestion(1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint64(2000), res.LoopStart)
+	assert.Equal(t, uint(8), res.Bars)
+	assert.False(t, res.Applied)
+
+	var count int
+	jdb.DB().Model(&LoopSuggestion{}).Count(&count)
+	assert.Equal(t, 1, count)
+}
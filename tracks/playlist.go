@@ -13,6 +13,9 @@ type PlaylistTrack struct {
 	Repeats uint `json:"repeats"` // число повторений зацикленной части трека
 	Timeout uint `json:"timeout"` // пауза после трека
 	Queue   bool `json:"queue"`   // действует ли очередь во время трека
+	// SoloPolicy и SoloValue переопределяют длительность игры каждого участника очереди на этом треке
+	SoloPolicy string `json:"solo_policy,omitempty"`
+	SoloValue  uint   `json:"solo_value,omitempty"`
 }
 
 type Playlist struct {
@@ -29,9 +32,9 @@ type Playlist struct {
 func (ps PlaylistSlice) String() (res string) {
 	for _, playlist := range ps {
 		if playlist.Description != "" {
-			res += fmt.Sprintf("%s (%d tracks) - %s", playlist.Name, len(playlist.Tracks), playlist.Description)
+			res += fmt.Sprintf("%s (%d tracks) - %s\n", playlist.Name, len(playlist.Tracks), playlist.Description)
 		} else {
-			res += fmt.Sprintf("%s (%d tracks)", playlist.Name, len(playlist.Tracks))
+			res += fmt.Sprintf("%s (%d tracks)\n", playlist.Name, len(playlist.Tracks))
 		}
 	}
 
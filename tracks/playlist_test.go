@@ -0,0 +1,15 @@
+package tracks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPlaylistSlice_String(t *testing.T) {
+	ps := PlaylistSlice{
+		{Name: "Blues", Tracks: []PlaylistTrack{{TrackID: 1}, {TrackID: 2}}, Description: "slow blues"},
+		{Name: "Funk"},
+	}
+
+	assert.Equal(t, "Blues (2 tracks) - slow blues\nFunk (0 tracks)", ps.String())
+}
@@ -0,0 +1,103 @@
+package tracks
+
+import (
+	"time"
+)
+
+// QueueSession is a period between start and stop of the queue
+type QueueSession struct {
+	Model
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"` // nil while the session goes on
+}
+
+// QueueTurn is a turn of one user in the queue
+type QueueTurn struct {
+	Model
+	SessionID uint      `gorm:"index" json:"session_id"`
+	UserName  string    `gorm:"index" json:"user_name"`
+	TrackID   uint      `json:"track_id"` // 0 if the queue plays without a track
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Seconds   uint      `json:"seconds"` // time on stage
+	Skipped   bool      `json:"skipped"` // the user passed the turn or was idle
+	Left      bool      `json:"left"`    // the user left the queue during the turn
+}
+
+// QueueUserStats is a summary of turns of one user
+type QueueUserStats struct {
+	UserName string `json:"user_name"`
+	Solos    uint   `json:"solos"`
+	Seconds  uint   `json:"seconds"`
+}
+
+func (jdb *JamDB) QueueSessionStart(startedAt time.Time) (res *QueueSession, err error) {
+	session := &QueueSession{StartedAt: startedAt}
+	if err = jdb.db.Create(session).Error; err != nil {
+		return
+	}
+
+	res = session
+
+	return
+}
+
+func (jdb *JamDB) QueueSessionStop(id uint, stoppedAt time.Time) (err error) {
+	dbRes := jdb.db.Model(&QueueSession{}).Where("id = ?", id).Update("stopped_at", stoppedAt)
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+	if dbRes.RowsAffected == 0 {
+		err = ErrorNotFound
+	}
+
+	return
+}
+
+// LastQueueSession returns the current session or the last finished one
+func (jdb *JamDB) LastQueueSession() (res *QueueSession, err error) {
+	session := &QueueSession{}
+	dbRes := jdb.db.Order("id desc").First(session)
+	if dbRes.RecordNotFound() {
+		err = ErrorNotFound
+		return
+	}
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+
+	res = session
+
+	return
+}
+
+func (jdb *JamDB) QueueTurnAdd(turn *QueueTurn) (err error) {
+	return jdb.db.Create(turn).Error
+}
+
+// QueueTurns returns turns of the session in order of their start, all turns if sessionID is 0
+func (jdb *JamDB) QueueTurns(sessionID uint) (turns []*QueueTurn, err error) {
+	turns = []*QueueTurn{}
+	db := jdb.db.Order("started_at, id")
+	if sessionID != 0 {
+		db = db.Where("session_id = ?", sessionID)
+	}
+	err = db.Find(&turns).Error
+	return
+}
+
+// QueueStats returns solo counts and time on stage per user for the session, all time stats if sessionID is 0.
+// Skipped turns are not counted as solos
+func (jdb *JamDB) QueueStats(sessionID uint) (stats []*QueueUserStats, err error) {
+	stats = []*QueueUserStats{}
+	db := jdb.db.Model(&QueueTurn{}).
+		Select("user_name, count(*) as solos, sum(seconds) as seconds").
+		Where("skipped = ?", false)
+	if sessionID != 0 {
+		db = db.Where("session_id = ?", sessionID)
+	}
+	err = db.Group("user_name").Order("seconds desc, user_name").Scan(&stats).Error
+	return
+}
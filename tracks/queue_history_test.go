@@ -0,0 +1,55 @@
+package tracks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJamDB_QueueStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	start := time.Date(2020, 5, 1, 20, 0, 0, 0, time.UTC)
+	old, err := jdb.QueueSessionStart(start)
+	assert.NoError(t, err)
+	assert.NoError(t, jdb.QueueTurnAdd(&QueueTurn{SessionID: old.ID, UserName: "alice", StartedAt: start, Seconds: 60}))
+	assert.NoError(t, jdb.QueueSessionStop(old.ID, start.Add(time.Minute)))
+
+	session, err := jdb.QueueSessionStart(start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, jdb.QueueTurnAdd(&QueueTurn{SessionID: session.ID, UserName: "bob", StartedAt: start.Add(time.Hour), Seconds: 90}))
+	assert.NoError(t, jdb.QueueTurnAdd(&QueueTurn{SessionID: session.ID, UserName: "alice", StartedAt: start.Add(time.Hour + time.Minute), Seconds: 30}))
+	assert.NoError(t, jdb.QueueTurnAdd(&QueueTurn{SessionID: session.ID, UserName: "alice", StartedAt: start.Add(time.Hour + time.Minute*2), Skipped: true}))
+
+	last, err := jdb.LastQueueSession()
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, last.ID)
+	assert.Nil(t, last.StoppedAt)
+
+	turns, err := jdb.QueueTurns(session.ID)
+	assert.NoError(t, err)
+	assert.Len(t, turns, 3)
+
+	stats, err := jdb.QueueStats(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []*QueueUserStats{{UserName: "bob", Solos: 1, Seconds: 90}, {UserName: "alice", Solos: 1, Seconds: 30}}, stats)
+
+	stats, err = jdb.QueueStats(0)
+	assert.NoError(t, err)
+	assert.Equal(t, []*QueueUserStats{{UserName: "alice", Solos: 2, Seconds: 90}, {UserName: "bob", Solos: 1, Seconds: 90}}, stats)
+
+	assert.Equal(t, ErrorNotFound, jdb.QueueSessionStop(100, start))
+}
@@ -0,0 +1,79 @@
+package tracks
+
+import (
+	"math"
+	"strings"
+)
+
+// TrackFilter selects tracks, zero fields don't filter
+type TrackFilter struct {
+	Query  string   // words to find in the title, artist, album, tags or author name, all of them must be found
+	Key    uint     // KeyA...KeyGSharp
+	Mode   uint     // ModeMinor or ModeMajor
+	BPMMin uint     // lowest tempo, inclusive
+	BPMMax uint     // highest tempo, inclusive
+	Tags   []string // tag names, the track must have all of them
+	Offset int
+	Limit  int // 0 returns all found tracks
+}
+
+const (
+	// условие на тег трека, параметр - имя тега в нижнем регистре
+	trackTagSQL = `EXISTS (SELECT 1 FROM track_tags JOIN tags ON tags.id = track_tags.tag_id
+		WHERE track_tags.track_id = tracks.id AND tags.deleted_at IS NULL AND unicode_lower(tags.name) = ?)`
+	// условие на слово запроса, параметр - слово в нижнем регистре 5 раз
+	trackWordSQL = `(instr(unicode_lower(tracks.title), ?) > 0 OR instr(unicode_lower(tracks.artist), ?) > 0
+		OR instr(unicode_lower(tracks.album), ?) > 0
+		OR EXISTS (SELECT 1 FROM track_tags JOIN tags ON tags.id = track_tags.tag_id
+			WHERE track_tags.track_id = tracks.id AND tags.deleted_at IS NULL AND instr(unicode_lower(tags.name), ?) > 0)
+		OR EXISTS (SELECT 1 FROM authors
+			WHERE authors.id = tracks.author_id AND authors.deleted_at IS NULL AND instr(unicode_lower(authors.name), ?) > 0))`
+)
+
+// FindTracks returns a page of available tracks matching the filter ordered by title and the number of all matching tracks.
+// Words and tags are matched case-insensitively by unicode_lower, SQLite folds the case of ASCII letters only
+func (jdb *JamDB) FindTracks(filter TrackFilter) (tracks []*Track, total int, err error) {
+	db := jdb.db.Model(&Track{}).Where("tracks.unavailable = ?", false)
+	if filter.Key != 0 {
+		db = db.Where(`tracks."key" = ?`, filter.Key)
+	}
+	if filter.Mode != 0 {
+		db = db.Where("tracks.mode = ?", filter.Mode)
+	}
+	if filter.BPMMin != 0 {
+		db = db.Where("tracks.bpm >= ?", filter.BPMMin)
+	}
+	if filter.BPMMax != 0 {
+		db = db.Where("tracks.bpm <= ?", filter.BPMMax)
+	}
+	for _, name := range filter.Tags {
+		db = db.Where(trackTagSQL, strings.ToLower(name))
+	}
+	for _, word := range strings.Fields(strings.ToLower(filter.Query)) {
+		db = db.Where(trackWordSQL, word, word, word, word, word)
+	}
+
+	if err = db.Count(&total).Error; err != nil {
+		return
+	}
+
+	tracks = []*Track{}
+	if total == 0 || filter.Offset >= total {
+		return
+	}
+
+	db = db.Preload("Tags").Preload("Author").Order("tracks.title, tracks.id")
+	if filter.Offset > 0 {
+		db = db.Offset(filter.Offset)
+		if filter.Limit == 0 {
+			// OFFSET в SQLite допустим только вместе с LIMIT
+			db = db.Limit(math.MaxInt64)
+		}
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+	err = db.Find(&tracks).Error
+
+	return
+}
@@ -0,0 +1,103 @@
+package tracks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJamDB_FindTracks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	for _, track := range []*Track{
+		{Title: "Slow Blues", Artist: "Jammer", Key: KeyA, Mode: ModeMinor, BPM: 70},
+		{Title: "Funk Groove", Album: "Blues Night", Key: KeyE, Mode: ModeMinor, BPM: 100,
+			Tags: []Tag{{Name: "funk"}}},
+		{Title: "Shuffle in A", Key: KeyA, Mode: ModeMajor, BPM: 120,
+			Tags: []Tag{{Name: "blues"}, {Name: "shuffle"}}, Author: &Author{Name: "Павел"}},
+		{Title: "Rock Ballad", BPM: 80},
+		{Title: "Lost Blues", BPM: 80, Unavailable: true},
+		{Title: "100% Blues_Rock", BPM: 90},
+	} {
+		assert.NoError(t, jdb.DB().Save(track).Error)
+	}
+
+	titles := func(found []*Track) (res []string) {
+		for _, t := range found {
+			res = append(res, t.Title)
+		}
+		return
+	}
+
+	// файлы недоступных треков пропали - они не находятся
+	found, total, err := jdb.FindTracks(TrackFilter{Query: "blues"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []string{"100% Blues_Rock", "Funk Groove", "Shuffle in A", "Slow Blues"}, titles(found))
+
+	// символы шаблонов LIKE ищутся как есть
+	found, _, err = jdb.FindTracks(TrackFilter{Query: "1_0"})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	found, _, err = jdb.FindTracks(TrackFilter{Query: "% blues_"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"100% Blues_Rock"}, titles(found))
+
+	found, total, err = jdb.FindTracks(TrackFilter{Query: "Blues SHUFFLE"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []string{"Shuffle in A"}, titles(found))
+
+	// автор и регистр не-ASCII букв
+	found, _, err = jdb.FindTracks(TrackFilter{Query: "павел"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Shuffle in A"}, titles(found))
+
+	found, _, err = jdb.FindTracks(TrackFilter{Key: KeyA})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Shuffle in A", "Slow Blues"}, titles(found))
+
+	found, _, err = jdb.FindTracks(TrackFilter{Key: KeyA, Mode: ModeMinor})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Slow Blues"}, titles(found))
+
+	found, _, err = jdb.FindTracks(TrackFilter{BPMMin: 80, BPMMax: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"100% Blues_Rock", "Funk Groove", "Rock Ballad"}, titles(found))
+
+	found, _, err = jdb.FindTracks(TrackFilter{Tags: []string{"Blues", "shuffle"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Shuffle in A"}, titles(found))
+
+	found, total, err = jdb.FindTracks(TrackFilter{Offset: 1, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, total)
+	assert.Equal(t, []string{"Funk Groove", "Rock Ballad"}, titles(found))
+	if assert.Len(t, found, 2) {
+		assert.Len(t, found[0].Tags, 1)
+	}
+
+	found, _, err = jdb.FindTracks(TrackFilter{Offset: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Shuffle in A", "Slow Blues"}, titles(found))
+	if assert.Len(t, found, 2) && assert.NotNil(t, found[0].Author) {
+		assert.Equal(t, "Павел", found[0].Author.Name)
+	}
+
+	found, total, err = jdb.FindTracks(TrackFilter{Offset: 10, Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, total)
+	assert.Empty(t, found)
+}
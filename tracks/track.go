@@ -98,6 +98,13 @@ type Track struct {
 	Peak       float32 `json:"peak"`
 	Shortterm  float32 `json:"shortterm"`
 	Momentary  float32 `json:"momentary"`
+
+	// the file as it was synced, unchanged files are skipped by the next sync
+	FileSize    int64  `json:"-"`
+	FileModTime int64  `json:"-"` // unix nanoseconds
+	FileHash    string `json:"-" gorm:"index"`
+	// the file is missing, random selection skips the track until the file is back
+	Unavailable bool `json:"unavailable" gorm:"not null;default:false"`
 }
 
 type Tag struct {
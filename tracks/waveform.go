@@ -0,0 +1,131 @@
+package tracks
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Waveform is the overview of the track audio computed by sync to draw the track when editing loop points
+type Waveform struct {
+	Model
+	TrackID      uint   `gorm:"unique_index"`
+	Length       uint64 // microseconds of audio
+	PeaksRate    uint   // peaks per second
+	Peaks        []byte // min and max sample of every 1/PeaksRate second as int8 pairs
+	LoudnessRate uint   // loudness values per second
+	Loudness     []byte // short-term loudness in LUFS every 1/LoudnessRate second as little endian float32
+}
+
+// WaveformPoints is the waveform downsampled to a number of points
+type WaveformPoints struct {
+	Min      []float32 `json:"min"`      // minimum sample of the point from -1 to 1
+	Max      []float32 `json:"max"`      // maximum sample of the point from -1 to 1
+	Loudness []float32 `json:"loudness"` // maximum short-term loudness of the point in LUFS
+}
+
+// Waveform returns the waveform of the track
+func (jdb *JamDB) Waveform(trackID uint) (res *Waveform, err error) {
+	waveform := &Waveform{}
+	dbRes := jdb.db.First(waveform, "track_id = ?", trackID)
+	if dbRes.RecordNotFound() {
+		err = ErrorNotFound
+		return
+	}
+	if dbRes.Error != nil {
+		err = dbRes.Error
+		return
+	}
+
+	res = waveform
+
+	return
+}
+
+// WaveformSave saves the waveform replacing the previous one of the track
+func (jdb *JamDB) WaveformSave(waveform *Waveform) error {
+	if prev, err := jdb.Waveform(waveform.TrackID); err == nil {
+		waveform.Model = prev.Model
+	} else if err != ErrorNotFound {
+		return err
+	}
+
+	return jdb.db.Save(waveform).Error
+}
+
+// SetPeaks stores min and max samples from -1 to 1
+func (w *Waveform) SetPeaks(min, max []float32) {
+	w.Peaks = make([]byte, 0, len(min)*2)
+	for i := range min {
+		w.Peaks = append(w.Peaks, byte(toInt8(min[i])), byte(toInt8(max[i])))
+	}
+}
+
+// SetLoudness stores loudness values
+func (w *Waveform) SetLoudness(loudness []float32) {
+	w.Loudness = make([]byte, len(loudness)*4)
+	for i, v := range loudness {
+		binary.LittleEndian.PutUint32(w.Loudness[i*4:], math.Float32bits(v))
+	}
+}
+
+// Points downsamples the waveform to n points, every point is the same part of the track
+func (w *Waveform) Points(n int) WaveformPoints {
+	peaks := len(w.Peaks) / 2
+	loudness := len(w.Loudness) / 4
+	res := WaveformPoints{Min: make([]float32, n), Max: make([]float32, n), Loudness: make([]float32, n)}
+
+	for i := 0; i < n; i++ {
+		// точка покрывает значения [from, to), если значений меньше чем точек - берём ближайшее
+		from, to := bucket(i, n, peaks)
+		res.Min[i], res.Max[i] = 1, -1
+		for j := from; j < to; j++ {
+			min, max := float32(int8(w.Peaks[j*2]))/127, float32(int8(w.Peaks[j*2+1]))/127
+			if min < res.Min[i] {
+				res.Min[i] = min
+			}
+			if max > res.Max[i] {
+				res.Max[i] = max
+			}
+		}
+		if from == to {
+			res.Min[i], res.Max[i] = 0, 0
+		}
+
+		from, to = bucket(i, n, loudness)
+		res.Loudness[i] = float32(math.Inf(-1))
+		for j := from; j < to; j++ {
+			if v := math.Float32frombits(binary.LittleEndian.Uint32(w.Loudness[j*4:])); v > res.Loudness[i] {
+				res.Loudness[i] = v
+			}
+		}
+		if from == to {
+			res.Loudness[i] = 0
+		}
+	}
+
+	return res
+}
+
+// bucket returns the range of total values covered by point i of n, at least one value if there are any
+func bucket(i, n, total int) (from, to int) {
+	if total == 0 {
+		return 0, 0
+	}
+	from = i * total / n
+	to = (i + 1) * total / n
+	if to <= from {
+		to = from + 1
+	}
+	return
+}
+
+func toInt8(v float32) int8 {
+	v = float32(math.Round(float64(v) * 127))
+	if v > 127 {
+		return 127
+	}
+	if v < -127 {
+		return -127
+	}
+	return int8(v)
+}
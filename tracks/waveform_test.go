@@ -0,0 +1,52 @@
+package tracks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJamDB_WaveformSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	jdb, err := NewJamDB(filepath.Join(dir, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer jdb.DBClose()
+
+	_, err = jdb.Waveform(1)
+	assert.Equal(t, ErrorNotFound, err)
+
+	waveform := &Waveform{TrackID: 1, PeaksRate: 100}
+	waveform.SetPeaks([]float32{-0.5, -1}, []float32{0.5, 1})
+	assert.NoError(t, jdb.WaveformSave(waveform))
+
+	waveform = &Waveform{TrackID: 1, PeaksRate: 10}
+	waveform.SetPeaks([]float32{-0.2}, []float32{0.4})
+	waveform.SetLoudness([]float32{-20, -10})
+	assert.NoError(t, jdb.WaveformSave(waveform))
+
+	res, err := jdb.Waveform(1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint(10), res.PeaksRate)
+
+	// точек больше, чем значений - значения повторяются
+	points := res.Points(2)
+	assert.InDelta(t, -0.2, points.Min[1], 0.01)
+	assert.InDelta(t, 0.4, points.Max[0], 0.01)
+	assert.Equal(t, []float32{-20, -10}, points.Loudness)
+	assert.Equal(t, []float32{-10}, res.Points(1).Loudness)
+
+	var count int
+	jdb.DB().Model(&Waveform{}).Count(&count)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,301 @@
+package tracks_sync
+
+import (
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+)
+
+const (
+	detectDownsample = 4     // 44.1 kHz is analysed at 11 kHz, enough for onsets and notes up to A6
+	onsetWindow      = 0.046 // seconds of the spectrum frame for onsets
+	onsetRate        = 100   // onset strength values per second
+	chromaWindow     = 0.37  // seconds of the spectrum frame for notes, long enough to resolve semitones of A1
+	minBPM           = 60
+	maxBPM           = 200
+	priorBPM         = 120 // the most likely tempo, octave errors are resolved towards it
+	tempoMultiples   = 4   // beats compared by autocorrelation at every tempo
+	minNoteFreq      = 55  // A1
+	maxNoteFreq      = 1760
+	defaultBPI       = 16
+)
+
+// Krumhansl-Kessler key profiles starting from the tonic
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// detectTrack fills BPM and key missing in the tags from the saved detection of the track or audio analysis,
+// the returned detection must be saved after the track
+func detectTrack(trackPath string, track *tracks.Track) *tracks.Detection {
+	if track.BPM != 0 && track.Key != 0 {
+		return nil
+	}
+
+	var detection *tracks.Detection
+	if track.ID != 0 {
+		// пересинхронизация: значения, проверенные человеком или посчитанные ранее, не пересчитываем
+		detection, _ = jamDB.Detection(track.ID)
+	}
+	if detection == nil {
+		var err error
+		if detection, err = Detect(trackPath); err != nil {
+			logrus.Errorf("BPM and key detection of %s: %s", trackPath, err)
+			return nil
+		}
+	}
+
+	detection.BPMDetected = track.BPM == 0 && detection.BPM != 0
+	if detection.BPMDetected {
+		track.BPM = detection.BPM
+		if track.BPI == 0 {
+			track.BPI = defaultBPI
+		}
+	}
+	detection.KeyDetected = track.Key == 0 && detection.Key != 0
+	if detection.KeyDetected {
+		track.Key, track.Mode = detection.Key, detection.Mode
+	}
+
+	return detection
+}
+
+// Detect estimates BPM and key of the MP3 file
+func Detect(trackPath string) (*tracks.Detection, error) {
+	file, err := os.Open(trackPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		return nil, fmt.Errorf("NewDecoder error in %s: %s", trackPath, err)
+	}
+
+	return detect(decoder, decoder.SampleRate())
+}
+
+// detect estimates BPM and key of 16-bit stereo PCM
+func detect(pcm io.Reader, sampleRate int) (*tracks.Detection, error) {
+	if sampleRate < detectDownsample*onsetRate {
+		return nil, fmt.Errorf("bad sample rate %d", sampleRate)
+	}
+
+	signal, err := monoSignal(pcm, detectDownsample)
+	if err != nil {
+		return nil, err
+	}
+	rate := float64(sampleRate) / detectDownsample
+
+	detection := &tracks.Detection{}
+	detection.BPM, detection.BPMConfidence = detectTempo(signal, rate)
+	detection.Key, detection.Mode, detection.KeyConfidence = detectKey(signal, rate)
+
+	return detection, nil
+}
+
+// detectTempo finds the tempo by autocorrelation of onset strength: the spectral flux is periodic with beats.
+// Every tempo is scored by the mean normalized autocorrelation at lags of 1 to tempoMultiples beats,
+// the score weighted by closeness to priorBPM chooses the tempo, the score itself is the confidence.
+func detectTempo(signal []float32, rate float64) (bpm uint, confidence float64) {
+	hop := int(math.Round(rate / onsetRate))
+	frameRate := rate / float64(hop)
+	onsets := onsetStrength(signal, nextPow2(int(rate*onsetWindow)), hop)
+
+	maxLag := int(math.Ceil(frameRate*60/minBPM)) * tempoMultiples
+	if len(onsets) <= maxLag {
+		return 0, 0
+	}
+
+	var mean float64
+	for _, v := range onsets {
+		mean += v
+	}
+	mean /= float64(len(onsets))
+	for i := range onsets {
+		onsets[i] -= mean
+	}
+
+	ac := make([]float64, maxLag+2)
+	for lag := range ac {
+		for i := 0; i+lag < len(onsets); i++ {
+			ac[lag] += onsets[i] * onsets[i+lag]
+		}
+	}
+	if ac[0] <= 0 {
+		return 0, 0
+	}
+
+	best := 0.0
+	for b := minBPM; b <= maxBPM; b++ {
+		beat := frameRate * 60 / float64(b)
+		var score float64
+		for k := 1; k <= tempoMultiples; k++ {
+			// корреляция на дробном лаге - линейная интерполяция соседних
+			lag := beat * float64(k)
+			i := int(lag)
+			score += (ac[i] + (ac[i+1]-ac[i])*(lag-float64(i))) / ac[0]
+		}
+		score /= tempoMultiples
+
+		octaves := math.Log2(float64(b) / priorBPM)
+		if weighted := score * math.Exp(-0.5*octaves*octaves); weighted > best {
+			best = weighted
+			bpm, confidence = uint(b), score
+		}
+	}
+
+	return bpm, math.Max(0, math.Min(1, confidence))
+}
+
+// onsetStrength returns spectral flux of log magnitudes of frames every hop samples
+func onsetStrength(signal []float32, size, hop int) []float64 {
+	var res []float64
+	prev := make([]float64, size/2)
+	window := hann(size)
+	frame := make([]complex128, size)
+
+	for pos := 0; pos+size <= len(signal); pos += hop {
+		for i := range frame {
+			frame[i] = complex(float64(signal[pos+i])*window[i], 0)
+		}
+		fft(frame)
+
+		var flux float64
+		for i := range prev {
+			v := math.Log1p(100 * cmplx.Abs(frame[i]))
+			if d := v - prev[i]; d > 0 && pos > 0 {
+				flux += d
+			}
+			prev[i] = v
+		}
+		res = append(res, flux)
+	}
+
+	return res
+}
+
+// detectKey matches the chroma of the whole track with major and minor profiles of all 12 keys,
+// the confidence is the correlation with the best profile
+func detectKey(signal []float32, rate float64) (key, mode uint, confidence float64) {
+	size := nextPow2(int(rate * chromaWindow))
+	window := hann(size)
+	frame := make([]complex128, size)
+
+	// номер ступени от ля для каждого бина спектра, -1 вне диапазона нот
+	pitch := make([]int, size/2)
+	for i := range pitch {
+		pitch[i] = -1
+		freq := float64(i) * rate / float64(size)
+		if freq >= minNoteFreq && freq <= maxNoteFreq {
+			pitch[i] = (int(math.Round(12*math.Log2(freq/440)))%12 + 12) % 12
+		}
+	}
+
+	var chroma [12]float64
+	for pos := 0; pos+size <= len(signal); pos += size / 2 {
+		for i := range frame {
+			frame[i] = complex(float64(signal[pos+i])*window[i], 0)
+		}
+		fft(frame)
+		for i, p := range pitch {
+			if p >= 0 {
+				chroma[p] += cmplx.Abs(frame[i])
+			}
+		}
+	}
+
+	profiles := []struct {
+		mode    uint
+		profile [12]float64
+	}{{tracks.ModeMajor, majorProfile}, {tracks.ModeMinor, minorProfile}}
+
+	best := 0.0
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, p := range profiles {
+			var rotated [12]float64
+			for i := range rotated {
+				rotated[(tonic+i)%12] = p.profile[i]
+			}
+			if c := correlation(chroma[:], rotated[:]); c > best {
+				best = c
+				key, mode = tracks.KeyA+uint(tonic), p.mode
+			}
+		}
+	}
+
+	return key, mode, best
+}
+
+// correlation returns Pearson correlation of a and b, 0 if any of them is constant
+func correlation(a, b []float64) float64 {
+	var meanA, meanB float64
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(len(a))
+	meanB /= float64(len(b))
+
+	var cov, varA, varB float64
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+
+	return cov / math.Sqrt(varA*varB)
+}
+
+func hann(size int) []float64 {
+	res := make([]float64, size)
+	for i := range res {
+		res[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	return res
+}
+
+func nextPow2(n int) int {
+	res := 1
+	for res < n {
+		res <<= 1
+	}
+	return res
+}
+
+// fft is the in-place radix-2 FFT, the length must be a power of 2
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
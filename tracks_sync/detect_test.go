@@ -0,0 +1,71 @@
+package tracks_sync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// clicks returns 16-bit stereo PCM of decaying 1 kHz bursts every beat of the tempo
+func clicks(sampleRate int, bpm float64, seconds float64) []byte {
+	buf := &bytes.Buffer{}
+	beat := int(float64(sampleRate) * 60 / bpm)
+	for i := 0; i < int(float64(sampleRate)*seconds); i++ {
+		t := float64(i%beat) / float64(sampleRate)
+		s := int16(0.5 * math.MaxInt16 * math.Exp(-t*40) * math.Sin(2*math.Pi*1000*t))
+		binary.Write(buf, binary.LittleEndian, [2]int16{s, s})
+	}
+	return buf.Bytes()
+}
+
+// chord returns 16-bit stereo PCM of sines of the frequencies with the amplitudes
+func chord(sampleRate int, seconds float64, freqs, amplitudes []float64) []byte {
+	buf := &bytes.Buffer{}
+	for i := 0; i < int(float64(sampleRate)*seconds); i++ {
+		var v float64
+		for j, freq := range freqs {
+			v += amplitudes[j] * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))
+		}
+		s := int16(0.2 * math.MaxInt16 * v)
+		binary.Write(buf, binary.LittleEndian, [2]int16{s, s})
+	}
+	return buf.Bytes()
+}
+
+func Test_detectTempo(t *testing.T) {
+	for _, bpm := range []float64{90, 120, 143, 175} {
+		detection, err := detect(bytes.NewReader(clicks(22050, bpm, 20)), 22050)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, uint(bpm), detection.BPM, "tempo %v", bpm)
+		assert.Greater(t, detection.BPMConfidence, 0.5, "tempo %v", bpm)
+	}
+
+	detection, err := detect(bytes.NewReader(make([]byte, 22050*4*20)), 22050)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(0), detection.BPM)
+		assert.Equal(t, uint(0), detection.Key)
+		assert.Equal(t, float64(0), detection.BPMConfidence)
+	}
+}
+
+func Test_detectKey(t *testing.T) {
+	// до мажор: C4, E4, G4 и C5
+	detection, err := detect(bytes.NewReader(chord(22050, 5, []float64{261.63, 329.63, 392, 523.25}, []float64{1, 0.6, 0.7, 0.5})), 22050)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tracks.KeyC, detection.Key)
+		assert.Equal(t, tracks.ModeMajor, detection.Mode)
+		assert.Greater(t, detection.KeyConfidence, 0.5)
+	}
+
+	// ля минор: A3, C4, E4 и A4
+	detection, err = detect(bytes.NewReader(chord(22050, 5, []float64{220, 261.63, 329.63, 440}, []float64{1, 0.6, 0.7, 0.5})), 22050)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tracks.KeyA, detection.Key)
+		assert.Equal(t, tracks.ModeMinor, detection.Mode)
+	}
+}
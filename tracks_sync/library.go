@@ -0,0 +1,368 @@
+package tracks_sync
+
+import (
+	"errors"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrorSyncRunning is returned if the library sync is started while the previous one is not finished
+var ErrorSyncRunning = errors.New("library sync is already running")
+
+// SyncStatus is the progress and the result of the library sync
+type SyncStatus struct {
+	Running     bool        `json:"running"`
+	StartedAt   *time.Time  `json:"started_at,omitempty"`
+	FinishedAt  *time.Time  `json:"finished_at,omitempty"`
+	Total       int         `json:"total"`     // MP3 files found
+	Processed   int         `json:"processed"` // files processed so far including failed
+	Added       int         `json:"added"`
+	Updated     int         `json:"updated"`
+	Skipped     int         `json:"skipped"`     // unchanged since the last sync or deleted through API
+	Renamed     int         `json:"renamed"`     // moved tracks found by content hash
+	Unavailable int         `json:"unavailable"` // tracks marked unavailable as their files are missing
+	Failed      int         `json:"failed"`
+	Errors      []FileError `json:"errors"`
+}
+
+// FileError is the error of the file sync
+type FileError struct {
+	Path  string `json:"path"` // relative to the tracks directory
+	Error string `json:"error"`
+}
+
+type syncResult int
+
+const (
+	syncAdded syncResult = iota
+	syncUpdated
+	syncSkipped
+	syncRenamed
+)
+
+var syncMtx sync.Mutex
+var syncStatus = SyncStatus{Errors: []FileError{}}
+
+// файл может синхронизироваться одновременно полной синхронизацией и наблюдателем, блокируем по пути
+var fileLocks = pathLocks{locks: map[string]*pathLock{}}
+
+type pathLocks struct {
+	mtx   sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (p *pathLocks) lock(path string) {
+	p.mtx.Lock()
+	l, ok := p.locks[path]
+	if !ok {
+		l = &pathLock{}
+		p.locks[path] = l
+	}
+	l.refs++
+	p.mtx.Unlock()
+
+	l.Lock()
+}
+
+func (p *pathLocks) unlock(path string) {
+	p.mtx.Lock()
+	l := p.locks[path]
+	l.refs--
+	if l.refs == 0 {
+		delete(p.locks, path)
+	}
+	p.mtx.Unlock()
+
+	l.Unlock()
+}
+
+// StartSync starts the library sync in background, progress is called after every file
+func StartSync(workers int, progress func(SyncStatus)) error {
+	if err := beginSync(); err != nil {
+		return err
+	}
+	go runSync(workers, progress)
+
+	return nil
+}
+
+// Sync syncs the library and returns the result, progress is called after every file
+func Sync(workers int, progress func(SyncStatus)) (SyncStatus, error) {
+	if err := beginSync(); err != nil {
+		return SyncStatus{}, err
+	}
+
+	return runSync(workers, progress), nil
+}
+
+// Status returns the status of the running or the last library sync
+func Status() SyncStatus {
+	syncMtx.Lock()
+	defer syncMtx.Unlock()
+
+	return syncStatus.copy()
+}
+
+func (s SyncStatus) copy() SyncStatus {
+	s.Errors = append([]FileError{}, s.Errors...)
+	return s
+}
+
+func beginSync() error {
+	syncMtx.Lock()
+	defer syncMtx.Unlock()
+
+	if syncStatus.Running {
+		return ErrorSyncRunning
+	}
+	now := time.Now()
+	syncStatus = SyncStatus{Running: true, StartedAt: &now, Errors: []FileError{}}
+
+	return nil
+}
+
+// runSync processes MP3 files of the tracks directory by workers, 0 workers means a worker per CPU
+func runSync(workers int, progress func(SyncStatus)) SyncStatus {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	files := listMP3()
+
+	jobs := make(chan string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				res, err := syncFile(path)
+				status := finishFile(path, res, err)
+				if progress != nil {
+					progress(status)
+				}
+			}
+		}()
+	}
+	for _, path := range files {
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+
+	markMissing()
+
+	syncMtx.Lock()
+	now := time.Now()
+	syncStatus.Running = false
+	syncStatus.FinishedAt = &now
+	status := syncStatus.copy()
+	syncMtx.Unlock()
+
+	logrus.Infof("library sync finished in %s: %d files, %d added, %d updated, %d skipped, %d renamed, %d unavailable, %d failed",
+		now.Sub(*status.StartedAt), status.Total, status.Added, status.Updated, status.Skipped, status.Renamed,
+		status.Unavailable, status.Failed)
+	for _, fileErr := range status.Errors {
+		logrus.Errorf("sync of %s failed: %s", fileErr.Path, fileErr.Error)
+	}
+
+	return status
+}
+
+// listMP3 returns MP3 files of the tracks directory, unreadable directories are recorded as errors
+func listMP3() (files []string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			syncMtx.Lock()
+			syncStatus.Failed++
+			syncStatus.Errors = append(syncStatus.Errors, FileError{Path: relativePath(path), Error: err.Error()})
+			syncMtx.Unlock()
+			return nil
+		}
+		if !info.IsDir() && mp3regex.MatchString(info.Name()) {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	syncMtx.Lock()
+	syncStatus.Total = len(files)
+	syncMtx.Unlock()
+
+	return
+}
+
+func finishFile(path string, res syncResult, err error) SyncStatus {
+	syncMtx.Lock()
+	defer syncMtx.Unlock()
+
+	syncStatus.Processed++
+	switch {
+	case err != nil:
+		syncStatus.Failed++
+		syncStatus.Errors = append(syncStatus.Errors, FileError{Path: relativePath(path), Error: err.Error()})
+	case res == syncAdded:
+		syncStatus.Added++
+	case res == syncUpdated:
+		syncStatus.Updated++
+	case res == syncSkipped:
+		syncStatus.Skipped++
+	case res == syncRenamed:
+		syncStatus.Renamed++
+	}
+
+	return syncStatus.copy()
+}
+
+// markMissing marks tracks unavailable if their files are missing
+func markMissing() {
+	paths, err := jamDB.AvailableTrackPaths()
+	if err != nil {
+		logrus.Errorf("tracks of the library: %s", err)
+		return
+	}
+
+	for _, p := range paths {
+		marked, err := removeFile(filepath.Join(dir, p))
+		if err != nil {
+			logrus.Errorf("mark %s unavailable: %s", p, err)
+		} else if marked {
+			syncMtx.Lock()
+			syncStatus.Unavailable++
+			syncMtx.Unlock()
+		}
+	}
+}
+
+// removeFile marks the track of the file unavailable if the file doesn't exist
+func removeFile(path string) (marked bool, err error) {
+	relative := relativePath(path)
+	fileLocks.lock(relative)
+	defer fileLocks.unlock(relative)
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		return false, nil
+	}
+	track, err := jamDB.TrackByPath(relative)
+	if err == tracks.ErrorNotFound || err == nil && track.Unavailable {
+		return false, nil
+	} else if err != nil {
+		return
+	}
+
+	logrus.Warnf("file of track %d %s is missing, the track is unavailable", track.ID, relative)
+	err = jamDB.TrackAvailable(relative, false)
+
+	return err == nil, err
+}
+
+// renameFile moves the track of the same content whose file is missing to the new file
+func renameFile(path string) (renamed bool, err error) {
+	size, modTime, hash, err := fileInfo(path)
+	if err != nil {
+		return
+	}
+	candidates, err := jamDB.TracksByHash(hash)
+	if err != nil {
+		return
+	}
+
+	for _, track := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, track.FilePath)); !os.IsNotExist(err) {
+			continue
+		}
+		logrus.Infof("track %d is moved from %s to %s", track.ID, track.FilePath, relativePath(path))
+		return true, jamDB.TrackRename(track.ID, relativePath(path), size, modTime)
+	}
+
+	return
+}
+
+// syncFile analyses the file unless it is the same as at the last sync
+func syncFile(path string) (syncResult, error) {
+	relative := relativePath(path)
+	fileLocks.lock(relative)
+	defer fileLocks.unlock(relative)
+
+	if deleted, _ := jamDB.DeletedTrackByPath(relative); deleted != nil {
+		return syncSkipped, nil
+	}
+
+	track, err := jamDB.TrackByPath(relative)
+	if err != nil && err != tracks.ErrorNotFound {
+		return 0, err
+	}
+	if track == nil {
+		if renamed, err := renameFile(path); err != nil {
+			return 0, err
+		} else if renamed {
+			return syncRenamed, nil
+		}
+	}
+	if track != nil && track.FileHash != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		// хеш считаем, только если размер и время изменения совпали - иначе файл точно изменился
+		if info.Size() == track.FileSize && info.ModTime().UnixNano() == track.FileModTime {
+			_, _, hash, err := fileInfo(path)
+			if err != nil {
+				return 0, err
+			}
+			if hash == track.FileHash {
+				if track.Unavailable {
+					logrus.Infof("file of track %d %s is back", track.ID, relative)
+					return syncSkipped, jamDB.TrackAvailable(relative, true)
+				}
+				return syncSkipped, nil
+			}
+		}
+	}
+
+	if _, err = ProcessMP3Track(path); err != nil {
+		return 0, err
+	}
+	if track != nil {
+		return syncUpdated, nil
+	}
+
+	return syncAdded, nil
+}
+
+// ExportTags writes metadata of every available track from DB to its MP3 file: title, artist, album
+// and the GuitarJam frame with key, BPM and loop points. Returns the number of written files and errors.
+func ExportTags() (exported int, errs []FileError, err error) {
+	list, err := jamDB.Tracks()
+	if err != nil {
+		return
+	}
+
+	errs = []FileError{}
+	for _, track := range list {
+		if track.Unavailable {
+			continue
+		}
+
+		fileLocks.lock(track.FilePath)
+		err := UpdateMP3Track(track)
+		fileLocks.unlock(track.FilePath)
+		if err != nil {
+			errs = append(errs, FileError{Path: track.FilePath, Error: err.Error()})
+			continue
+		}
+		exported++
+	}
+
+	return
+}
@@ -0,0 +1,122 @@
+package tracks_sync
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	d, err := ioutil.TempDir("", "tracks_sync")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(d)
+
+	db, err := tracks.NewJamDB(filepath.Join(d, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.DBClose()
+	Init(d, db)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(d, "blues"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "blues", "broken.mp3"), []byte("not mp3"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "blues", "synced.mp3"), []byte("synced before"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "notes.txt"), []byte("not a track"), 0644))
+
+	// неизменившийся с прошлой синхронизации файл не анализируется
+	size, modTime, hash, err := fileInfo(filepath.Join(d, "blues", "synced.mp3"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, db.DB().Save(&tracks.Track{FilePath: "blues/synced.mp3", FileSize: size, FileModTime: modTime, FileHash: hash}).Error)
+
+	var progress []int
+	status, err := Sync(1, func(status SyncStatus) {
+		progress = append(progress, status.Processed)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []int{1, 2}, progress)
+	assert.False(t, status.Running)
+	assert.NotNil(t, status.FinishedAt)
+	assert.Equal(t, 2, status.Total)
+	assert.Equal(t, 1, status.Skipped)
+	assert.Equal(t, 1, status.Failed)
+	if assert.Len(t, status.Errors, 1) {
+		assert.Equal(t, "blues/broken.mp3", status.Errors[0].Path)
+	}
+	assert.Equal(t, status, Status())
+
+	// содержимое изменилось при тех же размере и времени изменения
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "blues", "synced.mp3"), []byte("synced BEFORE"), 0644))
+	info, _ := os.Stat(filepath.Join(d, "blues", "synced.mp3"))
+	assert.NoError(t, db.DB().Model(&tracks.Track{}).Where("file_path = ?", "blues/synced.mp3").
+		UpdateColumn("file_mod_time", info.ModTime().UnixNano()).Error)
+
+	status, err = Sync(2, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, status.Skipped)
+		assert.Equal(t, 2, status.Failed)
+	}
+}
+
+func TestSync_rename(t *testing.T) {
+	d, err := ioutil.TempDir("", "tracks_sync")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(d)
+
+	db, err := tracks.NewJamDB(filepath.Join(d, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.DBClose()
+	Init(d, db)
+
+	// файл old.mp3 переименовали в new.mp3, пока бот не работал
+	file := filepath.Join(d, "new.mp3")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("track"), 0644))
+	size, modTime, hash, err := fileInfo(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, db.DB().Save(&tracks.Track{FilePath: "old.mp3", Played: 5, FileSize: size, FileModTime: modTime, FileHash: hash}).Error)
+
+	status, err := Sync(1, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, status.Renamed)
+	track, err := db.Track(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "new.mp3", track.FilePath)
+		assert.Equal(t, uint64(5), track.Played)
+	}
+
+	assert.NoError(t, os.Remove(file))
+	status, err = Sync(1, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, status.Unavailable)
+	}
+	track, _ = db.Track(1)
+	assert.True(t, track.Unavailable)
+
+	// файл вернули как был
+	assert.NoError(t, ioutil.WriteFile(file, []byte("track"), 0644))
+	assert.NoError(t, os.Chtimes(file, time.Unix(0, modTime), time.Unix(0, modTime)))
+	status, err = Sync(1, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, status.Skipped)
+		assert.Equal(t, 0, status.Unavailable)
+	}
+	track, _ = db.Track(1)
+	assert.False(t, track.Unavailable)
+}
@@ -0,0 +1,252 @@
+package tracks_sync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/lib"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	loopDownsample      = 16   // samples averaged into one, loop search doesn't need high frequencies
+	loopMinBars         = 4    // shortest loop suggested
+	loopStartSteps      = 4    // loop start candidates per beat
+	loopScoreTolerance  = 0.01 // longer loop is preferred if its score is worse by less than this
+	loopSilence         = 1e-6 // mean square of the window below which it is silence and can't be compared
+	defaultLoopMinScore = 0.9
+)
+
+// ErrorNoLoop is returned if the track is too short for a loop or silent
+var ErrorNoLoop = errors.New("track is too short for a loop or silent")
+
+var loopAutoApply bool
+var loopMinScore = defaultLoopMinScore
+
+// SetLoopOptions enables applying loop suggestions with the score from minScore during sync,
+// zero minScore means the default
+func SetLoopOptions(autoApply bool, minScore float64) {
+	loopAutoApply = autoApply
+	loopMinScore = minScore
+	if minScore == 0 {
+		loopMinScore = defaultLoopMinScore
+	}
+}
+
+// SuggestLoop analyses the audio of the track and saves the loop suggestion, the track must have BPM
+func SuggestLoop(track *tracks.Track) (suggestion *tracks.LoopSuggestion, err error) {
+	suggestion, err = AnalyzeLoop(path.Join(dir, track.FilePath), track.BPM)
+	if err != nil {
+		return
+	}
+	suggestion.TrackID = track.ID
+	err = jamDB.LoopSuggestionSave(suggestion)
+
+	return
+}
+
+// TrackLoopSuggestion returns the saved loop suggestion of the track, it is computed if sync didn't do it
+func TrackLoopSuggestion(track *tracks.Track) (*tracks.LoopSuggestion, error) {
+	suggestion, err := jamDB.LoopSuggestion(track.ID)
+	if err == tracks.ErrorNotFound {
+		return SuggestLoop(track)
+	}
+
+	return suggestion, err
+}
+
+// ApplyLoopSuggestion sets loop points of the track from the suggestion in the MP3 file and DB
+func ApplyLoopSuggestion(track *tracks.Track, suggestion *tracks.LoopSuggestion) (res *tracks.Track, err error) {
+	track.LoopStart = suggestion.LoopStart
+	track.LoopEnd = suggestion.LoopEnd
+
+	if err = UpdateMP3Track(track); err != nil {
+		return
+	}
+
+	res, err = jamDB.TrackUpdate(track.ID, track)
+	if err != nil {
+		return
+	}
+
+	suggestion.Applied = true
+	err = jamDB.LoopSuggestionSave(suggestion)
+
+	return
+}
+
+// processLoop is called by sync for the track without loop points: the applied suggestion is kept,
+// otherwise the loop is suggested and applied if auto apply is on and the score is high enough
+func processLoop(track *tracks.Track) {
+	if track.LoopEnd != 0 || track.BPM == 0 {
+		return
+	}
+
+	suggestion, err := jamDB.LoopSuggestion(track.ID)
+	if err == tracks.ErrorNotFound {
+		suggestion, err = SuggestLoop(track)
+	}
+	if err != nil {
+		logrus.Errorf("loop suggestion of %s: %s", track.FilePath, err)
+		return
+	}
+
+	// файл может не хранить точки цикла, тогда одобренное предложение восстанавливаем после пересинхронизации
+	if !suggestion.Applied && !(loopAutoApply && suggestion.Score >= loopMinScore) {
+		return
+	}
+	if _, err = ApplyLoopSuggestion(track, suggestion); err != nil {
+		logrus.Errorf("apply loop suggestion of %s: %s", track.FilePath, err)
+		return
+	}
+	logrus.Infof("loop %d-%d us (%d bars, score %.3f) applied to %s",
+		suggestion.LoopStart, suggestion.LoopEnd, suggestion.Bars, suggestion.Score, track.FilePath)
+}
+
+// AnalyzeLoop finds the loop of whole bars in the MP3 file whose end sounds the most like its start
+func AnalyzeLoop(trackPath string, bpm uint) (*tracks.LoopSuggestion, error) {
+	file, err := os.Open(trackPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		return nil, fmt.Errorf("NewDecoder error in %s: %s", trackPath, err)
+	}
+
+	return analyzeLoop(decoder, decoder.SampleRate(), bpm)
+}
+
+// analyzeLoop searches the loop in 16-bit stereo PCM. Loop starts are tried every 1/loopStartSteps beat,
+// loop ends are whole bars later. After the jump from the loop end to the loop start the audio following
+// the start is played instead of the audio following the end, so the beat after both points is compared
+// by normalized cross-correlation. The longest loop among the best scored is chosen.
+func analyzeLoop(pcm io.Reader, sampleRate int, bpm uint) (*tracks.LoopSuggestion, error) {
+	if sampleRate < loopDownsample {
+		return nil, fmt.Errorf("bad sample rate %d", sampleRate)
+	}
+	if bpm == 0 {
+		return nil, fmt.Errorf("BPM is unknown")
+	}
+
+	signal, err := monoSignal(pcm, loopDownsample)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := float64(sampleRate) / loopDownsample
+	beat := rate * 60 / float64(bpm)
+	bar := beat * lib.BeatsPerBar
+	window := int(beat)
+
+	energy := make([]float64, len(signal)+1) // energy[i] - сумма квадратов первых i отсчётов
+	for i, s := range signal {
+		energy[i+1] = energy[i] + float64(s)*float64(s)
+	}
+
+	type candidate struct {
+		start float64
+		bars  int
+		score float64
+	}
+	var candidates []candidate
+	best := math.Inf(-1)
+
+	for start := 0.0; ; start += beat / loopStartSteps {
+		s := int(math.Round(start))
+		if s+window+int(bar*loopMinBars) > len(signal) {
+			break
+		}
+		for bars := loopMinBars; ; bars++ {
+			e := int(math.Round(start + float64(bars)*bar))
+			if e+window > len(signal) {
+				break
+			}
+			score, ok := similarity(signal, energy, s, e, window)
+			if !ok {
+				continue
+			}
+			candidates = append(candidates, candidate{start: start, bars: bars, score: score})
+			if score > best {
+				best = score
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrorNoLoop
+	}
+
+	var res *candidate
+	for i, c := range candidates {
+		if c.score < best-loopScoreTolerance {
+			continue
+		}
+		if res == nil || c.bars > res.bars || c.bars == res.bars && c.score > res.score {
+			res = &candidates[i]
+		}
+	}
+
+	loopStart := uint64(time.Duration(res.start/rate*float64(time.Second)) / time.Microsecond)
+	barLength := time.Duration(lib.BeatsPerBar) * time.Minute / time.Duration(bpm)
+
+	return &tracks.LoopSuggestion{
+		LoopStart: loopStart,
+		LoopEnd:   loopStart + uint64(time.Duration(res.bars)*barLength/time.Microsecond),
+		Bars:      uint(res.bars),
+		Score:     res.score,
+	}, nil
+}
+
+// similarity returns normalized cross-correlation of windows starting at a and b,
+// false if any of them is silence
+func similarity(signal []float32, energy []float64, a, b, window int) (float64, bool) {
+	ea, eb := energy[a+window]-energy[a], energy[b+window]-energy[b]
+	if ea < loopSilence*float64(window) || eb < loopSilence*float64(window) {
+		return 0, false
+	}
+
+	var sum float64
+	for i := 0; i < window; i++ {
+		sum += float64(signal[a+i]) * float64(signal[b+i])
+	}
+
+	return sum / math.Sqrt(ea*eb), true
+}
+
+// monoSignal mixes 16-bit stereo PCM to mono averaging every n frames into one sample
+func monoSignal(pcm io.Reader, n int) ([]float32, error) {
+	var res []float32
+	var sum float32
+	frames := 0
+
+	reader := bufio.NewReader(pcm)
+	frame := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, frame); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		for c := 0; c < 2; c++ {
+			sum += float32(int16(binary.LittleEndian.Uint16(frame[c*2:]))) / (math.MaxInt16 + 1)
+		}
+		frames++
+		if frames%n == 0 {
+			res = append(res, sum/float32(n*2))
+			sum = 0
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,48 @@
+package tracks_sync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// noise returns 16-bit stereo PCM of random samples
+func noise(r *rand.Rand, frames int) []byte {
+	buf := &bytes.Buffer{}
+	for i := 0; i < frames; i++ {
+		s := int16(r.Intn(1<<15) - 1<<14)
+		binary.Write(buf, binary.LittleEndian, [2]int16{s, s})
+	}
+	return buf.Bytes()
+}
+
+func Test_analyzeLoop(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	// 120 BPM - такт 2 секунды: такт вступления, 8 одинаковых тактов и такт концовки
+	bar := noise(r, 8000*2)
+	pcm := noise(r, 8000*2)
+	for i := 0; i < 8; i++ {
+		pcm = append(pcm, bar...)
+	}
+	pcm = append(pcm, noise(r, 8000*2)...)
+
+	suggestion, err := analyzeLoop(bytes.NewReader(pcm), 8000, 120)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// доля после конца цикла должна попасть в повторяющиеся такты, поэтому цикл в 7 тактов
+	assert.Equal(t, uint64(2000000), suggestion.LoopStart)
+	assert.Equal(t, uint64(16000000), suggestion.LoopEnd)
+	assert.Equal(t, uint(7), suggestion.Bars)
+	assert.InDelta(t, 1, suggestion.Score, 0.001)
+
+	// меньше 4 тактов
+	_, err = analyzeLoop(bytes.NewReader(pcm[:8000*4*6]), 8000, 120)
+	assert.Equal(t, ErrorNoLoop, err)
+
+	_, err = analyzeLoop(bytes.NewReader(make([]byte, 8000*4*20)), 8000, 120)
+	assert.Equal(t, ErrorNoLoop, err)
+}
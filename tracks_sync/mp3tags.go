@@ -4,8 +4,32 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
 )
 
+const (
+	// frameMagic is written to frames created by the bot, existing frames keep their magic, it is not checked on read
+	frameMagic          uint64 = 0x5458455f4d414a47 // "GJAM_EXT" little endian
+	frameDataLen               = 32                 // length of v2 and v3 data
+	DefaultFrameVersion        = 3
+)
+
+// frameVersion is the layout of GuitarJam frames written to MP3 files
+var frameVersion uint16 = DefaultFrameVersion
+
+// SetFrameVersion selects the layout of GuitarJam frames written to MP3 files: 2 or 3, 0 means the default
+func SetFrameVersion(version uint16) error {
+	if version == 0 {
+		version = DefaultFrameVersion
+	}
+	if _, err := newTrackData(version); err != nil {
+		return err
+	}
+	frameVersion = version
+
+	return nil
+}
+
 type TrackDater interface {
 	Unmarshal([]byte) error
 	Marshal() []byte
@@ -51,8 +75,51 @@ type private_ext_frame_data_v3 struct {
 
 func getFrameNameAndData(raw []byte) (name, data []byte) {
 	i := bytes.Index(raw, []byte{0})
-	i++
-	return raw[:i-1], raw[i:]
+	if i < 0 {
+		// PRIV без владельца - не наш кадр
+		return nil, raw
+	}
+	return raw[:i], raw[i+1:]
+}
+
+// newTrackData returns empty data of the frame version
+func newTrackData(version uint16) (TrackDater, error) {
+	switch version {
+	case 2:
+		return new(private_ext_frame_data_v2), nil
+	case 3:
+		return new(private_ext_frame_data_v3), nil
+	}
+
+	return nil, fmt.Errorf("wrong version: %d", version)
+}
+
+// newFrameBody returns the body of the GuitarJam PRIV frame of the version with the track data,
+// magic and len are taken from the existing frame if it is not nil
+func newFrameBody(track *tracks.Track, version uint16, existing *private_ext_frame_data) ([]byte, error) {
+	frameStruct := private_ext_frame_data{magic: frameMagic, len: frameDataLen}
+	if existing != nil {
+		frameStruct.magic, frameStruct.len = existing.magic, existing.len
+	}
+
+	trackData, err := newTrackData(version)
+	if err != nil {
+		return nil, err
+	}
+	trackData.SetKey(track.Key)
+	trackData.SetMode(track.Mode)
+	trackData.SetBPM(track.BPM)
+	trackData.SetBPI(track.BPI)
+	trackData.SetLoopStart(track.LoopStart)
+	trackData.SetLoopEnd(track.LoopEnd)
+	frameStruct.data = trackData
+
+	bts, err := frameStruct.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte(frameName), 0), bts...), nil
 }
 
 func (p *private_ext_frame_data) Unmarshal(data []byte) error {
@@ -64,18 +131,12 @@ func (p *private_ext_frame_data) Unmarshal(data []byte) error {
 	p.version = binary.LittleEndian.Uint16(data[8:10])
 	p.len = binary.LittleEndian.Uint16(data[10:12])
 
-	switch p.version {
-	case 2:
-		p.data = new(private_ext_frame_data_v2)
-	case 3:
-		p.data = new(private_ext_frame_data_v3)
-	default:
-		return fmt.Errorf("wrong version: %d", p.version)
+	var err error
+	if p.data, err = newTrackData(p.version); err != nil {
+		return err
 	}
 
-	p.data.Unmarshal(data[12:])
-
-	return nil
+	return p.data.Unmarshal(data[12:])
 }
 
 func (p *private_ext_frame_data) Marshal() (data []byte, err error) {
@@ -1,7 +1,14 @@
 package tracks_sync
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/bogem/id3v2"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -42,3 +49,189 @@ func Test_private_ext_frame_data_v2(t *testing.T) {
 
 	assert.EqualValues(t, p, p2)
 }
+
+// silentMP3 returns MPEG-1 Layer III frames of silence: 128 kbit/s, 44100 Hz
+func silentMP3(frames int) []byte {
+	audio := make([]byte, 0, frames*417)
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x64})
+		audio = append(audio, frame...)
+	}
+	return audio
+}
+
+// audioOf returns the file content after the ID3 tag
+func audioOf(data []byte) []byte {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return data
+	}
+	size := 10 + (int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9]))
+	return data[size:]
+}
+
+func TestUpdateMP3Track_roundTrip(t *testing.T) {
+	d, err := ioutil.TempDir("", "tracks_sync")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(d)
+
+	db, err := tracks.NewJamDB(filepath.Join(d, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.DBClose()
+	Init(d, db)
+	defer SetFrameVersion(DefaultFrameVersion)
+
+	audio := silentMP3(20)
+	foreign := id3v2.UnknownFrame{Body: append([]byte("OtherApp\x00"), 1, 2, 3)}
+	const oldMagic uint64 = 0x0102030405060708
+
+	samples := []struct {
+		name  string
+		magic uint64
+		tag   func(tag *id3v2.Tag)
+	}{
+		{name: "no_tag"},
+		{name: "no_priv", tag: func(tag *id3v2.Tag) {
+			tag.SetTitle("Old title")
+		}},
+		{name: "v2_frame", magic: oldMagic, tag: func(tag *id3v2.Tag) {
+			body, _ := newFrameBody(&tracks.Track{Key: 1, BPM: 90, BPI: 8}, 2, &private_ext_frame_data{magic: oldMagic, len: frameDataLen})
+			tag.AddFrame("PRIV", foreign)
+			tag.AddFrame("PRIV", id3v2.UnknownFrame{Body: body})
+		}},
+		{name: "v3_frame", magic: oldMagic, tag: func(tag *id3v2.Tag) {
+			body, _ := newFrameBody(&tracks.Track{Key: 1, BPM: 90, BPI: 8}, 3, &private_ext_frame_data{magic: oldMagic, len: frameDataLen})
+			tag.AddFrame("PRIV", id3v2.UnknownFrame{Body: body})
+		}},
+	}
+
+	for _, sample := range samples {
+		for _, version := range []uint16{2, 3} {
+			fileName := fmt.Sprintf("%s_v%d.mp3", sample.name, version)
+			filePath := filepath.Join(d, fileName)
+			if !assert.NoError(t, ioutil.WriteFile(filePath, audio, 0644)) {
+				continue
+			}
+			if sample.tag != nil {
+				tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+				if !assert.NoError(t, err) {
+					continue
+				}
+				sample.tag(tag)
+				assert.NoError(t, tag.Save())
+				tag.Close()
+			}
+
+			track := &tracks.Track{
+				FilePath:  fileName,
+				Title:     "Blues in A",
+				Artist:    "GuitarJam",
+				Key:       10,
+				Mode:      2,
+				BPM:       120,
+				BPI:       16,
+				LoopStart: 2000000,
+				LoopEnd:   34000000,
+			}
+			assert.NoError(t, SetFrameVersion(version))
+			if !assert.NoError(t, UpdateMP3Track(track), fileName) {
+				continue
+			}
+
+			read, err := readTags(filePath)
+			if !assert.NoError(t, err, fileName) {
+				continue
+			}
+			assert.Equal(t, track.Title, read.Title, fileName)
+			assert.Equal(t, track.Artist, read.Artist, fileName)
+			assert.Equal(t, track.Key, read.Key, fileName)
+			assert.Equal(t, track.Mode, read.Mode, fileName)
+			assert.Equal(t, track.BPM, read.BPM, fileName)
+			assert.Equal(t, track.BPI, read.BPI, fileName)
+			assert.Equal(t, track.LoopStart, read.LoopStart, fileName)
+			assert.Equal(t, track.LoopEnd, read.LoopEnd, fileName)
+
+			data, err := ioutil.ReadFile(filePath)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			assert.Equal(t, audio, audioOf(data), fileName)
+
+			tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+			if !assert.NoError(t, err) {
+				continue
+			}
+			var guitarJam []*private_ext_frame_data
+			foreignKept := false
+			for _, frame := range tag.GetFrames("PRIV") {
+				f := frame.(id3v2.UnknownFrame)
+				name, data := getFrameNameAndData(f.Body)
+				if string(name) != frameName {
+					foreignKept = foreignKept || bytes.Equal(f.Body, foreign.Body)
+					continue
+				}
+				frameStruct := &private_ext_frame_data{}
+				assert.NoError(t, frameStruct.Unmarshal(data))
+				guitarJam = append(guitarJam, frameStruct)
+			}
+			tag.Close()
+
+			if assert.Len(t, guitarJam, 1, fileName) {
+				assert.Equal(t, version, guitarJam[0].version, fileName)
+				if sample.magic != 0 {
+					assert.Equal(t, sample.magic, guitarJam[0].magic, fileName)
+				} else {
+					assert.Equal(t, frameMagic, guitarJam[0].magic, fileName)
+				}
+			}
+			assert.Equal(t, sample.name == "v2_frame", foreignKept, fileName)
+		}
+	}
+}
+
+func TestExportTags(t *testing.T) {
+	d, err := ioutil.TempDir("", "tracks_sync")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(d)
+
+	db, err := tracks.NewJamDB(filepath.Join(d, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.DBClose()
+	Init(d, db)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(d, "blues.mp3"), silentMP3(10), 0644))
+	assert.NoError(t, db.DB().Save(&tracks.Track{FilePath: "blues.mp3", Title: "Blues", Key: 10, BPM: 120, BPI: 16}).Error)
+	assert.NoError(t, db.DB().Save(&tracks.Track{FilePath: "lost.mp3", Unavailable: true}).Error)
+	assert.NoError(t, db.DB().Save(&tracks.Track{FilePath: "deleted.mp3"}).Error)
+
+	exported, errs, err := ExportTags()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, exported)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "deleted.mp3", errs[0].Path)
+	}
+
+	read, err := readTags(filepath.Join(d, "blues.mp3"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Blues", read.Title)
+		assert.EqualValues(t, 10, read.Key)
+		assert.EqualValues(t, 120, read.BPM)
+		assert.EqualValues(t, 16, read.BPI)
+	}
+
+	// файл изменили мы сами - следующая синхронизация его пропустит
+	status, err := Sync(1, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, status.Skipped)
+	}
+}
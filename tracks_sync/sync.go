@@ -1,12 +1,15 @@
 package tracks_sync
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/ayvan/ninjam-dj-bot/lib"
 	"github.com/ayvan/ninjam-dj-bot/tracks"
 	"github.com/bogem/id3v2"
 	"github.com/burillo-se/bs1770wrap"
 	"github.com/sirupsen/logrus"
+	"io"
 	"os"
 	"path"
 	"regexp"
@@ -26,28 +29,40 @@ func Init(d string, db *tracks.JamDB) {
 	jamDB = db
 }
 
-func Walk(path string, info os.FileInfo, err error) error {
+// relativePath returns the path of the file relative to the tracks directory as it is stored in DB
+func relativePath(trackPath string) string {
+	return strings.TrimLeft(strings.TrimPrefix(trackPath, dir), "./")
+}
+
+// fileInfo returns size, modification time in unix nanoseconds and SHA-256 of the file
+func fileInfo(trackPath string) (size, modTime int64, hash string, err error) {
+	file, err := os.Open(trackPath)
 	if err != nil {
-		logrus.Fatal(err)
+		return
 	}
-	if !info.IsDir() {
-		if mp3regex.MatchString(info.Name()) {
-			ProcessMP3Track(path)
-		}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return
 	}
-	return nil
-}
 
-func AnalyzeMP3Track(trackPath string) (track *tracks.Track, err error) {
-	// сделаем путь файла относительным, от текущей директории
-	relativePath := strings.TrimLeft(strings.TrimPrefix(trackPath, dir), "./")
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return
+	}
 
+	return info.Size(), info.ModTime().UnixNano(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readTags reads the track info from ID3 tags of the file: title, artist, album and the GuitarJam PRIV frame
+func readTags(trackPath string) (track *tracks.Track, err error) {
 	tag, err := id3v2.Open(trackPath, id3v2.Options{Parse: true})
 	if err != nil {
 		err = fmt.Errorf("id3v2.Open error for %s: %s", trackPath, err)
-		logrus.Error(err)
 		return
 	}
+	defer tag.Close()
 
 	var trackNumber int
 	num := strings.Trim(tag.GetTextFrame(tag.CommonID("Track number/Position in set")).Text, "\x00")
@@ -58,7 +73,7 @@ func AnalyzeMP3Track(trackPath string) (track *tracks.Track, err error) {
 	album := strings.Trim(tag.Album(), fmt.Sprintf("\x00 \n"))
 
 	track = &tracks.Track{
-		FilePath:         relativePath,
+		FilePath:         relativePath(trackPath),
 		Title:            title,
 		Artist:           artist,
 		Album:            album,
@@ -100,6 +115,16 @@ func AnalyzeMP3Track(trackPath string) (track *tracks.Track, err error) {
 		}
 	}
 
+	return
+}
+
+func AnalyzeMP3Track(trackPath string) (track *tracks.Track, err error) {
+	track, err = readTags(trackPath)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+
 	if track.BPM == 0 || track.Key == 0 {
 		_, fileName := path.Split(trackPath)
 		r := regexp.MustCompile(`^([a-zA-Z#]+)___([\d]+)___([\s\S]+)\.mp3$`)
@@ -137,6 +162,13 @@ func AnalyzeMP3Track(trackPath string) (track *tracks.Track, err error) {
 	track.Shortterm = ldata.Shortterm
 	track.Momentary = ldata.Momentary
 
+	track.FileSize, track.FileModTime, track.FileHash, err = fileInfo(trackPath)
+	if err != nil {
+		err = fmt.Errorf("file info of %s: %s", trackPath, err)
+		logrus.Error(err)
+		return
+	}
+
 	return
 }
 
@@ -149,6 +181,12 @@ func ProcessMP3Track(path string) (track *tracks.Track, err error) {
 		return
 	}
 
+	// удалённые через API треки синхронизация не возвращает, их можно восстановить
+	if deleted, _ := jamDB.DeletedTrackByPath(track.FilePath); deleted != nil {
+		logrus.Infof("track %d of %s is deleted, skipped", deleted.ID, path)
+		return deleted, nil
+	}
+
 	// проверяем, есть ли уже трек в базе
 	if trackInDB, _ := jamDB.TrackByPath(track.FilePath); trackInDB != nil {
 		// если трек есть - назначим ID нашему треку и запись обновится вместо добавления
@@ -158,12 +196,29 @@ func ProcessMP3Track(path string) (track *tracks.Track, err error) {
 		track.Played = trackInDB.Played
 	}
 
+	// BPM и тональность, которых нет в тегах, распознаём по звуку
+	detection := detectTrack(path, track)
+
 	if err = jamDB.DB().Save(track).Error; err != nil {
 		err = fmt.Errorf("add track error for %s: %s", path, err)
 		logrus.Error(err)
 		return
 	}
 
+	if detection != nil {
+		detection.TrackID = track.ID
+		if err := jamDB.DetectionSave(detection); err != nil {
+			logrus.Errorf("save detection of %s: %s", path, err)
+		}
+	}
+
+	// без волновой формы трек играет, её можно посчитать позже при запросе
+	if _, err := UpdateWaveform(track); err != nil {
+		logrus.Errorf("waveform of %s: %s", path, err)
+	}
+
+	processLoop(track)
+
 	return
 }
 
@@ -177,64 +232,58 @@ func UpdateMP3Track(track *tracks.Track) (err error) {
 		logrus.Error(err)
 		return
 	}
+	defer tag.Close()
 
 	tag.AddTextFrame(tag.CommonID("Track number/Position in set"), tag.DefaultEncoding(), fmt.Sprintf("%d\x00", track.AlbumTrackNumber))
 	tag.SetAlbum(track.Album)
 	tag.SetArtist(track.Artist)
 	tag.SetTitle(track.Title)
 
-	frames := tag.GetFrames("PRIV")
-
-	for i, frame := range frames {
-		// тут ошибки не критичны, трек сохранится в БД "как есть" без информации - его можно будет редактировать
+	// кадр GuitarJam пишем заново в выбранной версии, даже если в файле его не было;
+	// прочие кадры PRIV других программ оставляем как есть
+	var existing *private_ext_frame_data
+	var frames []id3v2.Framer
+	for _, frame := range tag.GetFrames("PRIV") {
 		f, ok := frame.(id3v2.UnknownFrame)
-		if ok {
-			frameStruct := private_ext_frame_data{}
-			name, data := getFrameNameAndData(f.Body)
-			if string(name) != "GuitarJam" {
-				continue
-			}
-
-			err := frameStruct.Unmarshal(data)
-			if err != nil {
-				logrus.Warn(err)
-				continue
-			}
-
-			if err = frameStruct.checkVersion(); err != nil {
-				logrus.Warn(err)
-				continue
-			}
-
-			trackData := &private_ext_frame_data_v3{}
-
-			trackData.SetKey(track.Key)
-			trackData.SetMode(track.Mode)
-			trackData.SetBPM(track.BPM)
-			trackData.SetBPI(track.BPI)
-			trackData.SetLoopStart(track.LoopStart)
-			trackData.SetLoopEnd(track.LoopEnd)
-
-			frameStruct.data = trackData
-
-			bts, err := frameStruct.Marshal()
-			if err != nil {
-				return err
-			}
+		if !ok {
+			frames = append(frames, frame)
+			continue
+		}
+		name, data := getFrameNameAndData(f.Body)
+		if string(name) != frameName {
+			frames = append(frames, frame)
+			continue
+		}
 
-			f.Body = append([]byte(frameName), 0)
-			f.Body = append(f.Body, bts...)
-			frames[i] = f
-			break
+		frameStruct := &private_ext_frame_data{}
+		if err := frameStruct.Unmarshal(data); err != nil {
+			logrus.Warnf("GuitarJam frame of %s is replaced: %s", trackPath, err)
+			continue
 		}
+		existing = frameStruct
+	}
+
+	body, err := newFrameBody(track, frameVersion, existing)
+	if err != nil {
+		return
 	}
+	frames = append(frames, id3v2.UnknownFrame{Body: body})
 
 	tag.DeleteFrames("PRIV")
 	for _, frame := range frames {
 		tag.AddFrame("PRIV", frame)
 	}
 
-	err = tag.Save()
+	if err = tag.Save(); err != nil {
+		return
+	}
+
+	// файл изменили мы сами, следующая синхронизация не должна анализировать его заново
+	size, modTime, hash, err := fileInfo(trackPath)
+	if err != nil {
+		return
+	}
+	err = jamDB.TrackFileUpdate(track.FilePath, size, modTime, hash)
 
 	return
 }
@@ -0,0 +1,138 @@
+package tracks_sync
+
+import (
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	DefaultRescanPeriod = time.Minute * 10
+	watchSettle         = time.Second * 2 // the file is synced when it isn't changed for this time, copying may be in progress
+	watchEventsBuffer   = 1024
+)
+
+// Watcher keeps DB in sync with the tracks directory while the bot runs: files reported by filesystem events
+// are synced as soon as they settle, the whole directory is rescanned on start and periodically
+// in case events were missed or are not supported
+type Watcher struct {
+	rescanPeriod time.Duration
+	workers      int
+	events       chan string   // paths of changed files and directories
+	rescan       chan struct{} // filesystem events ask for a rescan, e.g. on a new directory
+	stop         chan struct{}
+	done         chan struct{}
+	notify       io.Closer // filesystem events source, nil if not supported
+}
+
+// NewWatcher creates the watcher rescanning the directory every rescanPeriod by workers
+func NewWatcher(rescanPeriod time.Duration, workers int) *Watcher {
+	if rescanPeriod <= 0 {
+		rescanPeriod = DefaultRescanPeriod
+	}
+
+	return &Watcher{
+		rescanPeriod: rescanPeriod,
+		workers:      workers,
+		events:       make(chan string, watchEventsBuffer),
+		rescan:       make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Start starts watching the tracks directory
+func (w *Watcher) Start() {
+	notify, err := w.watch()
+	if err != nil {
+		logrus.Warnf("filesystem events are not available, the tracks directory is rescanned every %s: %s", w.rescanPeriod, err)
+	} else {
+		w.notify = notify
+	}
+
+	go w.run()
+}
+
+// Stop stops watching and waits for the running sync
+func (w *Watcher) Stop() {
+	close(w.stop)
+	if w.notify != nil {
+		w.notify.Close()
+	}
+	<-w.done
+}
+
+// changed is called by the events source with the path of the changed file or directory
+func (w *Watcher) changed(path string) {
+	select {
+	case w.events <- path:
+	case <-w.stop:
+	}
+}
+
+// requestRescan is called by the events source if it can't tell which files are changed
+func (w *Watcher) requestRescan() {
+	select {
+	case w.rescan <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	rescan := time.NewTicker(w.rescanPeriod)
+	defer rescan.Stop()
+	settle := time.NewTicker(time.Second)
+	defer settle.Stop()
+
+	// изменения, сделанные пока бот не работал
+	w.sync()
+
+	pending := map[string]time.Time{}
+	for {
+		select {
+		case <-w.stop:
+			return
+		case path := <-w.events:
+			pending[path] = time.Now()
+		case <-rescan.C:
+			w.sync()
+		case <-w.rescan:
+			w.sync()
+		case now := <-settle.C:
+			for path, changedAt := range pending {
+				if now.Sub(changedAt) >= watchSettle {
+					delete(pending, path)
+					w.syncPath(path)
+				}
+			}
+		}
+	}
+}
+
+func (w *Watcher) sync() {
+	if _, err := Sync(w.workers, nil); err == ErrorSyncRunning {
+		logrus.Debug("tracks directory rescan skipped, sync is running")
+	}
+}
+
+// syncPath syncs the changed file: a missing file makes its track unavailable, a new directory is rescanned
+func (w *Watcher) syncPath(path string) {
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		if _, err := removeFile(path); err != nil {
+			logrus.Errorf("mark %s unavailable: %s", path, err)
+		}
+	case err != nil:
+		logrus.Errorf("watched file %s: %s", path, err)
+	case info.IsDir():
+		w.sync()
+	case mp3regex.MatchString(info.Name()):
+		if _, err := syncFile(path); err != nil {
+			logrus.Errorf("sync of %s failed: %s", path, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+//go:build linux
+// +build linux
+
+package tracks_sync
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE |
+	syscall.IN_CREATE
+
+// inotify reports changes of the tracks directory, it is not recursive so every subdirectory is watched
+type inotify struct {
+	fd      int
+	file    *os.File
+	watches map[int32]string // directories by watch descriptors
+}
+
+// watch starts inotify of the tracks directory and all its subdirectories
+func (w *Watcher) watch() (io.Closer, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	// неблокирующий дескриптор работает через поллер Go, поэтому Close прерывает Read
+	n := &inotify{fd: fd, file: os.NewFile(uintptr(fd), "inotify"), watches: map[int32]string{}}
+	if err = n.addTree(dir); err != nil {
+		n.file.Close()
+		return nil, err
+	}
+
+	go n.read(w)
+
+	return n.file, nil
+}
+
+// addTree watches the directory and its subdirectories
+func (n *inotify) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(n.fd, path, inotifyMask)
+		if err != nil {
+			return err
+		}
+		n.watches[int32(wd)] = path
+		return nil
+	})
+}
+
+func (n *inotify) read(w *Watcher) {
+	buf := make([]byte, (syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)*64)
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				logrus.Errorf("inotify read: %s", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := string(bytes.TrimRight(buf[offset+syscall.SizeofInotifyEvent:offset+syscall.SizeofInotifyEvent+int(event.Len)], "\x00"))
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			n.handle(w, event, name)
+		}
+	}
+}
+
+func (n *inotify) handle(w *Watcher, event *syscall.InotifyEvent, name string) {
+	if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.requestRescan()
+		return
+	}
+	if event.Mask&syscall.IN_IGNORED != 0 {
+		delete(n.watches, event.Wd)
+		return
+	}
+
+	parent, ok := n.watches[event.Wd]
+	if !ok {
+		return
+	}
+	path := filepath.Join(parent, name)
+
+	if event.Mask&syscall.IN_ISDIR != 0 {
+		// новую директорию наблюдаем вместе с тем, что в неё успели скопировать;
+		// у удалённой или перемещённой пропали все треки - это найдёт пересканирование
+		if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			if err := n.addTree(path); err != nil {
+				logrus.Errorf("inotify watch of %s: %s", path, err)
+			}
+		}
+		w.requestRescan()
+		return
+	}
+
+	// создание файла не интересно - он синхронизируется, когда запись закончится
+	if event.Mask&syscall.IN_CREATE == 0 && mp3regex.MatchString(name) {
+		w.changed(path)
+	}
+}
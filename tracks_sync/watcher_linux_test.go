@@ -0,0 +1,56 @@
+package tracks_sync
+
+import (
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	d, err := ioutil.TempDir("", "tracks_sync")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(d)
+
+	db, err := tracks.NewJamDB(filepath.Join(d, "tracks.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.DBClose()
+	Init(d, db)
+
+	file := filepath.Join(d, "track.mp3")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("track"), 0644))
+	size, modTime, hash, err := fileInfo(file)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, db.DB().Save(&tracks.Track{FilePath: "track.mp3", FileSize: size, FileModTime: modTime, FileHash: hash}).Error)
+
+	watcher := NewWatcher(time.Hour, 1)
+	watcher.Start()
+	defer watcher.Stop()
+	if !assert.NotNil(t, watcher.notify) {
+		return
+	}
+
+	// переименование в новую директорию: ID трека сохраняется
+	assert.NoError(t, os.Mkdir(filepath.Join(d, "blues"), 0755))
+	time.Sleep(time.Millisecond * 100)
+	assert.NoError(t, os.Rename(file, filepath.Join(d, "blues", "renamed.mp3")))
+	assert.Eventually(t, func() bool {
+		track, err := db.Track(1)
+		return err == nil && track.FilePath == "blues/renamed.mp3" && !track.Unavailable
+	}, time.Second*10, time.Millisecond*100)
+
+	assert.NoError(t, os.Remove(filepath.Join(d, "blues", "renamed.mp3")))
+	assert.Eventually(t, func() bool {
+		track, err := db.Track(1)
+		return err == nil && track.Unavailable
+	}, time.Second*10, time.Millisecond*100)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package tracks_sync
+
+import (
+	"errors"
+	"io"
+)
+
+// watch is not supported, changes are found by periodic rescans only
+func (w *Watcher) watch() (io.Closer, error) {
+	return nil, errors.New("inotify is supported on Linux only")
+}
@@ -0,0 +1,229 @@
+package tracks_sync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/ayvan/ninjam-dj-bot/lib"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/hajimehoshi/go-mp3"
+	"io"
+	"math"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	waveformPeaksRate    = 100 // peaks per second, enough to place loop markers within 10 ms
+	waveformLoudnessRate = 10  // short-term loudness is measured every 100 ms
+	shortTermBlocks      = 30  // short-term loudness window is 3 seconds, EBU R128
+	loudnessFloor        = -70 // absolute gate of EBU R128, quieter is silence
+)
+
+// BeatGrid is the beats and bars of the track aligned to its loop start
+type BeatGrid struct {
+	BPM   uint      `json:"bpm"`
+	Beats []float64 `json:"beats"` // seconds of every beat
+	Bars  []float64 `json:"bars"`  // seconds of every bar start, a bar starts at the loop start
+}
+
+// UpdateWaveform computes the waveform of the track and saves it
+func UpdateWaveform(track *tracks.Track) (waveform *tracks.Waveform, err error) {
+	waveform, err = AnalyzeWaveform(path.Join(dir, track.FilePath))
+	if err != nil {
+		return
+	}
+	waveform.TrackID = track.ID
+	err = jamDB.WaveformSave(waveform)
+
+	return
+}
+
+// TrackWaveform returns the saved waveform of the track, it is computed if the track was synced without it
+func TrackWaveform(track *tracks.Track) (*tracks.Waveform, error) {
+	waveform, err := jamDB.Waveform(track.ID)
+	if err == tracks.ErrorNotFound {
+		return UpdateWaveform(track)
+	}
+
+	return waveform, err
+}
+
+// AnalyzeWaveform computes peaks and short-term loudness of the MP3 file
+func AnalyzeWaveform(trackPath string) (*tracks.Waveform, error) {
+	file, err := os.Open(trackPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		return nil, fmt.Errorf("NewDecoder error in %s: %s", trackPath, err)
+	}
+
+	return analyzeWaveform(decoder, decoder.SampleRate())
+}
+
+// analyzeWaveform computes the waveform of 16-bit stereo PCM
+func analyzeWaveform(pcm io.Reader, sampleRate int) (*tracks.Waveform, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("bad sample rate %d", sampleRate)
+	}
+	peakFrames := sampleRate / waveformPeaksRate
+	blockFrames := sampleRate / waveformLoudnessRate
+
+	var mins, maxs, blocks []float32
+	var min, max float32 = 1, -1
+	var blockSum float64
+	filters := [2]*kWeighting{newKWeighting(sampleRate), newKWeighting(sampleRate)}
+
+	reader := bufio.NewReader(pcm)
+	frame := make([]byte, 4)
+	frames := 0
+	for {
+		if _, err := io.ReadFull(reader, frame); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		frames++
+
+		for c := 0; c < 2; c++ {
+			s := float32(int16(binary.LittleEndian.Uint16(frame[c*2:]))) / (math.MaxInt16 + 1)
+			if s < min {
+				min = s
+			}
+			if s > max {
+				max = s
+			}
+			k := filters[c].process(float64(s))
+			blockSum += k * k
+		}
+
+		if frames%peakFrames == 0 {
+			mins, maxs = append(mins, min), append(maxs, max)
+			min, max = 1, -1
+		}
+		if frames%blockFrames == 0 {
+			blocks = append(blocks, float32(blockSum/float64(blockFrames)))
+			blockSum = 0
+		}
+	}
+	if frames%peakFrames != 0 {
+		mins, maxs = append(mins, min), append(maxs, max)
+	}
+	if rest := frames % blockFrames; rest != 0 {
+		blocks = append(blocks, float32(blockSum/float64(rest)))
+	}
+
+	waveform := &tracks.Waveform{
+		Length:       uint64(time.Duration(frames) * time.Second / time.Duration(sampleRate) / time.Microsecond),
+		PeaksRate:    waveformPeaksRate,
+		LoudnessRate: waveformLoudnessRate,
+	}
+	waveform.SetPeaks(mins, maxs)
+	waveform.SetLoudness(shortTermLoudness(blocks))
+
+	return waveform, nil
+}
+
+// shortTermLoudness returns loudness of the window of shortTermBlocks ending with every block,
+// blocks are mean squares of K-weighted samples summed over channels
+func shortTermLoudness(blocks []float32) []float32 {
+	res := make([]float32, len(blocks))
+	var sum float64
+	for i, block := range blocks {
+		sum += float64(block)
+		n := shortTermBlocks
+		if i >= shortTermBlocks {
+			sum -= float64(blocks[i-shortTermBlocks])
+		} else {
+			n = i + 1
+		}
+
+		loudness := float64(loudnessFloor)
+		if mean := sum / float64(n); mean > 0 {
+			loudness = math.Max(-0.691+10*math.Log10(mean), loudnessFloor)
+		}
+		res[i] = float32(loudness)
+	}
+
+	return res
+}
+
+// kWeighting is the K-weighting filter of ITU-R BS.1770: high shelf and high pass biquads
+type kWeighting struct {
+	shelf, highPass biquad
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// newKWeighting calculates the filter for the sample rate the way libebur128 does
+func newKWeighting(sampleRate int) *kWeighting {
+	rate := float64(sampleRate)
+
+	f0, g, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return &kWeighting{shelf: shelf, highPass: highPass}
+}
+
+func (f *kWeighting) process(x float64) float64 {
+	return f.highPass.process(f.shelf.process(x))
+}
+
+// NewBeatGrid returns beats and bars of the track from its BPM, bars start at the loop start,
+// the grid is empty if BPM is unknown
+func NewBeatGrid(track *tracks.Track, length time.Duration) BeatGrid {
+	grid := BeatGrid{BPM: track.BPM, Beats: []float64{}, Bars: []float64{}}
+	if track.BPM == 0 || length <= 0 {
+		return grid
+	}
+
+	beat := time.Minute / time.Duration(track.BPM)
+	// первая доля - самая ранняя, попадающая в трек при отсчёте от начала цикла
+	start := time.Duration(track.LoopStart) * time.Microsecond
+	first := start % beat
+	n := int((start - first) / beat) // номер доли начала цикла от первой доли
+	for i, t := 0, first; t < length; i, t = i+1, t+beat {
+		grid.Beats = append(grid.Beats, t.Seconds())
+		if (i-n)%lib.BeatsPerBar == 0 {
+			grid.Bars = append(grid.Bars, t.Seconds())
+		}
+	}
+
+	return grid
+}
@@ -0,0 +1,60 @@
+package tracks_sync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ayvan/ninjam-dj-bot/tracks"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// sine returns seconds of 16-bit stereo PCM with the sine of the amplitude in both channels
+func sine(sampleRate int, freq, amplitude float64, seconds float64) []byte {
+	buf := &bytes.Buffer{}
+	for i := 0; i < int(float64(sampleRate)*seconds); i++ {
+		s := int16(amplitude * math.MaxInt16 * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)))
+		binary.Write(buf, binary.LittleEndian, [2]int16{s, s})
+	}
+	return buf.Bytes()
+}
+
+func Test_analyzeWaveform(t *testing.T) {
+	pcm := append(sine(48000, 1000, 0.5, 4), make([]byte, 48000*4)...) // 4 секунды синуса и секунда тишины
+
+	waveform, err := analyzeWaveform(bytes.NewReader(pcm), 48000)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint64(5000000), waveform.Length)
+
+	points := waveform.Points(5)
+	assert.InDelta(t, 0.5, points.Max[0], 0.01)
+	assert.InDelta(t, -0.5, points.Min[3], 0.01)
+	assert.Equal(t, float32(0), points.Max[4])
+
+	// синус 1 кГц с пиком -6 dBFS в обоих каналах имеет громкость -6 LUFS
+	assert.Len(t, waveform.Loudness, 50*4)
+	loudness := waveform.Points(50).Loudness
+	assert.InDelta(t, -6.02, loudness[39], 0.1)
+	assert.Less(t, loudness[45], loudness[39])
+
+	silence, err := analyzeWaveform(bytes.NewReader(make([]byte, 48000*4)), 48000)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []float32{loudnessFloor}, silence.Points(1).Loudness)
+	}
+}
+
+func TestNewBeatGrid(t *testing.T) {
+	// 120 BPM - доля 0.5 секунды, цикл начинается на 1.25 секунде
+	track := &tracks.Track{BPM: 120, LoopStart: 1250000}
+	grid := NewBeatGrid(track, time.Second*3)
+	assert.Equal(t, []float64{0.25, 0.75, 1.25, 1.75, 2.25, 2.75}, grid.Beats)
+	assert.Equal(t, []float64{1.25}, grid.Bars)
+
+	grid = NewBeatGrid(track, time.Second*4)
+	assert.Equal(t, []float64{1.25, 3.25}, grid.Bars)
+
+	assert.Empty(t, NewBeatGrid(&tracks.Track{}, time.Second).Beats)
+}